@@ -1,4 +1,5 @@
 CREATE TABLE IF NOT EXISTS transactions (
+    account_id String DEFAULT '',
     kind String NOT NULL,
     date Date NOT NULL,
     recipient String NOT NULL,
@@ -6,14 +7,123 @@ CREATE TABLE IF NOT EXISTS transactions (
     primary_class String,
     secondary_class String,
     hash String NOT NULL,
-    internal UInt8 DEFAULT 0
+    internal UInt8 DEFAULT 0,
+    iban String DEFAULT '',
+    bic String DEFAULT '',
+    usage String DEFAULT '',
+    description String DEFAULT '',
+    tags Array(String) DEFAULT [],
+    occurrence UInt32 DEFAULT 0
 )
 ENGINE = MergeTree
 PRIMARY KEY (date, recipient, kind, amount);
 
+-- columns added after the first release, no-op for new installations
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS iban String DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS bic String DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS usage String DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS description String DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS account_id String DEFAULT '' FIRST;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tags Array(String) DEFAULT [];
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS occurrence UInt32 DEFAULT 0;
+
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id String,
+    iban String,
+    name String,
+    bank String,
+    owner String,
+    type LowCardinality(String)
+) ENGINE = ReplacingMergeTree()
+ORDER BY id;
+
 
 CREATE TABLE IF NOT EXISTS file_hashes (
     path String,
     sha256 String
 ) ENGINE = MergeTree()
-ORDER BY path;
\ No newline at end of file
+ORDER BY path;
+
+CREATE TABLE IF NOT EXISTS imports (
+    id String,
+    path String,
+    sha256 String,
+    started_at DateTime,
+    finished_at DateTime,
+    status LowCardinality(String),
+    rows_total UInt32,
+    rows_inserted UInt32,
+    error String
+) ENGINE = MergeTree()
+ORDER BY (started_at, id);
+
+
+CREATE TABLE IF NOT EXISTS rules (
+    id String,
+    pattern String,
+    primary_class String,
+    secondary_class String,
+    priority Int32 DEFAULT 0,
+    accounts Array(String) DEFAULT []
+) ENGINE = ReplacingMergeTree()
+ORDER BY id;
+
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS accounts Array(String) DEFAULT [];
+
+
+CREATE TABLE IF NOT EXISTS overrides (
+    transaction_hash String,
+    primary_class String,
+    secondary_class String,
+    updated_at DateTime
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY transaction_hash;
+
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id String,
+    job LowCardinality(String),
+    started_at DateTime,
+    finished_at DateTime,
+    status LowCardinality(String),
+    files_processed UInt32,
+    rows_inserted UInt32,
+    error String
+) ENGINE = MergeTree()
+ORDER BY (started_at, id);
+
+
+CREATE TABLE IF NOT EXISTS users (
+    name String,
+    password_hash String,
+    role LowCardinality(String),
+    accounts Array(String),
+    created_at DateTime
+) ENGINE = ReplacingMergeTree()
+ORDER BY name;
+
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id String,
+    user_name String,
+    name String,
+    hash String,
+    created_at DateTime
+) ENGINE = ReplacingMergeTree()
+ORDER BY id;
+
+
+-- append-only, rows are never changed or removed
+CREATE TABLE IF NOT EXISTS audit_log (
+    id String,
+    changed_at DateTime,
+    user_name String,
+    source LowCardinality(String),
+    entity LowCardinality(String),
+    entity_id String,
+    account_id String,
+    before_value String,
+    after_value String
+) ENGINE = MergeTree()
+ORDER BY (changed_at, id);
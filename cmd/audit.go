@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/audit"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/storage"
+)
+
+// runAudit prints the latest changes made by hand
+func runAudit(ctx context.Context, conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	limit := flags.Int("limit", 50, "number of changes to show")
+	format := flags.String("format", "table", "output format: table or json")
+	var filter audit.Filter
+	flags.StringVar(&filter.Entity, "entity", "", "only changes of overrides, tags or rules")
+	flags.StringVar(&filter.EntityID, "id", "", "only changes of the transaction hash or rule id")
+	flags.StringVar(&filter.User, "user", "", "only changes of the user")
+	flags.StringVar(&filter.Source, "source", "", "only changes through cli, api or ui")
+	flags.StringVar(&filter.From, "from", "", "only changes on or after the day, like 2025-03-01")
+	flags.StringVar(&filter.To, "to", "", "only changes on or before the day, like 2025-03-31")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [-config path] audit [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 0 || *limit < 1 || (*format != "table" && *format != "json") {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := filter.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	store, err := storage.Open(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error opening storage:", err)
+		return exitFailure
+	}
+	defer store.Close()
+	entries, err := audit.Query(ctx, store, filter, *limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error getting audit log:", err)
+		return exitFailure
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(map[string]any{"entries": entries})
+	} else {
+		err = printAuditEntries(entries)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error printing audit log:", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// printAuditEntries writes the audit log entries as a table
+func printAuditEntries(entries []models.AuditEntry) error {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CHANGED\tUSER\tSOURCE\tENTITY\tID\tBEFORE\tAFTER")
+	for _, entry := range entries {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.ChangedAt.Local().Format(time.DateTime), entry.User, entry.Source,
+			entry.Entity, entry.EntityID, orDash(entry.Before), orDash(entry.After))
+	}
+	return table.Flush()
+}
+
+// orDash returns a dash for an empty value
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
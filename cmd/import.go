@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/jobs"
+)
+
+// runImport imports the files and directories once, prints the report and
+// returns a non-zero exit code if any file failed
+func runImport(ctx context.Context, conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "parse and categorise the files without storing anything")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [-config path] import [-dry-run] <files|dirs>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	report, err := jobs.New(conf).Import(ctx, flags.Args(), *dryRun)
+	if report != nil {
+		if err := report.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "error printing report:", err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import failed:", err)
+		return exitFailure
+	}
+	if report.Failed() {
+		return exitFailure
+	}
+	return exitOK
+}
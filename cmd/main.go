@@ -7,17 +7,30 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/13excite/c24-expense/pkg/api"
+	"github.com/13excite/c24-expense/pkg/auth"
 	"github.com/13excite/c24-expense/pkg/config"
-	"github.com/13excite/c24-expense/pkg/driver"
 	"github.com/13excite/c24-expense/pkg/helper"
 	"github.com/13excite/c24-expense/pkg/jobs"
 	"github.com/13excite/c24-expense/pkg/logger"
+	"github.com/13excite/c24-expense/pkg/metrics"
+	"github.com/13excite/c24-expense/pkg/server"
+	"github.com/13excite/c24-expense/pkg/storage"
+	"github.com/13excite/c24-expense/pkg/ui"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
+// Exit codes of the commands
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
 func main() {
 	configPath := flag.String("config", "", "path to the configuration file")
+	flag.Usage = usage
 	flag.Parse()
 
 	conf := config.Config{}
@@ -30,37 +43,98 @@ func main() {
 	err := logger.InitLogger(&conf)
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
-	}
-	logger := zap.S().With("package", "cmd")
-
-	// Open a connection to the database
-	conn, err := driver.OpenDB(conf.Clickhouse.Username,
-		conf.Clickhouse.Password, conf.Clickhouse.Address, conf.Clickhouse.Database)
-	if err != nil {
-		logger.Error("Error opening database connection", zap.Error(err))
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
-	defer conn.Close()
 
 	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 	// Wait for shutdown signal
 	go func(ctx context.Context, cancel context.CancelFunc) {
 		defer cancel()
 		helper.WaitForShutdown(ctx)
 	}(ctx, cancel)
 
-	// Start the background job to parse CSV files
-	parseJob := jobs.New(&conf)
+	var code int
+	switch command := flag.Arg(0); command {
+	case "":
+		code = runDaemon(ctx, &conf)
+	case "import":
+		code = runImport(ctx, &conf, flag.Args()[1:])
+	case "validate":
+		code = runValidate(ctx, &conf, flag.Args()[1:])
+	case "status":
+		code = runStatus(ctx, &conf, flag.Args()[1:])
+	case "audit":
+		code = runAudit(ctx, &conf, flag.Args()[1:])
+	case "user":
+		code = runUser(ctx, &conf, flag.Args()[1:])
+	case "token":
+		code = runToken(ctx, &conf, flag.Args()[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", command)
+		flag.Usage()
+		code = exitUsage
+	}
+	cancel()
+	os.Exit(code)
+}
+
+// usage prints the commands and the global flags
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [-config path] [command]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Without a command the background jobs run until the process is stopped.")
+	fmt.Fprintln(out, "\nCommands:")
+	fmt.Fprintln(out, "  import [-dry-run] <files|dirs>                import the files once and print the report")
+	fmt.Fprintln(out, "  validate [-format table|json] <files|dirs>  preview the import without storing anything")
+	fmt.Fprintln(out, "  status [-limit n] [-format table|json]      show the latest runs of the background jobs")
+	fmt.Fprintln(out, "  audit [-entity e] [-user u] [-from day]     show the changes made by hand to categories, tags and rules")
+	fmt.Fprintln(out, "  user add|set|list|delete                    manage the users of the API and the UI")
+	fmt.Fprintln(out, "  token create|list|revoke                    manage the API tokens of the users")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// runDaemon runs the background jobs until ctx is cancelled
+func runDaemon(ctx context.Context, conf *config.Config) int {
+	logger := zap.S().With("package", "cmd")
+
+	// Wait for the storage backend, it may start later than the service
+	store, err := storage.Connect(ctx, conf)
+	if err != nil {
+		logger.Error("Error opening storage", zap.Error(err))
+		return exitFailure
+	}
+	defer store.Close()
+
+	// Start the background jobs, they share the store with the HTTP server
+	jobMetrics := metrics.New()
+	store = jobMetrics.Store(conf.Storage, store)
+	parseJob := jobs.New(conf).WithStore(store).WithMetrics(jobMetrics)
 	group, ctx := errgroup.WithContext(ctx)
 	group.Go(func() error {
-		return parseJob.RunBackgroundParseJob(ctx)
+		return parseJob.RunBackgroundJobs(ctx)
 	})
+	if conf.HTTPPort > 0 {
+		authenticator := auth.New(store, conf.Auth)
+		group.Go(func() error {
+			return server.New(store, authenticator).
+				WithBreaker(parseJob.Breaker()).
+				WithPending(parseJob).
+				Handle(api.Prefix, api.New(store, authenticator).WithImporter(ctx, parseJob, conf.Uploads).Handler()).
+				Handle(ui.Prefix, ui.New(store, authenticator).WithRecategoriser(ctx, parseJob).Handler()).
+				Run(ctx, conf.HTTPPort)
+		})
+	}
+	if conf.MetricsPort > 0 {
+		group.Go(func() error {
+			return server.ListenAndServe(ctx, conf.MetricsPort, jobMetrics.Handler())
+		})
+	}
 
-	// Wait for the background job to finish
-	err = group.Wait()
-	if err != nil {
+	// Wait for the background jobs and the HTTP server to finish
+	if err := group.Wait(); err != nil {
 		logger.Error("Error in background job", zap.Error(err))
+		return exitFailure
 	}
+	return exitOK
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/storage"
+)
+
+// runStatus prints the latest runs of the background jobs. The store is
+// read as it is, its schema isn't migrated.
+func runStatus(ctx context.Context, conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "number of runs to show")
+	format := flags.String("format", "table", "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [-config path] status [-limit n] [-format table|json]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 0 || *limit < 1 || (*format != "table" && *format != "json") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	store, err := storage.OpenExisting(ctx, conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error opening storage:", err)
+		return exitFailure
+	}
+	defer store.Close()
+	runs, err := store.GetJobRuns(ctx, *limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error getting job runs:", err)
+		return exitFailure
+	}
+
+	if *format == "json" {
+		if runs == nil {
+			runs = []models.JobRun{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(map[string]any{"runs": runs})
+	} else {
+		err = printRuns(runs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error printing job runs:", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// printRuns writes the job runs as a table
+func printRuns(runs []models.JobRun) error {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "JOB\tSTARTED\tDURATION\tSTATUS\tFILES\tROWS\tERROR")
+	for _, run := range runs {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", run.Job,
+			run.StartedAt.Local().Format(time.DateTime),
+			run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond),
+			run.Status, run.FilesProcessed, run.RowsInserted, run.Error)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/storage"
+)
+
+// runUser manages the local users of the API and the UI
+func runUser(ctx context.Context, conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("user", flag.ContinueOnError)
+	role := flags.String("role", models.RoleViewer, "role of the user: viewer, editor or admin")
+	accounts := flags.String("accounts", "", "comma separated ids of the visible accounts, * for all, empty for none")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage: %s [-config path] user <command>\n\n", os.Args[0])
+		fmt.Fprintln(out, "  add [-role r] [-accounts ids] <name>  create a user, the password is read from stdin")
+		fmt.Fprintln(out, "  set [-role r] [-accounts ids] <name>  change the given fields, an empty password keeps the old one")
+		fmt.Fprintln(out, "  list                                  show the users")
+		fmt.Fprintln(out, "  delete <name>                         remove a user and its tokens")
+		fmt.Fprintln(out)
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	command := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	wantArgs := 1
+	if command == "list" {
+		wantArgs = 0
+	}
+	if flags.NArg() != wantArgs {
+		flags.Usage()
+		return exitUsage
+	}
+
+	store, err := storage.Open(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error opening storage:", err)
+		return exitFailure
+	}
+	defer store.Close()
+
+	switch command {
+	case "add", "set":
+		name := flags.Arg(0)
+		users, err := store.GetUsers(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error getting users:", err)
+			return exitFailure
+		}
+		var user *models.User
+		for i := range users {
+			if users[i].Name == name {
+				user = &users[i]
+			}
+		}
+		if command == "add" && user != nil {
+			fmt.Fprintf(os.Stderr, "user %q already exists\n", name)
+			return exitFailure
+		}
+		if command == "set" && user == nil {
+			fmt.Fprintf(os.Stderr, "user %q not found\n", name)
+			return exitFailure
+		}
+		if user == nil {
+			user = &models.User{Name: name, Role: *role, Accounts: splitList(*accounts)}
+		}
+		// set changes only the given flags
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "role":
+				user.Role = *role
+			case "accounts":
+				user.Accounts = splitList(*accounts)
+			}
+		})
+		password, err := readPassword()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error reading password:", err)
+			return exitFailure
+		}
+		if _, err := auth.SaveUser(ctx, store, *user, password); err != nil {
+			fmt.Fprintln(os.Stderr, "error saving user:", err)
+			return exitFailure
+		}
+	case "list":
+		users, err := store.GetUsers(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error getting users:", err)
+			return exitFailure
+		}
+		if err := printUsers(users); err != nil {
+			fmt.Fprintln(os.Stderr, "error printing users:", err)
+			return exitFailure
+		}
+	case "delete":
+		if err := auth.DeleteUser(ctx, store, flags.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, "error deleting user:", err)
+			return exitFailure
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown user command %q\n", command)
+		flags.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// runToken manages the API tokens of the users
+func runToken(ctx context.Context, conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	name := flags.String("name", "", "description of the token, e.g. the script using it")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage: %s [-config path] token <command>\n\n", os.Args[0])
+		fmt.Fprintln(out, "  create [-name text] <user>  create a token and print it once")
+		fmt.Fprintln(out, "  list                        show the tokens")
+		fmt.Fprintln(out, "  revoke <id>                 remove a token")
+		fmt.Fprintln(out)
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	command := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	wantArgs := 1
+	if command == "list" {
+		wantArgs = 0
+	}
+	if flags.NArg() != wantArgs {
+		flags.Usage()
+		return exitUsage
+	}
+
+	store, err := storage.Open(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error opening storage:", err)
+		return exitFailure
+	}
+	defer store.Close()
+
+	switch command {
+	case "create":
+		plain, token, err := auth.CreateToken(ctx, store, flags.Arg(0), *name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error creating token:", err)
+			return exitFailure
+		}
+		fmt.Fprintf(os.Stderr, "Created token %s, it isn't shown again:\n", token.ID)
+		fmt.Println(plain)
+	case "list":
+		tokens, err := store.GetAPITokens(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error getting tokens:", err)
+			return exitFailure
+		}
+		if err := printTokens(tokens); err != nil {
+			fmt.Fprintln(os.Stderr, "error printing tokens:", err)
+			return exitFailure
+		}
+	case "revoke":
+		if err := auth.RevokeToken(ctx, store, flags.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, "error revoking token:", err)
+			return exitFailure
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown token command %q\n", command)
+		flags.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// readPassword reads the password from the terminal without echo, or the
+// first line of stdin when it isn't a terminal
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// splitList returns the non-empty items of a comma separated list
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printUsers writes the users as a table
+func printUsers(users []models.User) error {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tROLE\tACCOUNTS\tCREATED")
+	for _, user := range users {
+		accounts := "none"
+		if len(user.Accounts) > 0 {
+			accounts = strings.Join(user.Accounts, ",")
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", user.Name, user.Role, accounts,
+			user.CreatedAt.Local().Format(time.DateTime))
+	}
+	return table.Flush()
+}
+
+// printTokens writes the API tokens without their hashes as a table
+func printTokens(tokens []models.APIToken) error {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tUSER\tNAME\tCREATED")
+	for _, token := range tokens {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", token.ID, token.User, token.Name,
+			token.CreatedAt.Local().Format(time.DateTime))
+	}
+	return table.Flush()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/jobs"
+)
+
+// runValidate previews the import of the files and directories without
+// storing anything and returns a non-zero exit code if any file can't be parsed
+func runValidate(ctx context.Context, conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	format := flags.String("format", "table", "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [-config path] validate [-format table|json] <files|dirs>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 || (*format != "table" && *format != "json") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	report, err := jobs.New(conf).Validate(ctx, flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "validation failed:", err)
+		return exitFailure
+	}
+	if *format == "json" {
+		err = report.PrintJSON(os.Stdout)
+	} else {
+		err = report.Print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error printing report:", err)
+		return exitFailure
+	}
+	if report.Failed() {
+		return exitFailure
+	}
+	return exitOK
+}
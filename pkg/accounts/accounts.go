@@ -0,0 +1,160 @@
+// Package accounts determines to which own account an imported file belongs.
+package accounts
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+const (
+	// preambleLines is the number of lines which are checked for an own
+	// IBAN before the CSV header of a file
+	preambleLines = 10
+	// preambleSize is the number of bytes the preamble is read from
+	preambleSize = 4096
+)
+
+// Resolver struct that holds the configured accounts
+type Resolver struct {
+	root      string // input_dir or the s3://bucket/prefix of the source
+	defaultID string
+	accounts  []models.Account
+	dirs      map[string]string // sub directory -> account id
+	ibans     map[string]string // normalized IBAN -> account id
+}
+
+// NewResolver returns a new Resolver for the accounts from the configuration
+func NewResolver(conf *config.Config) *Resolver {
+	root := conf.InputDir
+	if conf.Source == config.SourceS3 {
+		root = "s3://" + path.Join(conf.S3.Bucket, strings.Trim(conf.S3.Prefix, "/"))
+	}
+	r := &Resolver{
+		root:      root,
+		defaultID: conf.DefaultAccount,
+		accounts:  make([]models.Account, 0, len(conf.Accounts)),
+		dirs:      make(map[string]string),
+		ibans:     make(map[string]string),
+	}
+	for _, acc := range conf.Accounts {
+		r.accounts = append(r.accounts, models.Account{
+			ID:    acc.ID,
+			IBAN:  NormalizeIBAN(acc.IBAN),
+			Name:  acc.Name,
+			Bank:  acc.Bank,
+			Owner: acc.Owner,
+			Type:  acc.Type,
+		})
+		dir := acc.Dir
+		if dir == "" {
+			dir = acc.ID
+		}
+		r.dirs[dir] = acc.ID
+		if acc.IBAN != "" {
+			r.ibans[NormalizeIBAN(acc.IBAN)] = acc.ID
+		}
+	}
+	return r
+}
+
+// NormalizeIBAN removes spaces and converts the IBAN to upper case
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(iban), " ", ""))
+}
+
+// Accounts returns the configured accounts
+func (r *Resolver) Accounts() []models.Account {
+	return r.accounts
+}
+
+// Known checks whether the account is configured or the default account
+func (r *Resolver) Known(id string) bool {
+	return id == r.defaultID || slices.ContainsFunc(r.accounts, func(acc models.Account) bool {
+		return acc.ID == id
+	})
+}
+
+// ByIBAN returns the id of the own account with the given IBAN
+func (r *Resolver) ByIBAN(iban string) (string, bool) {
+	if iban == "" {
+		return "", false
+	}
+	id, ok := r.ibans[NormalizeIBAN(iban)]
+	return id, ok
+}
+
+// Resolve returns the account id of the file. The account is determined by
+// the directory layout under input_dir or the bucket prefix first, then by an
+// own IBAN in the file name, the archive entry name or the preamble of the
+// content, and falls back to the default account. Messages of the IMAP source
+// have no directory layout.
+func (r *Resolver) Resolve(file models.SHAFile, preamble []string) string {
+	if id, ok := r.byDir(file.Path); ok {
+		return id
+	}
+	for _, name := range []string{file.Path, file.Entry} {
+		if id, ok := r.findIBAN(path.Base(filepath.ToSlash(name))); ok {
+			return id
+		}
+	}
+	if id, ok := r.byContent(preamble); ok {
+		return id
+	}
+	return r.defaultID
+}
+
+// Preamble returns the first lines of the content for Resolve and a reader
+// which still yields the whole content
+func Preamble(content io.Reader) ([]string, io.Reader) {
+	reader := bufio.NewReaderSize(content, preambleSize)
+	// a shorter content is returned with an error
+	head, _ := reader.Peek(preambleSize)
+	lines := strings.SplitN(string(head), "\n", preambleLines+1)
+	return lines[:min(len(lines), preambleLines)], reader
+}
+
+// byDir matches the first directory of the path relative to the root
+func (r *Resolver) byDir(filePath string) (string, bool) {
+	rel, err := filepath.Rel(r.root, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 {
+		return "", false
+	}
+	id, ok := r.dirs[parts[0]]
+	return id, ok
+}
+
+// byContent looks for an own IBAN in the lines preceding the CSV header.
+// Rows aren't checked, they contain IBANs of the counterparties.
+func (r *Resolver) byContent(preamble []string) (string, bool) {
+	for _, line := range preamble {
+		if strings.Contains(line, "Buchungsdatum") {
+			return "", false
+		}
+		if id, ok := r.findIBAN(line); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// findIBAN checks whether s contains one of the own IBANs
+func (r *Resolver) findIBAN(s string) (string, bool) {
+	s = NormalizeIBAN(s)
+	for iban, id := range r.ibans {
+		if strings.Contains(s, iban) {
+			return id, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,114 @@
+package accounts
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	inputDir := t.TempDir()
+	conf := &config.Config{
+		InputDir:       inputDir,
+		DefaultAccount: "main",
+		Accounts: []config.AccountConfig{
+			{ID: "joint", IBAN: "DE12 3456 7890 1234 5678 90", Dir: "shared"},
+			{ID: "savings", IBAN: "DE99999999999999999999"},
+		},
+	}
+	resolver := NewResolver(conf)
+
+	tests := []struct {
+		name     string
+		file     models.SHAFile
+		content  string
+		expected string
+	}{
+		{
+			name:     "dir",
+			file:     models.SHAFile{Path: filepath.Join(inputDir, "shared/2025-01.csv")},
+			content:  "Buchungsdatum,Betrag\n",
+			expected: "joint",
+		},
+		{
+			name:     "id as dir",
+			file:     models.SHAFile{Path: filepath.Join(inputDir, "savings/2025-01.csv")},
+			content:  "Buchungsdatum,Betrag\n",
+			expected: "savings",
+		},
+		{
+			name:     "file name",
+			file:     models.SHAFile{Path: filepath.Join(inputDir, "DE99999999999999999999_export.csv")},
+			content:  "Buchungsdatum,Betrag\n",
+			expected: "savings",
+		},
+		{
+			name:     "archive entry name",
+			file:     models.SHAFile{Path: filepath.Join(inputDir, "exports.zip"), Entry: "2025/DE99999999999999999999.csv"},
+			content:  "Buchungsdatum,Betrag\n",
+			expected: "savings",
+		},
+		{
+			name:     "preamble",
+			file:     models.SHAFile{Path: filepath.Join(inputDir, "preamble.csv")},
+			content:  "Konto: DE12345678901234567890\r\nBuchungsdatum,Betrag\r\n",
+			expected: "joint",
+		},
+		{
+			name:     "imap preamble",
+			file:     models.SHAFile{Path: "imap://INBOX/7/export.csv"},
+			content:  "Konto: DE12345678901234567890\nBuchungsdatum,Betrag\n",
+			expected: "joint",
+		},
+		// IBANs of the rows belong to counterparties
+		{
+			name:     "rows",
+			file:     models.SHAFile{Path: filepath.Join(inputDir, "unknown.csv")},
+			content:  "Buchungsdatum,IBAN\n01.01.2025,DE99999999999999999999\n",
+			expected: "main",
+		},
+		{
+			name:     "outside of input dir",
+			file:     models.SHAFile{Path: "/tmp/shared/2025-01.csv"},
+			content:  "Buchungsdatum,Betrag\n",
+			expected: "main",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preamble, content := Preamble(strings.NewReader(tt.content))
+			assert.Equal(t, tt.expected, resolver.Resolve(tt.file, preamble))
+			// the whole content is still read
+			data, err := io.ReadAll(content)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.content, string(data))
+		})
+	}
+
+	id, ok := resolver.ByIBAN("de99 9999 9999 9999 9999 99")
+	assert.True(t, ok)
+	assert.Equal(t, "savings", id)
+	_, ok = resolver.ByIBAN("")
+	assert.False(t, ok)
+
+	assert.True(t, resolver.Known("main"))
+	assert.True(t, resolver.Known("joint"))
+	assert.False(t, resolver.Known("shared"))
+}
+
+func TestResolveS3(t *testing.T) {
+	resolver := NewResolver(&config.Config{
+		Source:         config.SourceS3,
+		S3:             config.S3Config{Bucket: "exports", Prefix: "/bank/"},
+		DefaultAccount: "main",
+		Accounts:       []config.AccountConfig{{ID: "joint", Dir: "shared"}},
+	})
+	assert.Equal(t, "joint", resolver.Resolve(models.SHAFile{Path: "s3://exports/bank/shared/2025-01.csv"}, nil))
+	assert.Equal(t, "main", resolver.Resolve(models.SHAFile{Path: "s3://exports/bank/2025-01.csv"}, nil))
+	assert.Equal(t, "main", resolver.Resolve(models.SHAFile{Path: "s3://other/bank/shared/2025-01.csv"}, nil))
+}
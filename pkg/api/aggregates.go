@@ -0,0 +1,83 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// Groupings of the aggregates
+const (
+	ByMonth     = models.GroupByMonth
+	ByCategory  = models.GroupByCategory
+	ByRecipient = models.GroupByRecipient
+)
+
+// Aggregate struct that holds the totals of a group of transactions
+type Aggregate struct {
+	Key      string  `json:"key"`
+	Count    int     `json:"count"`
+	Income   float64 `json:"income"`
+	Expenses float64 `json:"expenses"`
+	Total    float64 `json:"total"`
+}
+
+// aggregate returns the totals of the groups rounded to cents. Months are
+// ordered by time, the other groups by their expenses.
+func aggregate(groups []models.TransactionGroup, by string) []Aggregate {
+	aggregates := make([]Aggregate, 0, len(groups))
+	for _, group := range groups {
+		income, expenses := roundCents(group.Income), roundCents(group.Expenses)
+		aggregates = append(aggregates, Aggregate{
+			Key:      group.Key,
+			Count:    group.Count,
+			Income:   income,
+			Expenses: expenses,
+			Total:    roundCents(income - expenses),
+		})
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		if by != ByMonth && aggregates[i].Expenses != aggregates[j].Expenses {
+			return aggregates[i].Expenses > aggregates[j].Expenses
+		}
+		return aggregates[i].Key < aggregates[j].Key
+	})
+	return aggregates
+}
+
+// roundCents rounds the sum of float amounts to cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// handleAggregates returns the totals of the transactions matching the
+// filter of the query parameters, grouped by the path parameter
+func (a *API) handleAggregates(w http.ResponseWriter, r *http.Request) {
+	by := r.PathValue("by")
+	if !models.ValidGroup(by) {
+		writeError(w, http.StatusNotFound, "aggregates are grouped by "+strings.Join([]string{ByMonth, ByCategory, ByRecipient}, ", "))
+		return
+	}
+	filter, err := ParseFilter(r.URL.Query(), auth.UserFrom(r.Context()))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groups, err := a.store.AggregateTransactions(r.Context(), filter, by)
+	if err != nil {
+		a.logger.Error("Error getting transactions", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error getting transactions")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"by":         by,
+		"aggregates": aggregate(groups, by),
+	})
+}
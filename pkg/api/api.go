@@ -0,0 +1,99 @@
+// Package api provides the JSON HTTP API for querying the stored
+// transactions and their aggregates.
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// Prefix is the path under which the API is served
+const Prefix = "/api/v1/"
+
+//go:embed openapi.yaml
+var spec []byte
+
+// API struct that holds the store and the routes of the API
+type API struct {
+	logger  *zap.SugaredLogger
+	store   models.Store
+	auth    *auth.Authenticator
+	uploads *uploads
+	mux     *http.ServeMux
+}
+
+// New returns a new API reading from the store, the requests are
+// authenticated by the authenticator
+func New(store models.Store, authenticator *auth.Authenticator) *API {
+	a := &API{
+		logger: zap.S().With("package", "api"),
+		store:  store,
+		auth:   authenticator,
+		mux:    http.NewServeMux(),
+	}
+	a.mux.HandleFunc("GET "+Prefix+"transactions", a.require(models.RoleViewer, a.handleTransactions))
+	a.mux.HandleFunc("GET "+Prefix+"aggregates/{by}", a.require(models.RoleViewer, a.handleAggregates))
+	a.mux.HandleFunc("GET "+Prefix+"audit", a.require(models.RoleViewer, a.handleAudit))
+	a.mux.HandleFunc("GET "+Prefix+"users", a.require(models.RoleAdmin, a.handleUsers))
+	a.mux.HandleFunc("PUT "+Prefix+"users/{name}", a.require(models.RoleAdmin, a.handleSaveUser))
+	a.mux.HandleFunc("DELETE "+Prefix+"users/{name}", a.require(models.RoleAdmin, a.handleDeleteUser))
+	a.mux.HandleFunc("GET "+Prefix+"tokens", a.require(models.RoleAdmin, a.handleTokens))
+	a.mux.HandleFunc("POST "+Prefix+"tokens", a.require(models.RoleAdmin, a.handleCreateToken))
+	a.mux.HandleFunc("DELETE "+Prefix+"tokens/{id}", a.require(models.RoleAdmin, a.handleRevokeToken))
+	a.mux.HandleFunc("GET "+Prefix+"openapi.yaml", handleSpec)
+	return a
+}
+
+// Handler returns the routes of the API
+func (a *API) Handler() http.Handler {
+	return a.mux
+}
+
+// require rejects the requests of unauthenticated users and of users
+// without the role, the user is passed on in the request context
+func (a *API) require(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.auth.Authenticate(r)
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="c24-expense"`)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		case err != nil:
+			a.logger.Error("Error authenticating request", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "error authenticating request")
+			return
+		case !auth.Allows(user.Role, role):
+			writeError(w, http.StatusForbidden, "the "+role+" role is required")
+			return
+		}
+		next(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	}
+}
+
+// handleSpec returns the OpenAPI spec of the API
+func handleSpec(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(spec) // nolint:errcheck
+}
+
+// writeJSON writes the value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		zap.S().With("package", "api").Error("Error writing response", zap.Error(err))
+	}
+}
+
+// writeError writes the message as a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/audit"
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAPI returns the API of a local store with a few transactions and
+// the API tokens of its users
+func newTestAPI(t *testing.T) (http.Handler, map[string]string) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertTransactions(context.Background(), []models.Transaction{
+		{AccountID: "main", Date: "2025-03-01", Amount: 2500, Recipient: "ACME GmbH", Usage: "Salary March", Category: "Income"},
+		{AccountID: "main", Date: "2025-03-02", Amount: -54.20, Recipient: "Globus", Category: "Shopping", Subcategory: "Market", Tags: []string{"food"}},
+		{AccountID: "main", Date: "2025-03-02", Amount: -12.10, Recipient: "Globus", Category: "Shopping", Subcategory: "Market", Tags: []string{"food", "trip"}},
+		{AccountID: "joint", Date: "2025-04-03", Amount: -900, Recipient: "Landlord", Usage: "Rent April", Category: "Housing"},
+		{AccountID: "main", Date: "2025-04-04", Amount: -100, Recipient: "Pocket", Category: "Transfer", Internal: true},
+	}))
+	return New(store, auth.New(store, config.AuthConfig{SessionTTL: 1})).Handler(), newTestUsers(t, store)
+}
+
+// newTestUsers creates an admin, an editor and a viewer of the joint
+// account and returns their API tokens
+func newTestUsers(t *testing.T, store models.Store) map[string]string {
+	tokens := make(map[string]string)
+	for _, user := range []models.User{
+		{Name: "admin", Role: models.RoleAdmin, Accounts: []string{models.AllAccounts}},
+		{Name: "editor", Role: models.RoleEditor, Accounts: []string{models.AllAccounts}},
+		{Name: "partner", Role: models.RoleViewer, Accounts: []string{"joint"}},
+	} {
+		_, err := auth.SaveUser(context.Background(), store, user, "password")
+		assert.NoError(t, err)
+		tokens[user.Name], _, err = auth.CreateToken(context.Background(), store, user.Name, "test")
+		assert.NoError(t, err)
+	}
+	return tokens
+}
+
+// do sends the request with the token and decodes the response into
+// value, it returns the status code
+func do(t *testing.T, handler http.Handler, token string, r *http.Request, value any) int {
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if value != nil && rec.Code < http.StatusMultipleChoices {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), value))
+	}
+	return rec.Code
+}
+
+// get decodes the response of the request into value and returns its code
+func get(t *testing.T, handler http.Handler, token, target string, value any) int {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(rec, r)
+	if value != nil && rec.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), value))
+	}
+	return rec.Code
+}
+
+func TestTransactionsFilter(t *testing.T) {
+	handler, tokens := newTestAPI(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "all", query: "", want: []string{"Pocket", "Landlord", "Globus", "Globus", "ACME GmbH"}},
+		{name: "date range", query: "from=2025-03-02&to=2025-04-03", want: []string{"Landlord", "Globus", "Globus"}},
+		{name: "account", query: "account=joint", want: []string{"Landlord"}},
+		{name: "category", query: "category=shopping", want: []string{"Globus", "Globus"}},
+		{name: "recipient", query: "recipient=land", want: []string{"Landlord"}},
+		{name: "amount", query: "min_amount=-100&max_amount=0", want: []string{"Pocket", "Globus", "Globus"}},
+		{name: "tags", query: "tag=food&tag=trip", want: []string{"Globus"}},
+		{name: "text", query: "q=salary", want: []string{"ACME GmbH"}},
+		{name: "internal", query: "internal=false&account=main", want: []string{"Globus", "Globus", "ACME GmbH"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page Page
+			assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/transactions?"+tt.query, &page))
+			recipients := []string{}
+			for _, txn := range page.Transactions {
+				recipients = append(recipients, txn.Recipient)
+			}
+			assert.Equal(t, tt.want, recipients)
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+
+	for _, query := range []string{"from=March", "min_amount=abc", "internal=maybe", "limit=0", "cursor=abc"} {
+		assert.Equal(t, http.StatusBadRequest, get(t, handler, tokens["admin"], "/api/v1/transactions?"+query, nil), query)
+	}
+}
+
+func TestTransactionsPagination(t *testing.T) {
+	handler, tokens := newTestAPI(t)
+
+	var hashes []string
+	query := url.Values{"limit": []string{"2"}}
+	for pages := 0; ; pages++ {
+		assert.Less(t, pages, 3)
+		var page Page
+		assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/transactions?"+query.Encode(), &page))
+		for _, txn := range page.Transactions {
+			hashes = append(hashes, txn.Hash)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+
+	var all Page
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/transactions", &all))
+	assert.Len(t, hashes, 5)
+	for i, txn := range all.Transactions {
+		assert.Equal(t, txn.Hash, hashes[i])
+	}
+}
+
+func TestAggregates(t *testing.T) {
+	handler, tokens := newTestAPI(t)
+
+	var body struct {
+		By         string      `json:"by"`
+		Aggregates []Aggregate `json:"aggregates"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/aggregates/month", &body))
+	// the internal transfer is left out
+	assert.Equal(t, []Aggregate{
+		{Key: "2025-03", Count: 3, Income: 2500, Expenses: 66.3, Total: 2433.7},
+		{Key: "2025-04", Count: 1, Expenses: 900, Total: -900},
+	}, body.Aggregates)
+
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/aggregates/category?account=main", &body))
+	assert.Equal(t, "category", body.By)
+	assert.Equal(t, []string{"Shopping", "Income"}, []string{body.Aggregates[0].Key, body.Aggregates[1].Key})
+
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/aggregates/recipient?tag=food", &body))
+	assert.Equal(t, []Aggregate{{Key: "Globus", Count: 2, Expenses: 66.3, Total: -66.3}}, body.Aggregates)
+
+	assert.Equal(t, http.StatusNotFound, get(t, handler, tokens["admin"], "/api/v1/aggregates/year", nil))
+}
+
+// scanlessStore struct that holds a store which refuses to load all
+// transactions
+type scanlessStore struct {
+	models.Store
+}
+
+func (scanlessStore) GetTransactions(context.Context) ([]models.Transaction, error) {
+	return nil, errors.New("the whole table is loaded")
+}
+
+func TestTransactionsQueriedInStore(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertTransactions(context.Background(), []models.Transaction{
+		{AccountID: "main", Date: "2025-03-02", Amount: -54.20, Recipient: "Globus", Category: "Shopping"},
+	}))
+	handler := New(scanlessStore{store}, auth.New(store, config.AuthConfig{SessionTTL: 1})).Handler()
+	tokens := newTestUsers(t, store)
+
+	var page Page
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/transactions?recipient=GLOBUS", &page))
+	assert.Len(t, page.Transactions, 1)
+	var body struct {
+		Aggregates []Aggregate `json:"aggregates"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/aggregates/category", &body))
+	assert.Equal(t, []Aggregate{{Key: "Shopping", Count: 1, Expenses: 54.2, Total: -54.2}}, body.Aggregates)
+}
+
+func TestSpec(t *testing.T) {
+	handler, _ := newTestAPI(t)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.yaml", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/transactions:")
+	assert.Contains(t, rec.Body.String(), "/aggregates/{by}:")
+}
+
+func TestAuthorization(t *testing.T) {
+	handler, tokens := newTestAPI(t)
+
+	assert.Equal(t, http.StatusUnauthorized, get(t, handler, "", "/api/v1/transactions", nil))
+	assert.Equal(t, http.StatusUnauthorized, get(t, handler, "c24_wrong", "/api/v1/transactions", nil))
+	assert.Equal(t, http.StatusForbidden, get(t, handler, tokens["editor"], "/api/v1/users", nil))
+
+	// the partner sees only the joint account
+	var page Page
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["partner"], "/api/v1/transactions?account=main", &page))
+	assert.Empty(t, page.Transactions)
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["partner"], "/api/v1/transactions", &page))
+	assert.Len(t, page.Transactions, 1)
+	assert.Equal(t, "Landlord", page.Transactions[0].Recipient)
+
+	var body struct {
+		Aggregates []Aggregate `json:"aggregates"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["partner"], "/api/v1/aggregates/month", &body))
+	assert.Equal(t, []Aggregate{{Key: "2025-04", Count: 1, Expenses: 900, Total: -900}}, body.Aggregates)
+}
+
+func TestAudit(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	handler := New(store, auth.New(store, config.AuthConfig{SessionTTL: 1})).Handler()
+	tokens := newTestUsers(t, store)
+
+	ui := audit.Actor{User: "editor", Source: models.AuditSourceUI}
+	private := models.Transaction{AccountID: "main", Date: "2025-03-02", Amount: -54.20, Recipient: "Globus", Category: "Other"}
+	joint := models.Transaction{AccountID: "joint", Date: "2025-04-03", Amount: -900, Recipient: "Landlord", Category: "Other"}
+	assert.NoError(t, audit.Record(context.Background(), store, ui, audit.OverrideChange(private, "Shopping", "")))
+	assert.NoError(t, audit.Record(context.Background(), store, ui, audit.OverrideChange(joint, "Housing", "")))
+	assert.NoError(t, audit.Record(context.Background(), store, ui, audit.RuleChange(&models.Rule{ID: "rule-1"}, nil)))
+
+	var body struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["admin"], "/api/v1/audit", &body))
+	assert.Len(t, body.Entries, 3)
+	assert.Equal(t, "null", string(body.Entries[0].After))
+	assert.JSONEq(t, `{"category":"Housing","subcategory":""}`, string(body.Entries[1].After))
+
+	// the partner doesn't see the changes of the main account
+	assert.Equal(t, http.StatusOK, get(t, handler, tokens["partner"], "/api/v1/audit?entity=override", &body))
+	assert.Len(t, body.Entries, 1)
+	assert.Equal(t, joint.Hash(), body.Entries[0].EntityID)
+
+	for _, query := range []string{"entity=split", "source=cron", "from=March", "limit=0"} {
+		assert.Equal(t, http.StatusBadRequest, get(t, handler, tokens["admin"], "/api/v1/audit?"+query, nil), query)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	handler, tokens := newTestAPI(t)
+	admin := tokens["admin"]
+
+	put := func(name, body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/users/"+name, strings.NewReader(body))
+		return do(t, handler, admin, r, nil)
+	}
+	assert.Equal(t, http.StatusOK, put("kid", `{"role":"viewer","accounts":["pocket"],"password":"long enough"}`))
+	assert.Equal(t, http.StatusBadRequest, put("short", `{"role":"viewer","password":"short"}`))
+	assert.Equal(t, http.StatusBadRequest, put("nobody", `{"role":"owner","password":"long enough"}`))
+	assert.Equal(t, http.StatusBadRequest, put("admin", `{"role":"editor"}`))
+
+	var users struct {
+		Users []User `json:"users"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, handler, admin, "/api/v1/users", &users))
+	assert.Len(t, users.Users, 4)
+
+	var token Token
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", strings.NewReader(`{"user":"kid","name":"script"}`))
+	assert.Equal(t, http.StatusCreated, do(t, handler, admin, r, &token))
+	assert.Equal(t, http.StatusOK, get(t, handler, token.Token, "/api/v1/transactions", nil))
+
+	// deleting the user revokes its tokens
+	r = httptest.NewRequest(http.MethodDelete, "/api/v1/users/kid", nil)
+	assert.Equal(t, http.StatusNoContent, do(t, handler, admin, r, nil))
+	assert.Equal(t, http.StatusUnauthorized, get(t, handler, token.Token, "/api/v1/transactions", nil))
+	r = httptest.NewRequest(http.MethodDelete, "/api/v1/users/admin", nil)
+	assert.Equal(t, http.StatusBadRequest, do(t, handler, admin, r, nil))
+
+	r = httptest.NewRequest(http.MethodDelete, "/api/v1/tokens/unknown", nil)
+	assert.Equal(t, http.StatusNotFound, do(t, handler, admin, r, nil))
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/audit"
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+const defaultAuditLimit = 100
+
+// AuditEntry struct that holds a change made by hand as returned by the API,
+// Before and After are null for created and deleted values
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	ChangedAt time.Time       `json:"changed_at"`
+	User      string          `json:"user"`
+	Source    string          `json:"source"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	AccountID string          `json:"account_id,omitempty"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+}
+
+// newAuditEntry returns the API representation of the audit log entry
+func newAuditEntry(entry models.AuditEntry) AuditEntry {
+	value := func(data string) json.RawMessage {
+		if data == "" {
+			return json.RawMessage("null")
+		}
+		return json.RawMessage(data)
+	}
+	return AuditEntry{
+		ID:        entry.ID,
+		ChangedAt: entry.ChangedAt,
+		User:      entry.User,
+		Source:    entry.Source,
+		Entity:    entry.Entity,
+		EntityID:  entry.EntityID,
+		AccountID: entry.AccountID,
+		Before:    value(entry.Before),
+		After:     value(entry.After),
+	}
+}
+
+// handleAudit returns the latest entries of the audit log matching the
+// query parameters, changes of hidden accounts are left out
+func (a *API) handleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Entity:   query.Get("entity"),
+		EntityID: query.Get("entity_id"),
+		User:     query.Get("user"),
+		Source:   query.Get("source"),
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+		Visible:  auth.UserFrom(r.Context()).CanSee,
+	}
+	limit := defaultAuditLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		limit = parsed
+	}
+	entries, err := audit.Query(r.Context(), a.store, filter, limit)
+	if errors.Is(err, audit.ErrInvalidFilter) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Error getting audit log", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error getting audit log")
+		return
+	}
+	result := make([]AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, newAuditEntry(entry))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": result})
+}
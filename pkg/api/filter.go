@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// Filter struct that holds the conditions a transaction has to match, the
+// store applies it
+type Filter = models.TransactionFilter
+
+// ParseFilter returns the filter of the query parameters, limited to the
+// accounts the user may see
+func ParseFilter(query url.Values, user *models.User) (Filter, error) {
+	filter := Filter{
+		Accounts:    query["account"],
+		Category:    query.Get("category"),
+		Subcategory: query.Get("subcategory"),
+		Recipient:   query.Get("recipient"),
+		Tags:        query["tag"],
+		Text:        query.Get("q"),
+		Viewer:      user,
+	}
+	for name, date := range map[string]*string{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return Filter{}, fmt.Errorf("%s must be a date like 2025-03-01", name)
+		}
+		*date = value
+	}
+	for name, amount := range map[string]**float64{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return Filter{}, fmt.Errorf("%s must be a number", name)
+		}
+		*amount = &parsed
+	}
+	if value := query.Get("internal"); value != "" {
+		internal, err := strconv.ParseBool(value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("internal must be true or false")
+		}
+		filter.Internal = &internal
+	}
+	return filter, nil
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/jobs"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// Upload statuses
+const (
+	UploadRunning = "running"
+	UploadDone    = "done"
+	UploadFailed  = "failed" // the import couldn't run at all
+)
+
+// finished uploads are kept for polling for uploadTTL
+const uploadTTL = time.Hour
+
+// maxAccountLength is the longest account field read from an upload
+const maxAccountLength = 256
+
+// Importer runs the import of the uploaded files
+type Importer interface {
+	Import(ctx context.Context, paths []string, dryRun bool) (*jobs.ImportReport, error)
+}
+
+// Upload struct that holds the state of an upload and its import report
+type Upload struct {
+	ID         string        `json:"id"`
+	User       string        `json:"user"` // who uploaded the files
+	Account    string        `json:"account,omitempty"`
+	Status     string        `json:"status"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Report     *ImportReport `json:"report,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// ImportReport struct that holds the result of the import of the uploaded
+// files
+type ImportReport struct {
+	Failed     bool         `json:"failed"`
+	Files      []ImportFile `json:"files"`
+	Duplicates []string     `json:"duplicates"`
+}
+
+// ImportFile struct that holds the result of the import of a single file
+type ImportFile struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	RowsTotal    int    `json:"rows_total"`
+	RowsInserted int    `json:"rows_inserted"`
+	Error        string `json:"error,omitempty"`
+}
+
+// newImportReport returns the report of the import with the names of the
+// files relative to the upload directory
+func newImportReport(report *jobs.ImportReport, dir string) *ImportReport {
+	name := func(path string) string {
+		return strings.TrimPrefix(path, dir+string(filepath.Separator))
+	}
+	result := &ImportReport{Failed: report.Failed(), Files: []ImportFile{}, Duplicates: []string{}}
+	for _, imp := range report.Imports {
+		result.Files = append(result.Files, ImportFile{
+			Name:         name(imp.Path),
+			Status:       imp.Status,
+			RowsTotal:    imp.RowsTotal,
+			RowsInserted: imp.RowsInserted,
+			Error:        imp.Error,
+		})
+	}
+	for _, path := range report.Duplicates {
+		result.Duplicates = append(result.Duplicates, name(path))
+	}
+	return result
+}
+
+// uploads struct that holds the importer and the state of the uploads
+type uploads struct {
+	ctx      context.Context
+	importer Importer
+	config   config.UploadsConfig
+
+	mu      sync.Mutex
+	uploads map[string]*Upload
+}
+
+// WithImporter enables the upload of bank exports by editors, which are
+// imported by the importer. Imports running in the background are stopped
+// when ctx is cancelled.
+func (a *API) WithImporter(ctx context.Context, importer Importer, conf config.UploadsConfig) *API {
+	a.uploads = &uploads{
+		ctx:      ctx,
+		importer: importer,
+		config:   conf,
+		uploads:  make(map[string]*Upload),
+	}
+	a.mux.HandleFunc("POST "+Prefix+"imports", a.require(models.RoleEditor, a.handleUpload))
+	a.mux.HandleFunc("GET "+Prefix+"imports/{id}", a.require(models.RoleEditor, a.handleGetUpload))
+	return a
+}
+
+// handleUpload saves the files of the multipart request and imports them.
+// The files belong to the account of the account field, which is resolved
+// by the import without it. The report is returned when the import is
+// finished, with async=true the upload is returned immediately and can be
+// polled by the uploader.
+func (a *API) handleUpload(w http.ResponseWriter, r *http.Request) {
+	async, _ := strconv.ParseBool(r.URL.Query().Get("async"))
+	user := auth.UserFrom(r.Context())
+	upload := &Upload{
+		ID:        "upload-" + rand.Text(),
+		User:      user.Name,
+		Status:    UploadRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	dir := filepath.Join(a.uploads.config.Dir, upload.ID)
+	r.Body = http.MaxBytesReader(w, r.Body, int64(a.uploads.config.MaxSize)<<20)
+	paths, account, err := saveFiles(r, dir)
+	if err != nil {
+		os.RemoveAll(dir) // nolint:errcheck
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("uploads are limited to %d MiB", a.uploads.config.MaxSize))
+			return
+		}
+		var saveErr *saveError
+		if errors.As(err, &saveErr) {
+			a.logger.Error("Error saving upload", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "error saving the uploaded files")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if account != "" && !user.CanSee(account) {
+		os.RemoveAll(dir) // nolint:errcheck
+		writeError(w, http.StatusForbidden, fmt.Sprintf("account %q isn't visible to the user", account))
+		return
+	}
+	upload.Account = account
+
+	// the files of accounts the user can't see aren't stored
+	importContext := func(ctx context.Context) context.Context {
+		return jobs.WithUpload(jobs.WithAccountCheck(ctx, user.CanSee), account)
+	}
+	a.uploads.add(upload)
+	if async {
+		go a.runImport(importContext(a.uploads.ctx), upload, dir, paths) // nolint:errcheck
+		w.Header().Set("Location", Prefix+"imports/"+upload.ID)
+		writeJSON(w, http.StatusAccepted, a.uploads.get(upload.ID))
+		return
+	}
+	err = a.runImport(importContext(r.Context()), upload, dir, paths)
+	result := a.uploads.get(upload.ID)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, result)
+	case errors.Is(err, jobs.ErrUnknownAccount):
+		writeJSON(w, http.StatusBadRequest, result)
+	case errors.Is(err, jobs.ErrLocked):
+		writeJSON(w, http.StatusConflict, result)
+	default:
+		writeJSON(w, http.StatusInternalServerError, result)
+	}
+}
+
+// handleGetUpload returns the state of an upload, only to the uploader and
+// the admins
+func (a *API) handleGetUpload(w http.ResponseWriter, r *http.Request) {
+	upload := a.uploads.get(r.PathValue("id"))
+	if user := auth.UserFrom(r.Context()); upload != nil && upload.User != user.Name && user.Role != models.RoleAdmin {
+		upload = nil
+	}
+	if upload == nil {
+		writeError(w, http.StatusNotFound, "upload not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, upload)
+}
+
+// runImport imports the uploaded files, records the result in the upload
+// and removes the files
+func (a *API) runImport(ctx context.Context, upload *Upload, dir string, paths []string) error {
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			a.logger.Error("Error removing uploaded files", zap.Error(err))
+		}
+	}()
+
+	report, err := a.uploads.importer.Import(ctx, paths, false)
+	a.uploads.finish(upload.ID, func(upload *Upload) {
+		if report != nil {
+			upload.Report = newImportReport(report, dir)
+		}
+		upload.Status = UploadDone
+		if err != nil {
+			a.logger.Error("Error importing upload ", upload.ID, zap.Error(err))
+			upload.Status = UploadFailed
+			upload.Error = err.Error()
+		}
+	})
+	return err
+}
+
+// saveError struct that holds an error of writing the upload directory,
+// which isn't caused by the request
+type saveError struct {
+	err error
+}
+
+func (e *saveError) Error() string { return e.err.Error() }
+
+func (e *saveError) Unwrap() error { return e.err }
+
+// fileWriter marks the errors of writing an uploaded file as saveError, the
+// errors of reading the request are passed on as they are
+type fileWriter struct {
+	file *os.File
+}
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	if err != nil {
+		err = &saveError{err: err}
+	}
+	return n, err
+}
+
+// saveFiles writes the files of the multipart request to the directory and
+// returns their paths and the account field. Errors of the server are
+// returned as saveError.
+func saveFiles(r *http.Request, dir string) ([]string, string, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", errors.New("expected a multipart/form-data request")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, "", &saveError{err: fmt.Errorf("error creating upload directory: %w", err)}
+	}
+
+	var (
+		paths   []string
+		account string
+	)
+	seen := make(map[string]bool)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FileName() == "" {
+			if part.FormName() == "account" {
+				value, err := io.ReadAll(io.LimitReader(part, maxAccountLength))
+				if err != nil {
+					return nil, "", err
+				}
+				account = strings.TrimSpace(string(value))
+			}
+			continue
+		}
+		name := filepath.Base(part.FileName())
+		if name == "." || name == string(filepath.Separator) || seen[name] {
+			return nil, "", fmt.Errorf("invalid or repeated file name %q", part.FileName())
+		}
+		seen[name] = true
+
+		path := filepath.Join(dir, name)
+		if err := saveFile(path, part); err != nil {
+			return nil, "", err
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil, "", errors.New("no files uploaded")
+	}
+	return paths, account, nil
+}
+
+// saveFile writes the content of the reader to the path
+func saveFile(path string, r io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return &saveError{err: err}
+	}
+	if _, err := io.Copy(fileWriter{file: file}, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return &saveError{err: err}
+	}
+	return nil
+}
+
+// add records a new upload and forgets the uploads which finished more
+// than uploadTTL ago
+func (u *uploads) add(upload *Upload) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for id, old := range u.uploads {
+		if old.FinishedAt != nil && time.Since(*old.FinishedAt) > uploadTTL {
+			delete(u.uploads, id)
+		}
+	}
+	u.uploads[upload.ID] = upload
+}
+
+// finish updates the upload and marks it as finished
+func (u *uploads) finish(id string, update func(*Upload)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	upload := u.uploads[id]
+	update(upload)
+	finished := time.Now().UTC()
+	upload.FinishedAt = &finished
+}
+
+// get returns a copy of the upload or nil if it's unknown
+func (u *uploads) get(id string) *Upload {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	upload, ok := u.uploads[id]
+	if !ok {
+		return nil
+	}
+	result := *upload
+	return &result
+}
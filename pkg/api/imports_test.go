@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/jobs"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// newUploadAPI returns the API importing into a local store and the API
+// tokens of its users, joint-editor is an editor of the joint account
+func newUploadAPI(t *testing.T) (http.Handler, config.UploadsConfig, map[string]string) {
+	conf := &config.Config{}
+	conf.Defaults()
+	conf.Storage = config.StorageLocal
+	conf.LocalStore.Path = filepath.Join(t.TempDir(), "store.json")
+	conf.Lock.Dir = t.TempDir()
+	conf.Uploads.Dir = t.TempDir()
+	conf.DefaultAccount = "main"
+	conf.Accounts = []config.AccountConfig{{ID: "joint", IBAN: "DE02 1203 0000 0000 2020 51"}}
+
+	store, err := localstore.New(conf.LocalStore.Path)
+	assert.NoError(t, err)
+	job := jobs.New(conf).WithStore(store)
+	handler := New(store, auth.New(store, conf.Auth)).WithImporter(context.Background(), job, conf.Uploads).Handler()
+	tokens := newTestUsers(t, store)
+	jointEditor := models.User{Name: "joint-editor", Role: models.RoleEditor, Accounts: []string{"joint"}}
+	_, err = auth.SaveUser(context.Background(), store, jointEditor, "password")
+	assert.NoError(t, err)
+	tokens[jointEditor.Name], _, err = auth.CreateToken(context.Background(), store, jointEditor.Name, "test")
+	assert.NoError(t, err)
+	return handler, conf.Uploads, tokens
+}
+
+// uploadRequest returns a multipart request with the files
+func uploadRequest(t *testing.T, target, token string, files map[string][]byte) *http.Request {
+	return uploadFormRequest(t, target, token, nil, files)
+}
+
+// uploadFormRequest returns a multipart request with the fields and files
+func uploadFormRequest(t *testing.T, target, token string, fields map[string]string, files map[string][]byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		assert.NoError(t, writer.WriteField(name, value))
+	}
+	for name, content := range files {
+		part, err := writer.CreateFormFile("file", name)
+		assert.NoError(t, err)
+		_, err = part.Write(content)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+
+	r := httptest.NewRequest(http.MethodPost, target, &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestUpload(t *testing.T) {
+	handler, conf, tokens := newUploadAPI(t)
+	mock, err := os.ReadFile("../../testdata/transaction.csv.mock")
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", tokens["editor"], map[string][]byte{"march.csv": mock}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var upload Upload
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	assert.Equal(t, UploadDone, upload.Status)
+	assert.False(t, upload.Report.Failed)
+	assert.Len(t, upload.Report.Files, 1)
+	assert.Equal(t, "march.csv", upload.Report.Files[0].Name)
+	assert.Equal(t, 55, upload.Report.Files[0].RowsInserted)
+	// the uploaded files are removed after the import
+	entries, err := os.ReadDir(conf.Dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// the same export is recognised as duplicate
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", tokens["editor"], map[string][]byte{"copy.csv": mock}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	assert.Empty(t, upload.Report.Files)
+	assert.Equal(t, []string{"copy.csv"}, upload.Report.Duplicates)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", tokens["editor"], nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUploadAsync(t *testing.T) {
+	handler, _, tokens := newUploadAPI(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports?async=true", tokens["editor"], map[string][]byte{"broken.csv": nil}))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var upload Upload
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	assert.Equal(t, "/api/v1/imports/"+upload.ID, rec.Header().Get("Location"))
+
+	assert.Eventually(t, func() bool {
+		r := httptest.NewRequest(http.MethodGet, rec.Header().Get("Location"), nil)
+		r.Header.Set("Authorization", "Bearer "+tokens["editor"])
+		poll := httptest.NewRecorder()
+		handler.ServeHTTP(poll, r)
+		assert.Equal(t, http.StatusOK, poll.Code)
+		assert.NoError(t, json.Unmarshal(poll.Body.Bytes(), &upload))
+		return upload.Status != UploadRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, UploadDone, upload.Status)
+	assert.True(t, upload.Report.Failed)
+	assert.Equal(t, "editor", upload.User)
+
+	// the upload is visible to the uploader and the admins only
+	for name, code := range map[string]int{"admin": http.StatusOK, "joint-editor": http.StatusNotFound} {
+		r := httptest.NewRequest(http.MethodGet, rec.Header().Get("Location"), nil)
+		r.Header.Set("Authorization", "Bearer "+tokens[name])
+		poll := httptest.NewRecorder()
+		handler.ServeHTTP(poll, r)
+		assert.Equal(t, code, poll.Code, name)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/imports/unknown", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens["editor"])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUploadUnauthorized(t *testing.T) {
+	handler, _, tokens := newUploadAPI(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", "wrong", map[string][]byte{"march.csv": nil}))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// viewers can't import
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", tokens["partner"], map[string][]byte{"march.csv": nil}))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestUploadAccounts(t *testing.T) {
+	handler, _, tokens := newUploadAPI(t)
+	mock, err := os.ReadFile("../../testdata/transaction.csv.mock")
+	assert.NoError(t, err)
+
+	// the export of the default account isn't stored for an editor of joint
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", tokens["joint-editor"], map[string][]byte{"march.csv": mock}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var upload Upload
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	assert.True(t, upload.Report.Failed)
+	assert.Len(t, upload.Report.Files, 1)
+	assert.Equal(t, models.ImportStatusFailed, upload.Report.Files[0].Status)
+	assert.Equal(t, 0, upload.Report.Files[0].RowsInserted)
+	assert.Contains(t, upload.Report.Files[0].Error, `"main"`)
+
+	// the rejected export wasn't recorded and can be imported by an editor
+	// of all accounts
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", tokens["editor"], map[string][]byte{"march.csv": mock}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	assert.False(t, upload.Report.Failed)
+	assert.Equal(t, 55, upload.Report.Files[0].RowsInserted)
+
+	// the export named by the IBAN of joint is stored
+	rec = httptest.NewRecorder()
+	joint := append(mock, '\n')
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", tokens["joint-editor"], map[string][]byte{"DE02120300000000202051.csv": joint}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	assert.False(t, upload.Report.Failed)
+	assert.Equal(t, 55, upload.Report.Files[0].RowsInserted)
+}
+
+func TestUploadToAccount(t *testing.T) {
+	handler, _, tokens := newUploadAPI(t)
+	mock, err := os.ReadFile("../../testdata/transaction.csv.mock")
+	assert.NoError(t, err)
+
+	// the account of the form is checked before the import
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadFormRequest(t, "/api/v1/imports", tokens["joint-editor"],
+		map[string]string{"account": "main"}, map[string][]byte{"march.csv": mock}))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadFormRequest(t, "/api/v1/imports", tokens["editor"],
+		map[string]string{"account": "unknown"}, map[string][]byte{"march.csv": mock}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// the export without an IBAN is stored under the account of the form
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadFormRequest(t, "/api/v1/imports", tokens["joint-editor"],
+		map[string]string{"account": "joint"}, map[string][]byte{"march.csv": mock}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var upload Upload
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	assert.Equal(t, "joint", upload.Account)
+	assert.False(t, upload.Report.Failed)
+	assert.Equal(t, 55, upload.Report.Files[0].RowsInserted)
+}
+
+func TestUploadServerError(t *testing.T) {
+	handler, conf, tokens := newUploadAPI(t)
+	// the upload directory can't be created below a file
+	assert.NoError(t, os.RemoveAll(conf.Dir))
+	assert.NoError(t, os.WriteFile(conf.Dir, nil, 0o644))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/v1/imports", tokens["editor"], map[string][]byte{"march.csv": nil}))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+)
+
+// Transaction struct that holds a stored transaction as returned by the API
+type Transaction struct {
+	Hash        string   `json:"hash"`
+	AccountID   string   `json:"account_id"`
+	Type        string   `json:"type"`
+	Date        string   `json:"date"`
+	Amount      float64  `json:"amount"`
+	Recipient   string   `json:"recipient"`
+	IBAN        string   `json:"iban"`
+	BIC         string   `json:"bic"`
+	Usage       string   `json:"usage"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Subcategory string   `json:"subcategory"`
+	Internal    bool     `json:"internal"`
+	Tags        []string `json:"tags"`
+}
+
+// newTransaction returns the API representation of the transaction
+func newTransaction(txn models.Transaction) Transaction {
+	tags := txn.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return Transaction{
+		Hash:        txn.Hash(),
+		AccountID:   txn.AccountID,
+		Type:        txn.TransactionType,
+		Date:        txn.Date,
+		Amount:      txn.Amount,
+		Recipient:   txn.Recipient,
+		IBAN:        txn.IBAN,
+		BIC:         txn.BIC,
+		Usage:       txn.Usage,
+		Description: txn.Description,
+		Category:    txn.Category,
+		Subcategory: txn.Subcategory,
+		Internal:    txn.Internal,
+		Tags:        tags,
+	}
+}
+
+// Page struct that holds a page of transactions and the cursor of the next
+// one, which is empty on the last page
+type Page struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
+
+// encodeCursor returns the opaque form of the cursor
+func encodeCursor(c models.Cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Date + "|" + c.Hash))
+}
+
+// decodeCursor returns the cursor of its opaque form
+func decodeCursor(value string) (models.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return models.Cursor{}, err
+	}
+	date, hash, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return models.Cursor{}, errors.New("malformed cursor")
+	}
+	return models.Cursor{Date: date, Hash: hash}, nil
+}
+
+// ErrInvalidCursor is returned for a cursor which wasn't returned by a page
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Paginate returns the page of the transactions matching the filter after
+// the cursor, the first page for an empty cursor. The transactions are
+// ordered newest first, transactions of the same day by their hash, so the
+// pages stay stable while new days are imported.
+func Paginate(ctx context.Context, store models.Store, filter Filter, cursorValue string, limit int) (Page, error) {
+	var after *models.Cursor
+	if cursorValue != "" {
+		parsed, err := decodeCursor(cursorValue)
+		if err != nil {
+			return Page{}, ErrInvalidCursor
+		}
+		after = &parsed
+	}
+
+	// one more than the page tells whether there is a next one
+	txns, err := store.QueryTransactions(ctx, filter, after, limit+1)
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Transactions: make([]Transaction, 0, min(len(txns), limit))}
+	for _, txn := range txns[:min(len(txns), limit)] {
+		page.Transactions = append(page.Transactions, newTransaction(txn))
+	}
+	if len(txns) > limit {
+		last := page.Transactions[limit-1]
+		page.NextCursor = encodeCursor(models.Cursor{Date: last.Date, Hash: last.Hash})
+	}
+	return page, nil
+}
+
+// handleTransactions returns a page of the transactions matching the
+// filter of the query parameters
+func (a *API) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := ParseFilter(query, auth.UserFrom(r.Context()))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := defaultPageLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		limit = parsed
+	}
+	page, err := Paginate(r.Context(), a.store, filter, query.Get("cursor"), limit)
+	if errors.Is(err, ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Error getting transactions", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error getting transactions")
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
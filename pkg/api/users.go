@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// User struct that holds a user as returned by the API
+type User struct {
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	Accounts  []string  `json:"accounts"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// newUser returns the API representation of the user without its password
+func newUser(user models.User) User {
+	accounts := user.Accounts
+	if accounts == nil {
+		accounts = []string{}
+	}
+	return User{Name: user.Name, Role: user.Role, Accounts: accounts, CreatedAt: user.CreatedAt}
+}
+
+// Token struct that holds an API token as returned by the API, the token
+// itself is only returned on creation
+type Token struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Token     string    `json:"token,omitempty"`
+}
+
+// newToken returns the API representation of the token
+func newToken(token models.APIToken) Token {
+	return Token{ID: token.ID, User: token.User, Name: token.Name, CreatedAt: token.CreatedAt}
+}
+
+// handleUsers returns all users
+func (a *API) handleUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := a.store.GetUsers(r.Context())
+	if err != nil {
+		a.logger.Error("Error getting users", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error getting users")
+		return
+	}
+	result := make([]User, 0, len(users))
+	for _, user := range users {
+		result = append(result, newUser(user))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"users": result})
+}
+
+// handleSaveUser creates or updates the user of the path, an empty
+// password keeps the password of an existing user
+func (a *API) handleSaveUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Role     string   `json:"role"`
+		Accounts []string `json:"accounts"`
+		Password string   `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	user := models.User{Name: r.PathValue("name"), Role: body.Role, Accounts: body.Accounts}
+	if current := auth.UserFrom(r.Context()); current.Name == user.Name && user.Role != models.RoleAdmin {
+		writeError(w, http.StatusBadRequest, "admins can't remove their own admin role")
+		return
+	}
+	user, err := auth.SaveUser(r.Context(), a.store, user, body.Password)
+	if errors.Is(err, auth.ErrInvalidUser) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Error saving user", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error saving user")
+		return
+	}
+	writeJSON(w, http.StatusOK, newUser(user))
+}
+
+// handleDeleteUser removes the user of the path and its tokens
+func (a *API) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if auth.UserFrom(r.Context()).Name == name {
+		writeError(w, http.StatusBadRequest, "admins can't delete themselves")
+		return
+	}
+	err := auth.DeleteUser(r.Context(), a.store, name)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Error deleting user", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error deleting user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTokens returns all API tokens without the tokens themselves
+func (a *API) handleTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := a.store.GetAPITokens(r.Context())
+	if err != nil {
+		a.logger.Error("Error getting tokens", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error getting tokens")
+		return
+	}
+	result := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, newToken(token))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tokens": result})
+}
+
+// handleCreateToken creates an API token of a user and returns it once
+func (a *API) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		User string `json:"user"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	plain, token, err := auth.CreateToken(r.Context(), a.store, body.User, body.Name)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Error creating token", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error creating token")
+		return
+	}
+	result := newToken(token)
+	result.Token = plain
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// handleRevokeToken removes the API token of the path
+func (a *API) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	err := auth.RevokeToken(r.Context(), a.store, r.PathValue("id"))
+	if errors.Is(err, auth.ErrTokenNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Error revoking token", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error revoking token")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,189 @@
+// Package audit records the changes made by hand to the categories, tags and
+// rules in the append-only audit log of the store and queries it.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// ErrInvalidFilter is returned by Filter.Validate
+var ErrInvalidFilter = errors.New("invalid filter")
+
+var (
+	entities = []string{models.AuditOverride, models.AuditTags, models.AuditRule}
+	sources  = []string{models.AuditSourceCLI, models.AuditSourceAPI, models.AuditSourceUI}
+)
+
+// Actor struct that holds who made a change and through which interface
+type Actor struct {
+	User   string
+	Source string
+}
+
+// Change struct that holds a change of an entity. Before and After are
+// stored as JSON, nil for created or deleted values.
+type Change struct {
+	Entity    string
+	EntityID  string
+	AccountID string
+	Before    any
+	After     any
+}
+
+// category struct that holds a category as recorded in the audit log
+type category struct {
+	Category    string `json:"category"`
+	Subcategory string `json:"subcategory"`
+}
+
+// rule struct that holds a rule as recorded in the audit log
+type rule struct {
+	Pattern     string `json:"pattern"`
+	Category    string `json:"category"`
+	Subcategory string `json:"subcategory"`
+	Priority    int    `json:"priority"`
+}
+
+// OverrideChange returns the change of the category of the transaction
+func OverrideChange(txn models.Transaction, newCategory, newSubcategory string) Change {
+	return Change{
+		Entity:    models.AuditOverride,
+		EntityID:  txn.Hash(),
+		AccountID: txn.AccountID,
+		Before:    category{Category: txn.Category, Subcategory: txn.Subcategory},
+		After:     category{Category: newCategory, Subcategory: newSubcategory},
+	}
+}
+
+// TagsChange returns the change of the tags of the transaction
+func TagsChange(txn models.Transaction, tags []string) Change {
+	change := Change{Entity: models.AuditTags, EntityID: txn.Hash(), AccountID: txn.AccountID}
+	// an empty list instead of null, null marks created and deleted values
+	change.Before, change.After = append([]string{}, txn.Tags...), append([]string{}, tags...)
+	return change
+}
+
+// RuleChange returns the change of a rule, before is nil for a created rule
+// and after for a deleted one
+func RuleChange(before, after *models.Rule) Change {
+	change := Change{Entity: models.AuditRule}
+	if before != nil {
+		change.EntityID = before.ID
+		change.Before = rule{before.Pattern, before.Category, before.Subcategory, before.Priority}
+	}
+	if after != nil {
+		change.EntityID = after.ID
+		change.After = rule{after.Pattern, after.Category, after.Subcategory, after.Priority}
+	}
+	return change
+}
+
+// Record appends the change made by the actor to the audit log. It is
+// called before the change is written, so no change is left unrecorded
+// when writing the entry fails.
+func Record(ctx context.Context, store models.Store, actor Actor, change Change) error {
+	before, err := marshal(change.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshal(change.After)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	return store.InsertAuditEntry(ctx, models.AuditEntry{
+		ID:        "audit-" + rand.Text(),
+		ChangedAt: now,
+		User:      actor.User,
+		Source:    actor.Source,
+		Entity:    change.Entity,
+		EntityID:  change.EntityID,
+		AccountID: change.AccountID,
+		Before:    before,
+		After:     after,
+	})
+}
+
+// marshal returns the JSON of the value, an empty string for nil
+func marshal(value any) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// Filter struct that holds the conditions of an audit log query, empty
+// fields match every entry
+type Filter struct {
+	Entity   string
+	EntityID string
+	User     string
+	Source   string
+	From     string                      // first day, 2006-01-02
+	To       string                      // last day, 2006-01-02
+	Visible  func(accountID string) bool // accounts of the user, nil for all
+}
+
+// Validate checks the values of the filter
+func (f Filter) Validate() error {
+	if f.Entity != "" && !slices.Contains(entities, f.Entity) {
+		return fmt.Errorf("%w: entity must be one of %v", ErrInvalidFilter, entities)
+	}
+	if f.Source != "" && !slices.Contains(sources, f.Source) {
+		return fmt.Errorf("%w: source must be one of %v", ErrInvalidFilter, sources)
+	}
+	for _, date := range []string{f.From, f.To} {
+		if _, err := time.Parse(time.DateOnly, date); date != "" && err != nil {
+			return fmt.Errorf("%w: dates must look like 2006-01-02", ErrInvalidFilter)
+		}
+	}
+	return nil
+}
+
+// Match checks whether the entry matches all conditions. Changes of
+// transactions of hidden accounts never match.
+func (f Filter) Match(entry models.AuditEntry) bool {
+	day := entry.ChangedAt.UTC().Format(time.DateOnly)
+	switch {
+	case f.Entity != "" && entry.Entity != f.Entity,
+		f.EntityID != "" && entry.EntityID != f.EntityID,
+		f.User != "" && entry.User != f.User,
+		f.Source != "" && entry.Source != f.Source,
+		f.From != "" && day < f.From,
+		f.To != "" && day > f.To,
+		f.Visible != nil && entry.AccountID != "" && !f.Visible(entry.AccountID):
+		return false
+	}
+	return true
+}
+
+// Query returns up to limit entries of the audit log matching the filter,
+// newest first
+func Query(ctx context.Context, store models.Store, filter Filter, limit int) ([]models.AuditEntry, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	entries, err := store.GetAuditEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matched := []models.AuditEntry{}
+	for _, entry := range entries {
+		if len(matched) == limit {
+			break
+		}
+		if filter.Match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched, nil
+}
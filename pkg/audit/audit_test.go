@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndQuery(t *testing.T) {
+	ctx := context.Background()
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+
+	txn := models.Transaction{AccountID: "joint", Date: "2025-03-01", Amount: -20, Recipient: "Cinema", Category: "Other"}
+	rule := models.Rule{ID: "rule-1", Pattern: "cinema", Category: "Leisure"}
+	ui := Actor{User: "editor", Source: models.AuditSourceUI}
+	assert.NoError(t, Record(ctx, store, ui, OverrideChange(txn, "Leisure", "Cinema")))
+	assert.NoError(t, Record(ctx, store, ui, TagsChange(txn, []string{"date"})))
+	assert.NoError(t, Record(ctx, store, Actor{User: "me", Source: models.AuditSourceCLI}, RuleChange(nil, &rule)))
+
+	entries, err := Query(ctx, store, Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.NotEqual(t, entries[0].ID, entries[1].ID)
+	// newest first
+	assert.Equal(t, models.AuditRule, entries[0].Entity)
+	assert.Equal(t, "rule-1", entries[0].EntityID)
+	assert.Empty(t, entries[0].Before)
+	assert.JSONEq(t, `{"pattern":"cinema","category":"Leisure","subcategory":"","priority":0}`, entries[0].After)
+	assert.JSONEq(t, `[]`, entries[1].Before)
+	assert.JSONEq(t, `["date"]`, entries[1].After)
+	assert.Equal(t, txn.Hash(), entries[2].EntityID)
+	assert.Equal(t, "joint", entries[2].AccountID)
+	assert.JSONEq(t, `{"category":"Other","subcategory":""}`, entries[2].Before)
+	assert.JSONEq(t, `{"category":"Leisure","subcategory":"Cinema"}`, entries[2].After)
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	tests := []struct {
+		name   string
+		filter Filter
+		limit  int
+		want   int
+	}{
+		{name: "limit", limit: 2, want: 2},
+		{name: "entity", filter: Filter{Entity: models.AuditOverride}, want: 1},
+		{name: "entity id", filter: Filter{EntityID: txn.Hash()}, want: 2},
+		{name: "user", filter: Filter{User: "me"}, want: 1},
+		{name: "source", filter: Filter{Source: models.AuditSourceUI}, want: 2},
+		{name: "today", filter: Filter{From: today, To: today}, want: 3},
+		{name: "before", filter: Filter{To: "2025-01-01"}, want: 0},
+		// the changes of rules are visible to everyone
+		{name: "hidden account", filter: Filter{Visible: models.User{Accounts: []string{"main"}}.CanSee}, want: 1},
+		{name: "no accounts", filter: Filter{Visible: models.User{}.CanSee}, want: 1},
+		{name: "all accounts", filter: Filter{Visible: models.User{Accounts: []string{models.AllAccounts}}.CanSee}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.limit == 0 {
+				tt.limit = 10
+			}
+			entries, err := Query(ctx, store, tt.filter, tt.limit)
+			assert.NoError(t, err)
+			assert.Len(t, entries, tt.want)
+		})
+	}
+
+	for _, filter := range []Filter{{Entity: "split"}, {Source: "cron"}, {From: "March"}} {
+		_, err := Query(ctx, store, filter, 10)
+		assert.ErrorIs(t, err, ErrInvalidFilter)
+	}
+}
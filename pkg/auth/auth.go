@@ -0,0 +1,199 @@
+// Package auth provides the local users, the API tokens and the sessions
+// of the HTTP API and the web UI.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// SessionCookie is the name of the cookie holding the session of the UI
+const SessionCookie = "c24_session"
+
+var (
+	// ErrUnauthenticated is returned for requests without valid credentials
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrInvalidCredentials is returned by Login for a wrong name or password
+	ErrInvalidCredentials = errors.New("invalid user name or password")
+)
+
+// roleRanks orders the roles, a role can do everything of the lower ones
+var roleRanks = map[string]int{
+	models.RoleViewer: 1,
+	models.RoleEditor: 2,
+	models.RoleAdmin:  3,
+}
+
+// ValidRole checks whether the role exists
+func ValidRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// Allows checks whether the role includes the required role
+func Allows(role, required string) bool {
+	return ValidRole(required) && roleRanks[role] >= roleRanks[required]
+}
+
+type contextKey struct{}
+
+// WithUser returns the context of a request of the user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFrom returns the user of the request context or nil
+func UserFrom(ctx context.Context) *models.User {
+	user, _ := ctx.Value(contextKey{}).(*models.User)
+	return user
+}
+
+// session struct that holds the user of a session and its expiry
+type session struct {
+	user    string
+	expires time.Time
+}
+
+// Authenticator struct that holds the store of the users and tokens and the
+// sessions of the UI. The sessions are kept in memory, so a restart logs
+// out the users of the UI while the API tokens keep working.
+type Authenticator struct {
+	logger *zap.SugaredLogger
+	store  models.Store
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+// New returns a new Authenticator of the users and tokens in the store
+func New(store models.Store, conf config.AuthConfig) *Authenticator {
+	return &Authenticator{
+		logger:   zap.S().With("package", "auth"),
+		store:    store,
+		ttl:      time.Duration(conf.SessionTTL) * time.Hour,
+		sessions: make(map[string]session),
+	}
+}
+
+// dummyHash is compared for unknown users, so a login takes as long for
+// them as for existing users
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("c24-expense"), bcrypt.DefaultCost)
+
+// Login checks the password of the user and starts a session. It returns
+// the id of the session and its expiry.
+func (a *Authenticator) Login(ctx context.Context, name, password string) (string, time.Time, error) {
+	user, err := a.user(ctx, name)
+	if err != nil && !errors.Is(err, ErrUnauthenticated) {
+		return "", time.Time{}, err
+	}
+	hash := dummyHash
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || user == nil {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	id, err := randomString(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(a.ttl)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, s := range a.sessions {
+		if time.Now().After(s.expires) {
+			delete(a.sessions, id)
+		}
+	}
+	a.sessions[id] = session{user: user.Name, expires: expires}
+	return id, expires, nil
+}
+
+// Logout ends the session
+func (a *Authenticator) Logout(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, id)
+}
+
+// Authenticate returns the user of the API token in the Authorization
+// header or of the session cookie. The user is read on every request, so
+// changed roles and deleted users take effect at once.
+func (a *Authenticator) Authenticate(r *http.Request) (*models.User, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.tokenUser(r.Context(), token)
+	}
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	a.mu.Lock()
+	s, ok := a.sessions[cookie.Value]
+	a.mu.Unlock()
+	if !ok || time.Now().After(s.expires) {
+		return nil, ErrUnauthenticated
+	}
+	return a.user(r.Context(), s.user)
+}
+
+// tokenUser returns the user of the API token
+func (a *Authenticator) tokenUser(ctx context.Context, token string) (*models.User, error) {
+	tokens, err := a.store.GetAPITokens(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := []byte(HashToken(token))
+	for _, stored := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(stored.Hash)) == 1 {
+			return a.user(ctx, stored.User)
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+// user returns the stored user with the name
+func (a *Authenticator) user(ctx context.Context, name string) (*models.User, error) {
+	users, err := a.store.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Name == name {
+			return &user, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+// HashToken returns the SHA256 of the API token which is stored instead
+// of the token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes encoded for URLs
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestStore returns a local store with a viewer of the joint account
+func newTestStore(t *testing.T) models.Store {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	user := models.User{Name: "partner", Role: models.RoleViewer, Accounts: []string{"joint", "joint"}}
+	_, err = SaveUser(context.Background(), store, user, "password")
+	assert.NoError(t, err)
+	return store
+}
+
+func TestSaveUser(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	for _, user := range []models.User{
+		{Name: "", Role: models.RoleViewer},
+		{Name: "a b", Role: models.RoleViewer},
+		{Name: "kid", Role: "owner"},
+	} {
+		_, err := SaveUser(ctx, store, user, "password")
+		assert.ErrorIs(t, err, ErrInvalidUser, user.Name)
+	}
+	_, err := SaveUser(ctx, store, models.User{Name: "kid", Role: models.RoleViewer}, "short")
+	assert.ErrorIs(t, err, ErrInvalidUser)
+	_, err = SaveUser(ctx, store, models.User{Name: "kid", Role: models.RoleViewer}, "")
+	assert.ErrorIs(t, err, ErrInvalidUser)
+
+	// an empty password keeps the old one
+	before, err := store.GetUsers(ctx)
+	assert.NoError(t, err)
+	user, err := SaveUser(ctx, store, models.User{Name: "partner", Role: models.RoleEditor, Accounts: []string{"joint"}}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, before[0].PasswordHash, user.PasswordHash)
+	assert.Equal(t, before[0].CreatedAt, user.CreatedAt)
+	assert.Equal(t, []string{"joint"}, before[0].Accounts)
+	assert.True(t, user.CanSee("joint"))
+	assert.False(t, user.CanSee("main"))
+
+	// a user without accounts sees none, * stands for all of them
+	user, err = SaveUser(ctx, store, models.User{Name: "kid", Role: models.RoleViewer}, "password")
+	assert.NoError(t, err)
+	assert.False(t, user.CanSee("joint"))
+	user, err = SaveUser(ctx, store, models.User{Name: "kid", Role: models.RoleViewer, Accounts: []string{"joint", models.AllAccounts}}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.AllAccounts}, user.Accounts)
+	assert.True(t, user.CanSee("joint"))
+	assert.True(t, user.CanSee("main"))
+}
+
+func TestLogin(t *testing.T) {
+	store := newTestStore(t)
+	a := New(store, config.AuthConfig{SessionTTL: 1})
+
+	_, _, err := a.Login(context.Background(), "partner", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, _, err = a.Login(context.Background(), "nobody", "password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	id, _, err := a.Login(context.Background(), "partner", "password")
+	assert.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: id})
+	user, err := a.Authenticate(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "partner", user.Name)
+
+	a.Logout(id)
+	_, err = a.Authenticate(r)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	a := New(store, config.AuthConfig{SessionTTL: 1})
+
+	_, _, err := CreateToken(ctx, store, "nobody", "script")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	plain, token, err := CreateToken(ctx, store, "partner", "script")
+	assert.NoError(t, err)
+	assert.NotContains(t, token.Hash, plain)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+plain)
+	user, err := a.Authenticate(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "partner", user.Name)
+
+	assert.NoError(t, RevokeToken(ctx, store, token.ID))
+	assert.ErrorIs(t, RevokeToken(ctx, store, token.ID), ErrTokenNotFound)
+	_, err = a.Authenticate(r)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+func TestAllows(t *testing.T) {
+	assert.True(t, Allows(models.RoleAdmin, models.RoleEditor))
+	assert.True(t, Allows(models.RoleEditor, models.RoleEditor))
+	assert.False(t, Allows(models.RoleViewer, models.RoleEditor))
+	assert.False(t, Allows("", models.RoleViewer))
+	assert.False(t, Allows(models.RoleAdmin, "owner"))
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// tokenPrefix marks the API tokens, so they are easy to find in scripts
+const tokenPrefix = "c24_"
+
+// MinPasswordLength is the length of the shortest accepted password
+const MinPasswordLength = 8
+
+var (
+	// ErrUserNotFound is returned for an unknown user name
+	ErrUserNotFound = errors.New("user not found")
+	// ErrTokenNotFound is returned for an unknown token id
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrInvalidUser is returned by SaveUser for an invalid name, role or password
+	ErrInvalidUser = errors.New("invalid user")
+)
+
+// HashPassword returns the bcrypt hash of the password
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("%w: password must have at least %d characters", ErrInvalidUser, MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// SaveUser creates the user or updates the role and the accounts of an
+// existing one and returns the stored user. The password is required for
+// new users, an empty password keeps the password of an existing user.
+func SaveUser(ctx context.Context, store models.Store, user models.User, password string) (models.User, error) {
+	if user.Name == "" || strings.ContainsAny(user.Name, " \t\n/") {
+		return models.User{}, fmt.Errorf("%w: name %q", ErrInvalidUser, user.Name)
+	}
+	if !ValidRole(user.Role) {
+		return models.User{}, fmt.Errorf("%w: role must be %s, %s or %s", ErrInvalidUser, models.RoleViewer, models.RoleEditor, models.RoleAdmin)
+	}
+	existing, err := findUser(ctx, store, user.Name)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return models.User{}, err
+	}
+
+	switch {
+	case password != "":
+		if user.PasswordHash, err = HashPassword(password); err != nil {
+			return models.User{}, err
+		}
+	case existing != nil:
+		user.PasswordHash = existing.PasswordHash
+	default:
+		return models.User{}, fmt.Errorf("%w: password is required for a new user", ErrInvalidUser)
+	}
+	user.CreatedAt = time.Now().UTC()
+	if existing != nil {
+		user.CreatedAt = existing.CreatedAt
+	}
+	slices.Sort(user.Accounts)
+	user.Accounts = slices.Compact(user.Accounts)
+	if slices.Contains(user.Accounts, models.AllAccounts) {
+		user.Accounts = []string{models.AllAccounts}
+	}
+	return user, store.UpsertUser(ctx, user)
+}
+
+// DeleteUser removes the user and its API tokens
+func DeleteUser(ctx context.Context, store models.Store, name string) error {
+	if _, err := findUser(ctx, store, name); err != nil {
+		return err
+	}
+	tokens, err := store.GetAPITokens(ctx)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.User != name {
+			continue
+		}
+		if err := store.DeleteAPIToken(ctx, token.ID); err != nil {
+			return err
+		}
+	}
+	return store.DeleteUser(ctx, name)
+}
+
+// CreateToken creates a new API token of the user. The token is returned
+// only once, the store keeps its hash.
+func CreateToken(ctx context.Context, store models.Store, userName, name string) (string, models.APIToken, error) {
+	if _, err := findUser(ctx, store, userName); err != nil {
+		return "", models.APIToken{}, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", models.APIToken{}, err
+	}
+	id, err := randomString(6)
+	if err != nil {
+		return "", models.APIToken{}, err
+	}
+	plain := tokenPrefix + secret
+	token := models.APIToken{
+		ID:        id,
+		User:      userName,
+		Name:      name,
+		Hash:      HashToken(plain),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := store.InsertAPIToken(ctx, token); err != nil {
+		return "", models.APIToken{}, err
+	}
+	return plain, token, nil
+}
+
+// RevokeToken removes the API token with the id
+func RevokeToken(ctx context.Context, store models.Store, id string) error {
+	tokens, err := store.GetAPITokens(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(tokens, func(token models.APIToken) bool { return token.ID == id }) {
+		return ErrTokenNotFound
+	}
+	return store.DeleteAPIToken(ctx, id)
+}
+
+// findUser returns the stored user with the name
+func findUser(ctx context.Context, store models.Store, name string) (*models.User, error) {
+	users, err := store.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Name == name {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
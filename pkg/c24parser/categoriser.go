@@ -7,6 +7,10 @@ import (
 	"strings"
 )
 
+// FallbackCategory is the category of the transactions which couldn't be
+// categorised by the recipient
+const FallbackCategory = "Other"
+
 // translateCategory translates the German category to English and converts to snake_case
 func translateCategory(germanCategory, recipient string) string {
 	// TODO: Improve parsing of categories
@@ -120,7 +124,7 @@ func advancedCategoriser(recipient string) string {
 	if strings.Contains(recipient, "KLIVER") {
 		return "Groceries"
 	}
-	return "Other"
+	return FallbackCategory
 }
 
 // translateSubcategory translates the German subcategory to English and converts to snake_case
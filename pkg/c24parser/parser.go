@@ -1,8 +1,11 @@
 package c24parser
 
 import (
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -11,11 +14,58 @@ import (
 	"github.com/13excite/c24-expense/pkg/models"
 )
 
-// Parser struct that holds the transactions and the CSV file
+// columns holds the positions of the known columns of the C24 CSV export
+type columns struct {
+	transactionType int
+	date            int
+	amount          int
+	recipient       int
+	iban            int
+	bic             int
+	usage           int
+	description     int
+	category        int
+	subcategory     int
+}
+
+// defaultColumns are the column positions of the C24 export which are used
+// when the header doesn't contain a known column name
+var defaultColumns = columns{
+	transactionType: 0,
+	date:            1,
+	amount:          3,
+	recipient:       4,
+	iban:            5,
+	bic:             6,
+	usage:           7,
+	description:     8,
+	category:        11,
+	subcategory:     12,
+}
+
+// SkippedRow struct that holds a row which couldn't be parsed
+type SkippedRow struct {
+	Line   int    `json:"line"`
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+}
+
+// Kinds of the skipped rows
+const (
+	SkipMalformedRow  = "malformed_row"
+	SkipInvalidAmount = "invalid_amount"
+	SkipInvalidDate   = "invalid_date"
+)
+
+// Parser struct that holds the transactions and the CSV reader
 type Parser struct {
 	transactions []models.Transaction
-	file         *os.File
-	csvReader    *csv.Reader
+	// occurrences counts the rows by their hash, identical rows are
+	// numbered so they aren't deduplicated into one
+	occurrences map[string]int
+	skipped     []SkippedRow
+	csvReader   *csv.Reader
+	columns     columns
 }
 
 // NewParser returns a new Parser struct
@@ -23,76 +73,141 @@ func NewParser() *Parser {
 	return &Parser{
 		// Initialize the slice with length 0
 		transactions: make([]models.Transaction, 0),
+		occurrences:  make(map[string]int),
+		columns:      defaultColumns,
 	}
 }
 
-// readCSV reads the CSV file and initializes the csv.Reader
-func (p *Parser) readCSV(filename string) error {
-	// Open the CSV file
-	var err error
-	p.file, err = os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
-	}
-	// Read CSV content
-	p.csvReader = csv.NewReader(p.file)
+// readCSV initializes the csv.Reader for the CSV content
+func (p *Parser) readCSV(r io.Reader) {
+	p.csvReader = csv.NewReader(r)
 	p.csvReader.Comma = ','
 	p.csvReader.FieldsPerRecord = -1 // Allow variable number of fields
-	return nil
 }
 
 // ParseFile parses the CSV file and stores the transactions in the Parser struct
-func (p *Parser) ParseFile(filename string) error {
+func (p *Parser) ParseFile(ctx context.Context, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
 	// Close the file when the function returns
-	defer p.file.Close()
+	defer file.Close()
 
-	if err := p.readCSV(filename); err != nil {
-		return err
-	}
-	_, err := p.csvReader.Read()
+	return p.Parse(ctx, file)
+}
+
+// Parse parses the CSV content of the reader and stores the transactions
+// in the Parser struct. It stops with the cause of ctx when ctx is cancelled.
+func (p *Parser) Parse(ctx context.Context, r io.Reader) error {
+	p.readCSV(r)
+	header, err := p.csvReader.Read()
 	if err != nil {
 		return fmt.Errorf("error reading header: %v", err)
 	}
+	p.columns = resolveColumns(header)
 	for {
+		if ctx.Err() != nil {
+			return fmt.Errorf("parsing stopped at line %d: %w", p.line(), context.Cause(ctx))
+		}
 		row, err := p.csvReader.Read()
 		if err != nil {
-			if err.Error() == "EOF" {
+			if errors.Is(err, io.EOF) {
 				break
 			}
-			fmt.Printf("Error reading row: %v\n", err)
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return fmt.Errorf("error reading row: %w", err)
+			}
+			p.skip(parseErr.Line, SkipMalformedRow, fmt.Errorf("error reading row: %w", err))
 			continue
 		}
-		amount, err := p.parseAmount(row[3])
+		amount, err := p.parseAmount(field(row, p.columns.amount))
 		if err != nil {
-			fmt.Printf("Error parsing amount: %v\n", err)
+			p.skip(p.line(), SkipInvalidAmount, fmt.Errorf("error parsing amount: %w", err))
 			continue
 		}
 		// Parse date
-		date, err := p.parseDate(row[1])
+		date, err := p.parseDate(field(row, p.columns.date))
 		if err != nil {
-			fmt.Printf("Error parsing date: %v\n", err)
+			p.skip(p.line(), SkipInvalidDate, fmt.Errorf("error parsing date: %w", err))
 			continue
 		}
+		transactionType := field(row, p.columns.transactionType)
 		var recipient string
-		if row[0] == "SEPA-Überweisung" {
-			recipient = strings.Split(row[4], ",")[0]
+		if transactionType == "SEPA-Überweisung" {
+			recipient = strings.Split(field(row, p.columns.recipient), ",")[0]
 		} else {
-			recipient = row[4]
+			recipient = field(row, p.columns.recipient)
 		}
 
-		p.transactions = append(p.transactions, models.Transaction{
-			TransactionType: p.translateTransactionType(row[0]),
+		txn := models.Transaction{
+			TransactionType: p.translateTransactionType(transactionType),
 			Date:            date,
 			Amount:          amount,
 			Recipient:       recipient,
-			Usage:           row[7],
-			Category:        translateCategory(row[11], recipient),
-			Subcategory:     translateSubcategory(row[12], recipient),
-		})
+			IBAN:            strings.ReplaceAll(field(row, p.columns.iban), " ", ""),
+			BIC:             field(row, p.columns.bic),
+			Usage:           strings.TrimSpace(field(row, p.columns.usage)),
+			Description:     field(row, p.columns.description),
+			Category:        translateCategory(field(row, p.columns.category), recipient),
+			Subcategory:     translateSubcategory(field(row, p.columns.subcategory), recipient),
+		}
+		// the account is the same for all rows of the export
+		hash := txn.Hash()
+		txn.Occurrence = p.occurrences[hash]
+		p.occurrences[hash]++
+		p.transactions = append(p.transactions, txn)
 	}
 	return nil
 }
 
+// skip records the row at the line as skipped
+func (p *Parser) skip(line int, kind string, err error) {
+	p.skipped = append(p.skipped, SkippedRow{Line: line, Kind: kind, Reason: err.Error()})
+}
+
+// line returns the line of the last read row
+func (p *Parser) line() int {
+	line, _ := p.csvReader.FieldPos(0)
+	return line
+}
+
+// resolveColumns finds the positions of the known columns by their names in
+// the header. Columns which are missing in the header keep the default position.
+func resolveColumns(header []string) columns {
+	cols := defaultColumns
+	byName := map[string]*int{
+		"transaktionstyp":   &cols.transactionType,
+		"buchungsdatum":     &cols.date,
+		"betrag":            &cols.amount,
+		"zahlungsempfänger": &cols.recipient,
+		"iban":              &cols.iban,
+		"bic":               &cols.bic,
+		"verwendungszweck":  &cols.usage,
+		"beschreibung":      &cols.description,
+		"kategorie":         &cols.category,
+		"unterkategorie":    &cols.subcategory,
+	}
+	for i, name := range header {
+		// the C24 export starts with a UTF-8 BOM
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if pos, ok := byName[name]; ok {
+			*pos = i
+		}
+	}
+	return cols
+}
+
+// field returns the value of the column at pos or an empty string
+// if the row is shorter
+func field(row []string, pos int) string {
+	if pos < 0 || pos >= len(row) {
+		return ""
+	}
+	return row[pos]
+}
+
 // parseDate parses the date string to the format "YYYY-MM-DD"
 func (p *Parser) parseDate(dateStr string) (string, error) {
 	parsedDate, err := time.Parse("02.01.2006", dateStr)
@@ -107,6 +222,11 @@ func (p *Parser) GetTransactions() []models.Transaction {
 	return p.transactions
 }
 
+// GetSkippedRows returns the rows which couldn't be parsed
+func (p *Parser) GetSkippedRows() []SkippedRow {
+	return p.skipped
+}
+
 // translateTransactionType translates the German transaction type to English
 func (p *Parser) translateTransactionType(germanType string) string {
 	switch germanType {
@@ -1,6 +1,9 @@
 package c24parser
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -77,3 +80,92 @@ func TestParseDate(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveColumns(t *testing.T) {
+	// header of the mock export has a different layout than the default one
+	header := []string{"\ufeffTransaktionstyp", "Buchungsdatum", "Betrag", "Zahlungsempfänger",
+		"IBAN", "BIC", "Verwendungszweck", "Beschreibung", "Kategorie", "Unterkategorie"}
+	cols := resolveColumns(header)
+	assert.Equal(t, columns{
+		transactionType: 0, date: 1, amount: 2, recipient: 3, iban: 4,
+		bic: 5, usage: 6, description: 7, category: 8, subcategory: 9,
+	}, cols)
+
+	// unknown headers keep the default positions
+	assert.Equal(t, defaultColumns, resolveColumns([]string{"foo", "bar"}))
+}
+
+func TestParseFile(t *testing.T) {
+	parser := NewParser()
+	err := parser.ParseFile(context.Background(), "../../testdata/transaction.csv.mock")
+	assert.NoError(t, err)
+
+	txns := parser.GetTransactions()
+	assert.Len(t, txns, 55)
+
+	rent := txns[9]
+	assert.Equal(t, "Transfer", rent.TransactionType)
+	assert.Equal(t, "2025-03-26", rent.Date)
+	assert.Equal(t, -500.0, rent.Amount)
+	assert.Equal(t, "Otto Mustermann", rent.Recipient)
+	assert.Equal(t, "DE12340123460567666666", rent.IBAN)
+	assert.Equal(t, "PAAAAAAFFFF", rent.BIC)
+	assert.Equal(t, "Monatsmiete 04/25", rent.Usage)
+	assert.Equal(t, "Rent", rent.Subcategory)
+
+	globus := txns[2]
+	assert.Equal(t, "Globus Markthalle", globus.Description)
+	assert.Equal(t, "Groceries", globus.Category)
+
+	err = parser.ParseFile(context.Background(), "wrong/path")
+	assert.Error(t, err)
+}
+
+func TestParseSkippedRows(t *testing.T) {
+	content := "Transaktionstyp,Buchungsdatum,Betrag,Zahlungsempfänger\n" +
+		"Kartenzahlung,01.03.2025,\"-9,99\",SuperCafe\n" +
+		"Kartenzahlung,2025-03-02,\"-5,00\",SuperCafe\n" +
+		"Kartenzahlung,03.03.2025,n/a,SuperCafe\n" +
+		"Kartenzahlung,04.03.2025,\"-1\"0,SuperCafe\n"
+	parser := NewParser()
+	assert.NoError(t, parser.Parse(context.Background(), strings.NewReader(content)))
+
+	assert.Len(t, parser.GetTransactions(), 1)
+	skipped := parser.GetSkippedRows()
+	assert.Len(t, skipped, 3)
+	assert.Equal(t, []int{3, 4, 5}, []int{skipped[0].Line, skipped[1].Line, skipped[2].Line})
+	assert.Contains(t, skipped[0].Reason, "error parsing date")
+	assert.Equal(t, []string{SkipInvalidDate, SkipInvalidAmount, SkipMalformedRow}, []string{skipped[0].Kind, skipped[1].Kind, skipped[2].Kind})
+	assert.Contains(t, skipped[1].Reason, "error parsing amount")
+	assert.Contains(t, skipped[2].Reason, "error reading row")
+}
+
+func TestParseOccurrences(t *testing.T) {
+	content := "Transaktionstyp,Buchungsdatum,Betrag,Zahlungsempfänger\n" +
+		"Kartenzahlung,01.03.2025,\"-3,50\",SuperCafe\n" +
+		"Kartenzahlung,01.03.2025,\"-3,50\",SuperCafe\n" +
+		"Kartenzahlung,01.03.2025,\"-9,99\",SuperCafe\n" +
+		"Kartenzahlung,01.03.2025,\"-3,50\",SuperCafe\n"
+	parser := NewParser()
+	assert.NoError(t, parser.Parse(context.Background(), strings.NewReader(content)))
+
+	txns := parser.GetTransactions()
+	assert.Len(t, txns, 4)
+	assert.Equal(t, []int{0, 1, 0, 2}, []int{txns[0].Occurrence, txns[1].Occurrence, txns[2].Occurrence, txns[3].Occurrence})
+	// identical rows get different hashes
+	assert.NotEqual(t, txns[0].Hash(), txns[1].Hash())
+	assert.NotEqual(t, txns[1].Hash(), txns[3].Hash())
+}
+
+func TestParseCancelled(t *testing.T) {
+	content := "Transaktionstyp,Buchungsdatum,Betrag,Zahlungsempfänger\n" +
+		"Kartenzahlung,01.03.2025,\"-9,99\",SuperCafe\n"
+	stopErr := errors.New("shutdown")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(stopErr)
+
+	parser := NewParser()
+	err := parser.Parse(ctx, strings.NewReader(content))
+	assert.ErrorIs(t, err, stopErr)
+	assert.Empty(t, parser.GetTransactions())
+}
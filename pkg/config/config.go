@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
 	"gopkg.in/yaml.v2"
 )
@@ -12,11 +13,140 @@ import (
 // Config is the main config of the service
 type Config struct {
 	InputDir    string           `yaml:"input_dir"`
+	Source      string           `yaml:"source"` // local, s3 or imap
+	S3          S3Config         `yaml:"s3"`
+	IMAP        IMAPConfig       `yaml:"imap"`
+	Lifecycle   LifecycleConfig  `yaml:"lifecycle"`
+	Pipeline    PipelineConfig   `yaml:"pipeline"`
+	Jobs        []JobConfig      `yaml:"jobs"`
+	Reports     ReportsConfig    `yaml:"reports"`
+	Retention   RetentionConfig  `yaml:"retention"`
+	Retry       RetryConfig      `yaml:"retry"`
+	Lock        LockConfig       `yaml:"lock"`
+	Uploads     UploadsConfig    `yaml:"uploads"`
+	Auth        AuthConfig       `yaml:"auth"`
 	RunEvery    int              `yaml:"run_every"`    // in minutes
-	MetricsPort int              `yaml:"metrics_port"` // for prometheus in future
+	Watch       bool             `yaml:"watch"`        // import new files immediately
+	WatchSettle int              `yaml:"watch_settle"` // in seconds
+	HTTPPort    int              `yaml:"http_port"`    // status endpoints, 0 disables
+	MetricsPort int              `yaml:"metrics_port"` // prometheus metrics, 0 disables
 	LogLevel    string           `yaml:"log_level"`
 	LogEncoding string           `yaml:"log_encoding"`
+	Storage     string           `yaml:"storage"` // clickhouse, postgres or local
 	Clickhouse  ClickhouseConfig `yaml:"clickhouse"`
+	Postgres    PostgresConfig   `yaml:"postgres"`
+	LocalStore  LocalStoreConfig `yaml:"local_store"`
+	Accounts    []AccountConfig  `yaml:"accounts"`
+	// account id of the files which can't be matched to any account
+	DefaultAccount string `yaml:"default_account"`
+	// max days between both sides of a transfer between own accounts
+	InternalTransferWindow int `yaml:"internal_transfer_window"`
+}
+
+// AccountConfig contains the description of an own bank account or pocket
+type AccountConfig struct {
+	ID    string `yaml:"id"`
+	IBAN  string `yaml:"iban"`
+	Name  string `yaml:"name"`
+	Bank  string `yaml:"bank"`
+	Owner string `yaml:"owner"`
+	Type  string `yaml:"type"` // checking, pocket, savings, credit_card
+	// Dir is the sub directory of input_dir containing exports of the account,
+	// the account id is used if it's empty
+	Dir string `yaml:"dir"`
+}
+
+// JobConfig contains the schedule of a named background job
+type JobConfig struct {
+	Name string `yaml:"name"` // import, recategorise, report or retention
+	// Schedule is a cron expression such as "0 6 * * *" or "@every 1h",
+	// the job runs every run_every minutes if it's empty
+	Schedule   string `yaml:"schedule"`
+	RunOnStart bool   `yaml:"run_on_start"`
+	Jitter     int    `yaml:"jitter"` // max random delay of a run in seconds
+}
+
+// ReportsConfig contains the settings of the report job
+type ReportsConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// RetentionConfig contains the settings of the retention job
+type RetentionConfig struct {
+	Days int `yaml:"days"` // processed and quarantined files are kept for
+}
+
+// RetryConfig contains the backoff of the storage operations and the
+// circuit breaker which stops them while the storage is down
+type RetryConfig struct {
+	Attempts         int     `yaml:"attempts"`      // per operation, 0 retries until shutdown
+	InitialDelay     int     `yaml:"initial_delay"` // in milliseconds
+	MaxDelay         int     `yaml:"max_delay"`     // in milliseconds
+	Multiplier       float64 `yaml:"multiplier"`
+	BreakerThreshold int     `yaml:"breaker_threshold"` // failures opening the circuit
+	BreakerTimeout   int     `yaml:"breaker_timeout"`   // in seconds
+}
+
+// LockConfig contains the lock files which keep several instances from
+// running the same job at once
+type LockConfig struct {
+	// Dir is on a volume shared by the instances, empty disables locking. It
+	// defaults to locks next to the local store, or in the temporary
+	// directory for the databases.
+	Dir string `yaml:"dir"`
+	TTL int    `yaml:"ttl"` // in seconds, the lock of a crashed instance expires after it
+}
+
+// UploadsConfig contains the settings of the upload endpoint of the API
+type UploadsConfig struct {
+	Dir     string `yaml:"dir"`      // uploaded files are kept there during the import
+	MaxSize int    `yaml:"max_size"` // of a request in MiB
+}
+
+// AuthConfig contains the settings of the users of the API and the UI
+type AuthConfig struct {
+	SessionTTL int `yaml:"session_ttl"` // in hours
+}
+
+// PipelineConfig contains the settings of the concurrent import pipeline
+type PipelineConfig struct {
+	HashWorkers  int `yaml:"hash_workers"`
+	ParseWorkers int `yaml:"parse_workers"`
+	QueueSize    int `yaml:"queue_size"` // files waiting between two stages
+	BatchSize    int `yaml:"batch_size"` // transactions per insert
+}
+
+// LifecycleConfig contains the settings of the files in the input directory
+type LifecycleConfig struct {
+	Archive       bool     `yaml:"archive"`        // move imported files out of input_dir
+	ProcessedDir  string   `yaml:"processed_dir"`  // relative to input_dir
+	QuarantineDir string   `yaml:"quarantine_dir"` // relative to input_dir
+	Include       []string `yaml:"include"`        // glob patterns
+	Exclude       []string `yaml:"exclude"`        // glob patterns
+}
+
+// S3Config contains the configuration for the S3 compatible object storage
+// used as input source
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"` // lifecycle directories are located under it
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	Region    string `yaml:"region"`
+	UseSSL    bool   `yaml:"use_ssl"`
+}
+
+// IMAPConfig contains the configuration for the mailbox receiving statements
+// as attachments used as input source
+type IMAPConfig struct {
+	Address          string `yaml:"address"` // host:port
+	Username         string `yaml:"username"`
+	Password         string `yaml:"password"`
+	TLS              bool   `yaml:"tls"`
+	Folder           string `yaml:"folder"`            // polled for new messages
+	ProcessedFolder  string `yaml:"processed_folder"`  // messages are only flagged if empty
+	QuarantineFolder string `yaml:"quarantine_folder"` // messages are only flagged if empty
 }
 
 // ClickhouseConfig contains the configuration for the Clickhouse database
@@ -28,12 +158,103 @@ type ClickhouseConfig struct {
 	Timeout  int    `yaml:"timeout"` // in seconds
 }
 
+// PostgresConfig contains the configuration for the PostgreSQL database
+type PostgresConfig struct {
+	Address  string `yaml:"address"`
+	Database string `yaml:"database"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	SSLMode  string `yaml:"ssl_mode"`
+}
+
+// LocalStoreConfig contains the configuration for the embedded file backed store
+type LocalStoreConfig struct {
+	Path string `yaml:"path"`
+}
+
+// Background jobs
+const (
+	JobImport       = "import"
+	JobRecategorise = "recategorise"
+	JobReport       = "report"
+	JobRetention    = "retention"
+)
+
+// Input sources
+const (
+	SourceLocal = "local"
+	SourceS3    = "s3"
+	SourceIMAP  = "imap"
+)
+
+// Storage backends
+const (
+	StorageClickhouse = "clickhouse"
+	StoragePostgres   = "postgres"
+	StorageLocal      = "local"
+)
+
 // Defaults sets the default values for the configuration
 func (conf *Config) Defaults() {
 	conf.InputDir = "./input"
+	conf.Source = SourceLocal
+	conf.S3 = S3Config{
+		Region: "us-east-1",
+		UseSSL: true,
+	}
+	conf.IMAP = IMAPConfig{
+		TLS:    true,
+		Folder: "INBOX",
+	}
+	conf.Lifecycle = LifecycleConfig{
+		Archive:       false,
+		ProcessedDir:  "processed",
+		QuarantineDir: "quarantine",
+		Include:       []string{"*.csv", "*.zip", "*.tar.gz", "*.tgz", "*.gz"},
+	}
 	conf.RunEvery = 24
+	conf.Pipeline = PipelineConfig{
+		HashWorkers:  4,
+		ParseWorkers: 4,
+		QueueSize:    16,
+		BatchSize:    1000,
+	}
+	conf.Jobs = []JobConfig{
+		{Name: JobImport, RunOnStart: true},
+	}
+	conf.Reports = ReportsConfig{
+		Dir: "./reports",
+	}
+	conf.Retention = RetentionConfig{
+		Days: 365,
+	}
+	conf.Lock = LockConfig{
+		TTL: 120,
+	}
+	conf.Uploads = UploadsConfig{
+		Dir:     filepath.Join(os.TempDir(), "c24-uploads"), // writable in the image
+		MaxSize: 32,
+	}
+	conf.Auth = AuthConfig{
+		SessionTTL: 12,
+	}
+	conf.Retry = RetryConfig{
+		Attempts:         5,
+		InitialDelay:     500,
+		MaxDelay:         30000,
+		Multiplier:       2,
+		BreakerThreshold: 5,
+		BreakerTimeout:   30,
+	}
+	conf.Watch = true
+	conf.WatchSettle = 5
+	conf.HTTPPort = 8080
+	conf.MetricsPort = 9090
 	conf.LogLevel = "info"
 	conf.LogEncoding = "console"
+	conf.Storage = StorageClickhouse
+	conf.DefaultAccount = "main"
+	conf.InternalTransferWindow = 3
 	conf.Clickhouse = ClickhouseConfig{
 		Address:  "localhost:9000",
 		Database: "default",
@@ -41,6 +262,27 @@ func (conf *Config) Defaults() {
 		Password: "",
 		Timeout:  5,
 	}
+	conf.Postgres = PostgresConfig{
+		Address:  "localhost:5432",
+		Database: "c24",
+		Username: "postgres",
+		Password: "",
+		SSLMode:  "disable",
+	}
+	conf.LocalStore = LocalStoreConfig{
+		Path: "./data/store.json",
+	}
+	conf.Lock.Dir = conf.defaultLockDir()
+}
+
+// defaultLockDir returns the lock directory used unless one is configured,
+// next to the local store or in the temporary directory, which is writable
+// in the image, for the databases
+func (conf *Config) defaultLockDir() string {
+	if conf.Storage == StorageLocal {
+		return filepath.Join(filepath.Dir(conf.LocalStore.Path), "locks")
+	}
+	return filepath.Join(os.TempDir(), "c24-locks")
 }
 
 // ReadConfigFile reading and parsing configuration yaml file
@@ -49,8 +291,15 @@ func (conf *Config) ReadConfigFile(configPath string) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	defaultLockDir := conf.Lock.Dir
 	err = yaml.Unmarshal(yamlConfig, &conf)
 	if err != nil {
 		log.Fatal(fmt.Errorf("could not unmarshal config %v", conf), err)
 	}
+	// the default follows the configured store
+	if conf.Lock.Dir == defaultLockDir {
+		conf.Lock.Dir = conf.defaultLockDir()
+	}
+	// files are only complete once they didn't change for a second
+	conf.WatchSettle = max(conf.WatchSettle, 1)
 }
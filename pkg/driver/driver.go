@@ -3,7 +3,6 @@ package driver
 
 import (
 	"database/sql"
-	"fmt"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -23,9 +22,10 @@ func OpenDB(user, password, addr, database string) (*sql.DB, error) {
 		Compression: &clickhouse.Compression{Method: clickhouse.CompressionLZ4},
 		Settings:    clickhouse.Settings{"max_execution_time": 60},
 	})
-	err := db.Ping()
-	if err != nil {
-		fmt.Println(err)
+	// the pool of a failed attempt is closed, Connect retries by opening
+	// a new one
+	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
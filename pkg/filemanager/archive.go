@@ -0,0 +1,238 @@
+package filemanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// archive kinds which are expanded transparently
+const (
+	archiveNone  = ""
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+	archiveGzip  = "gz"
+)
+
+// archiveKind returns the kind of the archive by the file extension
+func archiveKind(path string) string {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(name, ".gz"):
+		return archiveGzip
+	default:
+		return archiveNone
+	}
+}
+
+// entryKey returns the deduplication key of an archive entry, which consists
+// of the archive SHA256 and the entry path
+func entryKey(archiveSHA256, entry string) string {
+	sum := sha256.Sum256([]byte(archiveSHA256 + ":" + entry))
+	return hex.EncodeToString(sum[:])
+}
+
+// listEntries returns the paths of the regular files in the archive
+// which match the include and exclude patterns
+func (f *FileManager) listEntries(ctx context.Context, path string) ([]string, error) {
+	var entries []string
+	add := func(entry string) {
+		if f.lifecycle.includes(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	switch archiveKind(path) {
+	case archiveZip:
+		reader, closer, err := f.openZip(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		defer closer.Close()
+		for _, file := range reader.File {
+			if !file.FileInfo().IsDir() {
+				add(file.Name)
+			}
+		}
+	case archiveTarGz:
+		err := f.walkTarGz(ctx, path, func(header *tar.Header) error {
+			if header.Typeflag == tar.TypeReg {
+				add(header.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case archiveGzip:
+		add(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	}
+	return entries, nil
+}
+
+// Open returns the content of the file as a stream. Entries of archives are
+// decompressed on the fly without extracting them to disk.
+func (f *FileManager) Open(ctx context.Context, file models.SHAFile) (io.ReadCloser, error) {
+	if file.Entry == "" {
+		return f.source.Open(ctx, file.Path)
+	}
+
+	switch archiveKind(file.Path) {
+	case archiveZip:
+		reader, closer, err := f.openZip(ctx, file.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, zipFile := range reader.File {
+			if zipFile.Name != file.Entry {
+				continue
+			}
+			entry, err := zipFile.Open()
+			if err != nil {
+				closer.Close()
+				return nil, err
+			}
+			return &multiCloser{Reader: entry, closers: []io.Closer{entry, closer}}, nil
+		}
+		closer.Close()
+		return nil, fmt.Errorf("entry %s not found in %s", file.Entry, file.Path)
+	case archiveTarGz:
+		return f.openTarGzEntry(ctx, file.Path, file.Entry)
+	case archiveGzip:
+		stream, err := f.source.Open(ctx, file.Path)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			stream.Close()
+			return nil, err
+		}
+		return &multiCloser{Reader: gz, closers: []io.Closer{gz, stream}}, nil
+	default:
+		return nil, fmt.Errorf("%s is not an archive", file.Path)
+	}
+}
+
+// openZip returns the reader of the zip archive. Zip archives need random
+// access, so the streams of remote sources are buffered in memory.
+func (f *FileManager) openZip(ctx context.Context, path string) (*zip.Reader, io.Closer, error) {
+	stream, err := f.source.Open(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if osFile, ok := stream.(*os.File); ok {
+		info, err := osFile.Stat()
+		if err != nil {
+			osFile.Close()
+			return nil, nil, err
+		}
+		reader, err := zip.NewReader(osFile, info.Size())
+		if err != nil {
+			osFile.Close()
+			return nil, nil, err
+		}
+		return reader, osFile, nil
+	}
+
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		stream.Close()
+		return nil, nil, err
+	}
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		stream.Close()
+		return nil, nil, err
+	}
+	return reader, stream, nil
+}
+
+// walkTarGz calls fn for every entry of the tar.gz archive
+func (f *FileManager) walkTarGz(ctx context.Context, path string, fn func(*tar.Header) error) error {
+	stream, err := f.source.Open(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	gz, err := gzip.NewReader(stream)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tarReader := tar.NewReader(gz)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(header); err != nil {
+			return err
+		}
+	}
+}
+
+// openTarGzEntry returns a stream positioned at the entry of the tar.gz archive
+func (f *FileManager) openTarGzEntry(ctx context.Context, path, entry string) (io.ReadCloser, error) {
+	stream, err := f.source.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(stream)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+	tarReader := tar.NewReader(gz)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			gz.Close()
+			stream.Close()
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("entry %s not found in %s", entry, path)
+			}
+			return nil, err
+		}
+		if header.Name == entry {
+			return &multiCloser{Reader: tarReader, closers: []io.Closer{gz, stream}}, nil
+		}
+	}
+}
+
+// multiCloser closes all underlying readers of an archive entry
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes all closers and returns the first error
+func (m *multiCloser) Close() error {
+	var firstErr error
+	for _, closer := range m.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
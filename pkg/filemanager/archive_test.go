@@ -0,0 +1,116 @@
+package filemanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// createArchives writes the same entries to a zip and a tar.gz archive
+// and the first entry to a gzip file
+func createArchives(t *testing.T, dir string, entries map[string]string) {
+	zipFile, err := os.Create(filepath.Join(dir, "exports.zip"))
+	assert.NoError(t, err)
+	zipWriter := zip.NewWriter(zipFile)
+
+	tarFile, err := os.Create(filepath.Join(dir, "exports.tar.gz"))
+	assert.NoError(t, err)
+	gzWriter := gzip.NewWriter(tarFile)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	for name, content := range entries {
+		w, err := zipWriter.Create(name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		assert.NoError(t, err)
+
+		assert.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg,
+		}))
+		_, err = tarWriter.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zipWriter.Close())
+	assert.NoError(t, zipFile.Close())
+	assert.NoError(t, tarWriter.Close())
+	assert.NoError(t, gzWriter.Close())
+	assert.NoError(t, tarFile.Close())
+
+	gzFile, err := os.Create(filepath.Join(dir, "march.csv.gz"))
+	assert.NoError(t, err)
+	gzWriter = gzip.NewWriter(gzFile)
+	_, err = gzWriter.Write([]byte(entries["2025/march.csv"]))
+	assert.NoError(t, err)
+	assert.NoError(t, gzWriter.Close())
+	assert.NoError(t, gzFile.Close())
+}
+
+func TestArchives(t *testing.T) {
+	tempDir := t.TempDir()
+	entries := map[string]string{
+		"2025/march.csv": "march",
+		"2025/april.csv": "april",
+		"readme.txt":     "not an export",
+	}
+	createArchives(t, tempDir, entries)
+
+	mockDB := new(MockDBModel)
+	mockDB.On("GetSHAFiles").Return([]models.SHAFile{}, nil)
+	mockDB.On("InsertSHAFile", mock.Anything).Return(nil)
+	fileManager := NewFileManager(tempDir, mockDB).WithLifecycle(Lifecycle{
+		Include: []string{"*.csv", "*.zip", "*.tar.gz", "*.gz"},
+	})
+
+	files, err := fileManager.GetFilesToUpload(context.Background())
+	assert.NoError(t, err)
+	// two csv entries of both archives and the gzip file
+	assert.Len(t, files, 5)
+
+	keys := make(map[string]struct{})
+	for _, file := range files {
+		assert.NotEmpty(t, file.Entry)
+		keys[file.SHA256] = struct{}{}
+
+		reader, err := fileManager.Open(context.Background(), file)
+		assert.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.NoError(t, reader.Close())
+
+		expected := entries[file.Entry]
+		if archiveKind(file.Path) == archiveGzip {
+			assert.Equal(t, "march.csv", file.Entry)
+			expected = entries["2025/march.csv"]
+		}
+		assert.Equal(t, expected, string(content), file.Name())
+	}
+	// every entry has its own key
+	assert.Len(t, keys, len(files))
+
+	_, err = fileManager.Open(context.Background(), models.SHAFile{Path: filepath.Join(tempDir, "exports.zip"), Entry: "missing.csv"})
+	assert.Error(t, err)
+	_, err = fileManager.Open(context.Background(), models.SHAFile{Path: filepath.Join(tempDir, "exports.tar.gz"), Entry: "missing.csv"})
+	assert.Error(t, err)
+}
+
+func TestArchiveKind(t *testing.T) {
+	tests := map[string]string{
+		"export.csv":    archiveNone,
+		"export.ZIP":    archiveZip,
+		"export.tar.gz": archiveTarGz,
+		"export.tgz":    archiveTarGz,
+		"export.csv.gz": archiveGzip,
+	}
+	for path, expected := range tests {
+		assert.Equal(t, expected, archiveKind(path), path)
+	}
+}
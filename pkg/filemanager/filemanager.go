@@ -1,103 +1,254 @@
-// Package filemanager provides the functionality to find files in a given directory
+// Package filemanager provides the functionality to find files in a given source
 // and calculate their SHA256 hashes. It then checks if the hash is already in the database
 package filemanager
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"io"
-	"os"
-	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/13excite/c24-expense/pkg/models"
 )
 
 // DBModel is the interface for the database model
 type DBModel interface {
-	GetSHAFiles() ([]models.SHAFile, error)
-	InsertSHAFile(models.SHAFile) error
+	GetSHAFiles(ctx context.Context) ([]models.SHAFile, error)
+	InsertSHAFile(ctx context.Context, shaFile models.SHAFile) error
 }
 
-// FileManager struct that holds the folder path and the files
+// Source is the origin of the bank exports, e.g. a local directory
+// or an object storage bucket
+type Source interface {
+	// List returns the paths of the files which can be imported
+	List(ctx context.Context) ([]string, error)
+	// Open returns the content of the file as a stream
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	// Checksum returns the SHA256 hash of the file content
+	Checksum(ctx context.Context, path string) (string, error)
+	// MarkProcessed moves the imported file out of the way of the next List call
+	MarkProcessed(ctx context.Context, path string, importedAt time.Time) error
+	// Quarantine moves the file which can't be parsed aside together with
+	// a report describing the failure
+	Quarantine(ctx context.Context, path, sha256 string, importErr error) error
+}
+
+// PendingLister is implemented by the sources whose List changes the source,
+// ListPending returns the paths List would return without changing it
+type PendingLister interface {
+	ListPending(ctx context.Context) ([]string, error)
+}
+
+// FileManager struct that holds the source and the files
 type FileManager struct {
-	folderPath        string
+	source    Source
+	lifecycle Lifecycle
+	hashCache *HashCache
+	DB        DBModel
+
+	// mu guards the files below, which are updated by concurrent
+	// DeduplicateFile calls
+	mu                sync.Mutex
 	initFiles         []string
+	processedFiles    []models.SHAFile
 	deduplicatedFiles []models.SHAFile
-	DB                DBModel
+	duplicateFiles    []models.SHAFile
 }
 
-// NewFileManager returns a new FileManager struct
+// NewFileManager returns a new FileManager struct for the local directory
 func NewFileManager(folderPath string, db DBModel) *FileManager {
+	return NewFileManagerFromSource(NewLocalSource(folderPath), db)
+}
+
+// NewFileManagerFromSource returns a new FileManager struct for the source
+func NewFileManagerFromSource(source Source, db DBModel) *FileManager {
 	return &FileManager{
-		folderPath:        folderPath,
+		source:            source,
 		initFiles:         make([]string, 0),
 		deduplicatedFiles: make([]models.SHAFile, 0),
+		duplicateFiles:    make([]models.SHAFile, 0),
 		DB:                db,
 	}
 }
 
+// WithHashCache sets the cache of the file checksums, which is usually
+// shared by the FileManagers of all runs
+func (f *FileManager) WithHashCache(cache *HashCache) *FileManager {
+	f.hashCache = cache
+	return f
+}
+
 // GetFilesToUpload returns the files that are not uploaded to database yet
-func (f *FileManager) GetFilesToUpload() ([]models.SHAFile, error) {
-	if err := f.deduplicateFiles(); err != nil {
+func (f *FileManager) GetFilesToUpload(ctx context.Context) ([]models.SHAFile, error) {
+	if err := f.deduplicateFiles(ctx); err != nil {
 		return nil, err
 	}
 	return f.deduplicatedFiles, nil
 }
 
-// deduplicateFiles finds the files in the given directory and calculates
-// their SHA256 hashes. It then checks if the hash is already in the database
-// and if not, adds the file to the list of files to be uploaded.
-func (f *FileManager) deduplicateFiles() error {
-	if err := f.findFiles(); err != nil {
-		return err
+// GetDuplicateFiles returns the files found by the last GetFilesToUpload
+// or DeduplicateFile calls which were already uploaded before
+func (f *FileManager) GetDuplicateFiles() []models.SHAFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.SHAFile(nil), f.duplicateFiles...)
+}
+
+// ListFiles finds the files of the source and loads the hashes of the
+// files which were uploaded before. It must be called before DeduplicateFile.
+func (f *FileManager) ListFiles(ctx context.Context) ([]string, error) {
+	if err := f.findFiles(ctx); err != nil {
+		return nil, err
 	}
+	processedFiles, err := f.DB.GetSHAFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.processedFiles = processedFiles
+	return append([]string(nil), f.initFiles...), nil
+}
+
+// ListPending returns the files of a source whose List changes the source
+// without changing it, ok is false for the other sources. The files aren't
+// deduplicated, that needs their content.
+func (f *FileManager) ListPending(ctx context.Context) (paths []string, ok bool, err error) {
+	lister, ok := f.source.(PendingLister)
+	if !ok {
+		return nil, false, nil
+	}
+	paths, err = lister.ListPending(ctx)
+	return paths, true, err
+}
 
-	processedFiles, err := f.DB.GetSHAFiles()
+// DeduplicateFile calculates the SHA256 hash of the file, or of every entry
+// if it's an archive, and returns the files which are not uploaded yet.
+// The hashes are stored by RecordFile once the files are imported, so
+// a file which fails is imported again by the next run. It's safe for
+// concurrent use.
+func (f *FileManager) DeduplicateFile(ctx context.Context, file string) ([]models.SHAFile, error) {
+	sha256, err := f.calculateSHA256(ctx, file)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, file := range f.initFiles {
-		sha256, err := f.calculateSHA256(file)
+	shaFiles := []models.SHAFile{{Path: file, SHA256: sha256}}
+	// archives are deduplicated by every entry separately
+	if archiveKind(file) != archiveNone {
+		entries, err := f.archiveEntries(ctx, file)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if !f.containsSHA256(processedFiles, sha256) {
-			shaFile := models.SHAFile{Path: file, SHA256: sha256}
-			f.DB.InsertSHAFile(shaFile)
-			f.deduplicatedFiles = append(f.deduplicatedFiles, shaFile)
+		shaFiles = shaFiles[:0]
+		for _, entry := range entries {
+			shaFiles = append(shaFiles, models.SHAFile{
+				Path:   file,
+				Entry:  entry,
+				SHA256: entryKey(sha256, entry),
+			})
 		}
 	}
-	return nil
+
+	newFiles := make([]models.SHAFile, 0, len(shaFiles))
+	f.mu.Lock()
+	for _, shaFile := range shaFiles {
+		if f.containsSHA256(f.processedFiles, shaFile.SHA256) {
+			f.duplicateFiles = append(f.duplicateFiles, shaFile)
+			continue
+		}
+		// the same content found twice in one run is uploaded once
+		f.processedFiles = append(f.processedFiles, shaFile)
+		newFiles = append(newFiles, shaFile)
+	}
+	f.deduplicatedFiles = append(f.deduplicatedFiles, newFiles...)
+	f.mu.Unlock()
+	return newFiles, nil
 }
 
-// findFiles recursively finds all files in the given directory.
-func (f *FileManager) findFiles() error {
-	err := filepath.Walk(f.folderPath, func(path string, info os.FileInfo, err error) error {
+// RecordFile stores the hash of the imported file, so it's skipped as
+// a duplicate from now on
+func (f *FileManager) RecordFile(ctx context.Context, file models.SHAFile) error {
+	return f.DB.InsertSHAFile(ctx, file)
+}
+
+// deduplicateFiles finds the files of the source and calculates their
+// SHA256 hashes. It then checks if the hash is already in the database
+// and if not, adds the file to the list of files to be uploaded.
+func (f *FileManager) deduplicateFiles(ctx context.Context) error {
+	files, err := f.ListFiles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		newFiles, err := f.DeduplicateFile(ctx, file)
 		if err != nil {
 			return err
 		}
-		// Skip dirs
-		if !info.IsDir() {
-			f.initFiles = append(f.initFiles, path)
+		for _, shaFile := range newFiles {
+			if err := f.RecordFile(ctx, shaFile); err != nil {
+				return err
+			}
 		}
-		return nil
-	})
-	return err
+	}
+	return nil
 }
 
-// CalculateSHA256 computes the SHA256 hash of a given file.
-func (f *FileManager) calculateSHA256(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+// findFiles finds all files of the source
+func (f *FileManager) findFiles(ctx context.Context) error {
+	files, err := f.source.List(ctx)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer file.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.initFiles = append(f.initFiles, files...)
+	return nil
+}
 
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
+// calculateSHA256 computes the SHA256 hash of a given file. The hash of
+// a file with unchanged size and modification time is taken from the cache.
+func (f *FileManager) calculateSHA256(ctx context.Context, filePath string) (string, error) {
+	stat, ok := f.source.(statSource)
+	if f.hashCache == nil || !ok {
+		return f.source.Checksum(ctx, filePath)
+	}
+	size, modTime, err := stat.Stat(ctx, filePath)
+	if err != nil {
 		return "", err
 	}
-	return hex.EncodeToString(hasher.Sum(nil)), nil
+	if sha256, ok := f.hashCache.get(filePath, size, modTime); ok {
+		return sha256, nil
+	}
+	sha256, err := f.source.Checksum(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	f.hashCache.put(filePath, size, modTime, sha256)
+	return sha256, nil
+}
+
+// archiveEntries returns the entries of the archive. The entries of an
+// archive with unchanged size and modification time are taken from the
+// cache, so the archive isn't read again.
+func (f *FileManager) archiveEntries(ctx context.Context, filePath string) ([]string, error) {
+	stat, ok := f.source.(statSource)
+	if f.hashCache == nil || !ok {
+		return f.listEntries(ctx, filePath)
+	}
+	size, modTime, err := stat.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if entries, ok := f.hashCache.getEntries(filePath, size, modTime); ok {
+		return entries, nil
+	}
+	entries, err := f.listEntries(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	f.hashCache.putEntries(filePath, size, modTime, entries)
+	return entries, nil
 }
 
 // containsSHA256 checks if the given SHA256 hash is in the list of files.
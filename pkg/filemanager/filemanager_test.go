@@ -1,6 +1,7 @@
 package filemanager
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,12 +17,12 @@ type MockDBModel struct {
 	mock.Mock
 }
 
-func (m *MockDBModel) GetSHAFiles() ([]models.SHAFile, error) {
+func (m *MockDBModel) GetSHAFiles(context.Context) ([]models.SHAFile, error) {
 	args := m.Called()
 	return args.Get(0).([]models.SHAFile), args.Error(1)
 }
 
-func (m *MockDBModel) InsertSHAFile(file models.SHAFile) error {
+func (m *MockDBModel) InsertSHAFile(_ context.Context, file models.SHAFile) error {
 	args := m.Called(file)
 	return args.Error(0)
 }
@@ -46,14 +47,14 @@ func TestFindFiles(t *testing.T) {
 	// test correct file path
 	fileManager := NewFileManager(tempDir, &db)
 
-	err := fileManager.findFiles()
+	err := fileManager.findFiles(context.Background())
 	assert.NoError(t, err)
 
 	assert.ElementsMatch(t, testFiles, fileManager.initFiles)
 
 	// test incorrect file path
 	fileManager = NewFileManager("wrong/path", &db)
-	err = fileManager.findFiles()
+	err = fileManager.findFiles(context.Background())
 	assert.Error(t, err)
 }
 
@@ -97,8 +98,8 @@ func TestCalculateSHA256(t *testing.T) {
 	tempFile.Close()
 
 	// test correct file path
-	fileManager := &FileManager{}
-	sha256, err := fileManager.calculateSHA256(tempFile.Name())
+	fileManager := NewFileManager(os.TempDir(), nil)
+	sha256, err := fileManager.calculateSHA256(context.Background(), tempFile.Name())
 	assert.NoError(t, err)
 
 	// Expected SHA256 hash of "Hello, World!" shasum -a 256 <file>
@@ -106,7 +107,7 @@ func TestCalculateSHA256(t *testing.T) {
 	assert.Equal(t, expectedSHA256, sha256)
 
 	// test incorrect file path
-	_, err = fileManager.calculateSHA256("wrong/path")
+	_, err = fileManager.calculateSHA256(context.Background(), "wrong/path")
 	assert.Error(t, err)
 }
 
@@ -135,19 +136,19 @@ func TestDeduplicateFiles(t *testing.T) {
 	fileManager := NewFileManager(tempDir, mockDB)
 
 	// Test deduplicateFiles
-	err := fileManager.deduplicateFiles()
+	err := fileManager.deduplicateFiles(context.Background())
 	assert.NoError(t, err)
 
 	// Check deduplicatedFiles and make sure only the second file is present
 	assert.Len(t, fileManager.deduplicatedFiles, len(testFiles)-1)
 
 	// Verify that InsertSHAFile was called for path testFiles[1]
-	sha256, err := fileManager.calculateSHA256(testFiles[1])
+	sha256, err := fileManager.calculateSHA256(context.Background(), testFiles[1])
 	assert.NoError(t, err)
 	mockDB.AssertCalled(t, "InsertSHAFile", models.SHAFile{Path: testFiles[1], SHA256: sha256})
 
 	// and was not called for path testFiles[0]
-	sha256, err = fileManager.calculateSHA256(testFiles[0])
+	sha256, err = fileManager.calculateSHA256(context.Background(), testFiles[0])
 	assert.NoError(t, err)
 	mockDB.AssertNotCalled(t, "InsertSHAFile", models.SHAFile{Path: testFiles[0], SHA256: sha256})
 
@@ -156,6 +157,6 @@ func TestDeduplicateFiles(t *testing.T) {
 	errorMockDB.On("GetSHAFiles").Return([]models.SHAFile{}, fmt.Errorf("db error"))
 	errorMockDB.On("InsertSHAFile", mock.Anything).Return(nil)
 	fileManager = NewFileManager(tempDir, errorMockDB)
-	err = fileManager.deduplicateFiles()
+	err = fileManager.deduplicateFiles(context.Background())
 	assert.Error(t, err)
 }
@@ -0,0 +1,91 @@
+package filemanager
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// statSource is implemented by the sources which can report the size and
+// the modification time of a file without reading it
+type statSource interface {
+	Stat(ctx context.Context, path string) (int64, time.Time, error)
+}
+
+// HashCache struct that holds the SHA256 hashes of the files and the entries
+// of the archives by their path, size and modification time, so unchanged
+// files are not read again
+type HashCache struct {
+	mu      sync.Mutex
+	entries map[string]hashCacheEntry
+}
+
+// hashCacheEntry is the hash of a file and the entries of an archive with
+// the size and the modification time they were read for
+type hashCacheEntry struct {
+	size    int64
+	modTime time.Time
+	sha256  string
+	entries []string
+	listed  bool // whether entries holds the list of an archive
+}
+
+// NewHashCache returns a new empty HashCache
+func NewHashCache() *HashCache {
+	return &HashCache{entries: make(map[string]hashCacheEntry)}
+}
+
+// get returns the cached hash if the file didn't change since it was cached
+func (c *HashCache) get(path string, size int64, modTime time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	if !ok || entry.size != size || !entry.modTime.Equal(modTime) {
+		return "", false
+	}
+	return entry.sha256, true
+}
+
+// put caches the hash of the file
+func (c *HashCache) put(path string, size int64, modTime time.Time, sha256 string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = hashCacheEntry{size: size, modTime: modTime, sha256: sha256}
+}
+
+// getEntries returns the cached entries of the archive if it didn't change
+// since they were listed
+func (c *HashCache) getEntries(path string, size int64, modTime time.Time) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	if !ok || !entry.listed || entry.size != size || !entry.modTime.Equal(modTime) {
+		return nil, false
+	}
+	return slices.Clone(entry.entries), true
+}
+
+// putEntries caches the entries of the archive along with its hash, they're
+// dropped with the hash when the archive changes
+func (c *HashCache) putEntries(path string, size int64, modTime time.Time, entries []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	if !ok || entry.size != size || !entry.modTime.Equal(modTime) {
+		return
+	}
+	entry.entries, entry.listed = slices.Clone(entries), true
+	c.entries[path] = entry
+}
+
+// forget removes the file which was moved out of the source from the cache.
+// It's a no-op for a nil cache.
+func (c *HashCache) forget(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, path)
+}
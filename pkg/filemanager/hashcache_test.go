@@ -0,0 +1,71 @@
+package filemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashCache(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "export.csv")
+	modTime := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.WriteFile(path, []byte("march"), 0644))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	fileManager := NewFileManager(tempDir, nil).WithHashCache(NewHashCache())
+	cached, err := fileManager.calculateSHA256(context.Background(), path)
+	assert.NoError(t, err)
+
+	// the content isn't read again while size and modification time are unchanged
+	assert.NoError(t, os.WriteFile(path, []byte("april"), 0644))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	sha256, err := fileManager.calculateSHA256(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, cached, sha256)
+
+	// a new modification time invalidates the entry
+	assert.NoError(t, os.Chtimes(path, modTime.Add(time.Hour), modTime.Add(time.Hour)))
+	sha256, err = fileManager.calculateSHA256(context.Background(), path)
+	assert.NoError(t, err)
+	assert.NotEqual(t, cached, sha256)
+
+	// files moved out of the source are forgotten
+	fileManager.hashCache.forget(path)
+	_, ok := fileManager.hashCache.get(path, 5, modTime.Add(time.Hour))
+	assert.False(t, ok)
+}
+
+func TestHashCacheArchiveEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	createArchives(t, tempDir, map[string]string{"march.csv": "march"})
+	path := filepath.Join(tempDir, "exports.zip")
+	modTime := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	fileManager := NewFileManager(tempDir, nil).WithHashCache(NewHashCache())
+	_, err := fileManager.calculateSHA256(context.Background(), path)
+	assert.NoError(t, err)
+	entries, err := fileManager.archiveEntries(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"march.csv"}, entries)
+
+	// the archive isn't listed again while size and modification time are
+	// unchanged
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, make([]byte, info.Size()), 0644))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	entries, err = fileManager.archiveEntries(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"march.csv"}, entries)
+
+	// a new modification time invalidates the entries
+	assert.NoError(t, os.Chtimes(path, modTime.Add(time.Hour), modTime.Add(time.Hour)))
+	_, err = fileManager.archiveEntries(context.Background(), path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,437 @@
+package filemanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"go.uber.org/zap"
+)
+
+const (
+	imapScheme  = "imap://"
+	imapTimeout = 30 * time.Second
+	// imapProcessedFlag marks the messages whose attachments were imported
+	imapProcessedFlag = "$C24Imported"
+	// imapQuarantineFlag marks the messages with attachments which can't be parsed
+	imapQuarantineFlag = "$C24Failed"
+	// imapSkippedFlag marks the messages without an attachment to import,
+	// they are left in the folder
+	imapSkippedFlag = "$C24Skipped"
+)
+
+var _ Source = (*IMAPSource)(nil)
+
+// IMAPConfig struct that holds the settings of the mailbox receiving
+// the statements
+type IMAPConfig struct {
+	Address  string
+	Username string
+	Password string
+	TLS      bool
+	// Folder is polled for messages with attachments
+	Folder string
+	// ProcessedFolder and QuarantineFolder receive the processed messages,
+	// the messages are only flagged if they are empty
+	ProcessedFolder  string
+	QuarantineFolder string
+}
+
+// IMAPSource struct that holds the mailbox settings and the attachments
+// downloaded by the last List call
+type IMAPSource struct {
+	conf      IMAPConfig
+	lifecycle Lifecycle
+
+	mu          sync.Mutex
+	attachments map[string]imapAttachment
+	// pending counts the attachments of every message which aren't marked yet
+	pending map[uint32]int
+	// failed contains the messages with a quarantined attachment
+	failed map[uint32]bool
+}
+
+// imapAttachment is a downloaded attachment of a message
+type imapAttachment struct {
+	uid     uint32
+	content []byte
+}
+
+// NewIMAPSource returns a new Source for the mailbox folder
+func NewIMAPSource(conf IMAPConfig) *IMAPSource {
+	if conf.Folder == "" {
+		conf.Folder = "INBOX"
+	}
+	return &IMAPSource{
+		conf:        conf,
+		attachments: make(map[string]imapAttachment),
+		pending:     make(map[uint32]int),
+		failed:      make(map[uint32]bool),
+	}
+}
+
+// setLifecycle sets the lifecycle settings, only the include and exclude
+// patterns are used to select the attachments
+func (s *IMAPSource) setLifecycle(lifecycle Lifecycle) {
+	s.lifecycle = lifecycle
+}
+
+// List downloads the attachments of the messages which weren't processed
+// yet and returns them as imap://folder/uid/part/name paths, part is the
+// MIME part number, so attachments of the same name are kept apart. Attachments not
+// matching the include and exclude patterns are skipped, messages without
+// any other attachment are flagged, so they aren't downloaded again.
+func (s *IMAPSource) List(ctx context.Context) ([]string, error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imapProcessedFlag, imapQuarantineFlag, imapSkippedFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attachments = make(map[string]imapAttachment)
+	s.pending = make(map[uint32]int)
+	s.failed = make(map[uint32]bool)
+
+	files := make([]string, 0)
+	if len(uids) == 0 {
+		return files, nil
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	logger := zap.S().With("package", "filemanager")
+	skipped := new(imap.SeqSet)
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		attachments, err := extractAttachments(body)
+		if err != nil {
+			// a broken message must not block the other ones
+			logger.Warn("Skipping message ", msg.Uid, " which can't be read: ", err)
+			skipped.AddNum(msg.Uid)
+			continue
+		}
+		for key, content := range attachments {
+			if !s.lifecycle.includes(baseName(key)) {
+				continue
+			}
+			path := fmt.Sprintf("%s%s/%d/%s", imapScheme, s.conf.Folder, msg.Uid, key)
+			s.attachments[path] = imapAttachment{uid: msg.Uid, content: content}
+			s.pending[msg.Uid]++
+			files = append(files, path)
+		}
+		if s.pending[msg.Uid] == 0 {
+			logger.Info("Skipping message ", msg.Uid, " without an attachment to import")
+			skipped.AddNum(msg.Uid)
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	if !skipped.Empty() {
+		item := imap.FormatFlagsOp(imap.AddFlags, true)
+		if err := c.UidStore(skipped, item, []interface{}{imapSkippedFlag}, nil); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// ListPending returns the paths List would return without downloading the
+// attachments or flagging the skipped messages, only the structure of the
+// messages is fetched
+func (s *IMAPSource) ListPending(ctx context.Context) ([]string, error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imapProcessedFlag, imapQuarantineFlag, imapSkippedFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	if len(uids) == 0 {
+		return files, nil
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, imap.FetchBodyStructure}, messages)
+	}()
+	for msg := range messages {
+		if msg.BodyStructure == nil {
+			continue
+		}
+		msg.BodyStructure.Walk(func(section []int, part *imap.BodyStructure) bool {
+			if len(part.Parts) > 0 {
+				return true
+			}
+			name, _ := part.Filename()
+			if name = baseName(name); name != "" && s.lifecycle.includes(name) {
+				files = append(files, fmt.Sprintf("%s%s/%d/%s", imapScheme, s.conf.Folder, msg.Uid, partKey(section, name)))
+			}
+			return false
+		})
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Open returns the content of the downloaded attachment
+func (s *IMAPSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	attachment, err := s.attachment(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(attachment.content)), nil
+}
+
+// Checksum computes the SHA256 hash of the attachment content
+func (s *IMAPSource) Checksum(ctx context.Context, path string) (string, error) {
+	attachment, err := s.attachment(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(attachment.content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// MarkProcessed flags the message of the attachment as imported and moves
+// it to the processed folder once all of its attachments are marked
+func (s *IMAPSource) MarkProcessed(ctx context.Context, path string, _ time.Time) error {
+	return s.mark(ctx, path, false)
+}
+
+// Quarantine flags the message of the attachment as failed and moves it
+// to the quarantine folder once all of its attachments are marked. The
+// error is only reported by the import record, mailboxes have no place
+// for a sidecar file.
+func (s *IMAPSource) Quarantine(ctx context.Context, path, _ string, _ error) error {
+	return s.mark(ctx, path, true)
+}
+
+// mark records the result of the attachment and finishes the message
+// after its last attachment
+func (s *IMAPSource) mark(ctx context.Context, path string, failed bool) error {
+	attachment, err := s.attachment(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.failed[attachment.uid] = s.failed[attachment.uid] || failed
+	s.pending[attachment.uid]--
+	done := s.pending[attachment.uid] == 0
+	failed = s.failed[attachment.uid]
+	s.mu.Unlock()
+
+	if !done {
+		return nil
+	}
+	flag, folder := imapProcessedFlag, s.conf.ProcessedFolder
+	if failed {
+		flag, folder = imapQuarantineFlag, s.conf.QuarantineFolder
+	}
+	return s.finishMessage(ctx, attachment.uid, flag, folder)
+}
+
+// finishMessage flags the message and moves it to the folder if it's set
+func (s *IMAPSource) finishMessage(ctx context.Context, uid uint32, flag, folder string) error {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.UidStore(seqSet, item, []interface{}{imap.SeenFlag, flag}, nil); err != nil {
+		return err
+	}
+	if folder == "" || folder == s.conf.Folder {
+		return nil
+	}
+	// the folder usually exists already, a real problem is reported by the move
+	_ = c.Create(folder)
+	return c.UidMove(seqSet, folder)
+}
+
+// connect logs in and selects the folder, the dial is aborted when ctx
+// is cancelled
+func (s *IMAPSource) connect(ctx context.Context) (*client.Client, error) {
+	dialer := &net.Dialer{Timeout: imapTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.conf.Address)
+	if err != nil {
+		return nil, err
+	}
+	if s.conf.TLS {
+		host, _, _ := net.SplitHostPort(s.conf.Address)
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	c, err := client.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.Timeout = imapTimeout
+
+	if err := c.Login(s.conf.Username, s.conf.Password); err != nil {
+		c.Logout()
+		return nil, err
+	}
+	if _, err := c.Select(s.conf.Folder, false); err != nil {
+		c.Logout()
+		return nil, err
+	}
+	return c, nil
+}
+
+// attachment returns the attachment downloaded by the last List call
+func (s *IMAPSource) attachment(path string) (imapAttachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attachment, ok := s.attachments[path]
+	if !ok {
+		return imapAttachment{}, fmt.Errorf("attachment %s not found", path)
+	}
+	return attachment, nil
+}
+
+// extractAttachments returns the content of the named parts of the message
+// by their part keys
+func extractAttachments(r io.Reader) (map[string][]byte, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	attachments := make(map[string][]byte)
+	err = walkPart(msg.Header, msg.Body, nil, attachments)
+	return attachments, err
+}
+
+// partKey returns the key of the attachment, which is the MIME part number
+// of the section and the file name, e.g. 1.2/march.csv. The single part of
+// a message is part 1 like in the IMAP body structure.
+func partKey(section []int, name string) string {
+	if len(section) == 0 {
+		section = []int{1}
+	}
+	numbers := make([]string, 0, len(section))
+	for _, number := range section {
+		numbers = append(numbers, strconv.Itoa(number))
+	}
+	return strings.Join(numbers, ".") + "/" + name
+}
+
+// partHeader is the subset of the MIME headers used to find attachments
+type partHeader interface {
+	Get(key string) string
+}
+
+// walkPart adds the part of the section to the attachments if it has a file
+// name and walks the nested parts of multipart bodies
+func walkPart(header partHeader, body io.Reader, section []int, attachments map[string][]byte) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for number := 1; ; number++ {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkPart(part.Header, part, append(slices.Clone(section), number), attachments); err != nil {
+				return err
+			}
+		}
+	}
+
+	name := partFileName(header, params)
+	if name == "" {
+		return nil
+	}
+	// nested parts are decoded from quoted-printable by the multipart reader
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	attachments[partKey(section, name)] = content
+	return nil
+}
+
+// partFileName returns the file name of the part from the Content-Disposition
+// or the Content-Type name parameter
+func partFileName(header partHeader, typeParams map[string]string) string {
+	name := typeParams["name"]
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	return baseName(name)
+}
+
+// baseName returns the file name without directories, the name is used in
+// paths, so directories of the sender are dropped
+func baseName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	return name[strings.LastIndex(name, "/")+1:]
+}
@@ -0,0 +1,311 @@
+package filemanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// moveBackend adds MOVE support to the memory backend, which advertises
+// the extension without implementing it
+type moveBackend struct {
+	*memory.Backend
+}
+
+type moveUser struct {
+	backend.User
+}
+
+type moveMailbox struct {
+	backend.Mailbox
+}
+
+func (b moveBackend) Login(info *imap.ConnInfo, username, password string) (backend.User, error) {
+	user, err := b.Backend.Login(info, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return moveUser{user}, nil
+}
+
+func (u moveUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mbox, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return moveMailbox{mbox}, nil
+}
+
+func (m moveMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, dest string) error {
+	if err := m.CopyMessages(uid, seqSet, dest); err != nil {
+		return err
+	}
+	if err := m.UpdateMessagesFlags(uid, seqSet, imap.AddFlags, []string{imap.DeletedFlag}); err != nil {
+		return err
+	}
+	return m.Expunge()
+}
+
+// newIMAPServer starts a local IMAP server with the messages in the INBOX
+// of the memory backend user
+func newIMAPServer(t *testing.T, messages ...string) (string, backend.User) {
+	be := memory.New()
+	user, err := be.Login(nil, "username", "password")
+	assert.NoError(t, err)
+	inbox, err := user.GetMailbox("INBOX")
+	assert.NoError(t, err)
+	for _, msg := range messages {
+		assert.NoError(t, inbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(msg)))
+	}
+
+	srv := server.New(moveBackend{be})
+	srv.AllowInsecureAuth = true
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String(), user
+}
+
+// statementMessage returns a message with a text part and the attachments,
+// given as pairs of file name and content
+func statementMessage(attachments ...string) string {
+	msg := "From: bank@example.org\r\n" +
+		"To: me@example.org\r\n" +
+		"Subject: Your statement\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Your monthly statement is attached.\r\n"
+	for i := 0; i+1 < len(attachments); i += 2 {
+		name, content := attachments[i], attachments[i+1]
+		msg += "--b1\r\n" +
+			"Content-Type: text/csv; name=\"" + name + "\"\r\n" +
+			"Content-Disposition: attachment; filename=\"" + name + "\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte(content)) + "\r\n"
+	}
+	return msg + "--b1--\r\n"
+}
+
+// hasFlag checks the flags case-insensitively, the memory backend
+// lowercases keywords
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// mailboxFlags returns the flags of the messages in the mailbox
+func mailboxFlags(t *testing.T, user backend.User, name string) [][]string {
+	mbox, err := user.GetMailbox(name)
+	if err != nil {
+		return nil
+	}
+	seqSet, _ := imap.ParseSeqSet("1:*")
+	messages := make(chan *imap.Message, 10)
+	assert.NoError(t, mbox.ListMessages(false, seqSet, []imap.FetchItem{imap.FetchFlags}, messages))
+	var flags [][]string
+	for msg := range messages {
+		flags = append(flags, msg.Flags)
+	}
+	return flags
+}
+
+func TestIMAPSource(t *testing.T) {
+	addr, user := newIMAPServer(t,
+		statementMessage("march.csv", "march", "statement.pdf", "pdf"),
+		statementMessage("april.csv", "april"),
+	)
+	source := NewIMAPSource(IMAPConfig{
+		Address:          addr,
+		Username:         "username",
+		Password:         "password",
+		ProcessedFolder:  "Processed",
+		QuarantineFolder: "Quarantine",
+	})
+
+	mockDB := new(MockDBModel)
+	mockDB.On("GetSHAFiles").Return([]models.SHAFile{}, nil)
+	mockDB.On("InsertSHAFile", mock.Anything).Return(nil)
+	fileManager := NewFileManagerFromSource(source, mockDB).WithLifecycle(Lifecycle{
+		Include: []string{"*.csv"},
+	})
+
+	files, err := fileManager.GetFilesToUpload(context.Background())
+	assert.NoError(t, err)
+	paths := make(map[string]string)
+	for _, file := range files {
+		reader, err := fileManager.Open(context.Background(), file)
+		assert.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		paths[file.Path] = string(content)
+	}
+	// the welcome message of the memory backend has no attachments
+	assert.Equal(t, map[string]string{
+		"imap://INBOX/7/2/march.csv": "march",
+		"imap://INBOX/8/2/april.csv": "april",
+	}, paths)
+
+	_, err = source.Open(context.Background(), "imap://INBOX/9/2/missing.csv")
+	assert.Error(t, err)
+
+	assert.NoError(t, fileManager.MarkProcessed(context.Background(), "imap://INBOX/7/2/march.csv", time.Now()))
+	assert.NoError(t, fileManager.Quarantine(context.Background(), "imap://INBOX/8/2/april.csv", "abc", errors.New("error reading header: EOF")))
+
+	// only the welcome message stays in the INBOX, it's flagged as skipped
+	inbox := mailboxFlags(t, user, "INBOX")
+	if assert.Len(t, inbox, 1) {
+		assert.True(t, hasFlag(inbox[0], imapSkippedFlag))
+	}
+	processed := mailboxFlags(t, user, "Processed")
+	assert.Len(t, processed, 1)
+	assert.True(t, hasFlag(processed[0], imapProcessedFlag))
+	quarantined := mailboxFlags(t, user, "Quarantine")
+	assert.Len(t, quarantined, 1)
+	assert.True(t, hasFlag(quarantined[0], imapQuarantineFlag))
+}
+
+func TestIMAPSourceFlagsOnly(t *testing.T) {
+	addr, user := newIMAPServer(t, statementMessage("march.csv", "march", "april.csv", "april"))
+	source := NewIMAPSource(IMAPConfig{Address: addr, Username: "username", Password: "password"})
+	source.setLifecycle(Lifecycle{Include: []string{"*.csv"}})
+
+	files, err := source.List(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// the message is finished only after its last attachment
+	assert.NoError(t, source.MarkProcessed(context.Background(), files[0], time.Now()))
+	assert.False(t, hasFlag(mailboxFlags(t, user, "INBOX")[1], imapProcessedFlag))
+	assert.NoError(t, source.MarkProcessed(context.Background(), files[1], time.Now()))
+	assert.True(t, hasFlag(mailboxFlags(t, user, "INBOX")[1], imapProcessedFlag))
+
+	// flagged messages are not listed again
+	files, err = source.List(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestIMAPSourceSkipsMessages(t *testing.T) {
+	addr, user := newIMAPServer(t, statementMessage("statement.pdf", "pdf"))
+	source := NewIMAPSource(IMAPConfig{Address: addr, Username: "username", Password: "password"})
+	source.setLifecycle(Lifecycle{Include: []string{"*.csv"}})
+
+	files, err := source.List(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	// the welcome message and the message with the pdf are flagged, they
+	// aren't downloaded again
+	inbox := mailboxFlags(t, user, "INBOX")
+	assert.Len(t, inbox, 2)
+	for _, flags := range inbox {
+		assert.True(t, hasFlag(flags, imapSkippedFlag))
+	}
+	// the skipped message isn't marked as read
+	assert.False(t, hasFlag(inbox[1], imap.SeenFlag))
+	files, err = source.List(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestIMAPSourceListPending(t *testing.T) {
+	addr, user := newIMAPServer(t,
+		statementMessage("march.csv", "march", "statement.pdf", "pdf"),
+		statementMessage("statement.pdf", "pdf"),
+		// attachments of the same name are kept apart by their part
+		statementMessage("export.csv", "march", "export.csv", "april"),
+	)
+	source := NewIMAPSource(IMAPConfig{Address: addr, Username: "username", Password: "password"})
+	fileManager := NewFileManagerFromSource(source, new(MockDBModel)).WithLifecycle(Lifecycle{
+		Include: []string{"*.csv"},
+	})
+
+	files, ok, err := fileManager.ListPending(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"imap://INBOX/7/2/march.csv",
+		"imap://INBOX/9/2/export.csv",
+		"imap://INBOX/9/3/export.csv",
+	}, files)
+	// nothing is flagged, the statements aren't marked as read
+	inbox := mailboxFlags(t, user, "INBOX")
+	assert.Len(t, inbox, 4)
+	for i, flags := range inbox {
+		assert.False(t, hasFlag(flags, imapSkippedFlag))
+		if i > 0 {
+			assert.False(t, hasFlag(flags, imap.SeenFlag))
+		}
+	}
+	// the attachments are downloaded under the same paths
+	listed, err := source.List(context.Background())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, files, listed)
+
+	// the other sources are listed as usual
+	_, ok, err = NewFileManager(t.TempDir(), new(MockDBModel)).ListPending(context.Background())
+	assert.False(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestExtractAttachments(t *testing.T) {
+	msg := "Subject: statement\r\n" +
+		"Content-Type: text/csv\r\n" +
+		"Content-Disposition: attachment; filename=\"=?utf-8?q?Ums=C3=A4tze.csv?=\"\r\n" +
+		"\r\n" +
+		"content"
+	attachments, err := extractAttachments(bytes.NewBufferString(msg))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"1/Umsätze.csv": []byte("content")}, attachments)
+
+	// quoted-printable attachments of single part and multipart messages
+	msg = "Subject: statement\r\n" +
+		"Content-Type: text/csv; name=\"march.csv\"\r\n" +
+		"Content-Transfer-Encoding: Quoted-Printable\r\n" +
+		"\r\n" +
+		"Buchungsdatum,Empf=C3=A4nger\r\n"
+	attachments, err = extractAttachments(bytes.NewBufferString(msg))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"1/march.csv": []byte("Buchungsdatum,Empfänger\r\n")}, attachments)
+	msg = "Subject: statement\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/csv; name=\"april.csv\"\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Buchungsdatum,Empf=C3=A4nger=\r\n" +
+		",Betrag\r\n" +
+		"--b1--\r\n"
+	attachments, err = extractAttachments(bytes.NewBufferString(msg))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"1/april.csv": []byte("Buchungsdatum,Empfänger,Betrag")}, attachments)
+
+	// plain messages have no attachments
+	attachments, err = extractAttachments(bytes.NewBufferString("Subject: hi\r\n\r\nhello"))
+	assert.NoError(t, err)
+	assert.Empty(t, attachments)
+}
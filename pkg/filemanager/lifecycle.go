@@ -0,0 +1,106 @@
+package filemanager
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Lifecycle struct that holds the settings of what happens with the files
+// of a source before and after an import
+type Lifecycle struct {
+	// Archive enables moving imported files out of the source
+	Archive bool
+	// ProcessedDir receives successfully imported files in YYYY/MM sub directories
+	ProcessedDir string
+	// QuarantineDir receives files which can't be parsed
+	QuarantineDir string
+	// Include and Exclude are glob patterns of the files to import. Patterns
+	// containing a slash are matched against the path relative to the source
+	// root, other patterns against the file name, both ignoring the case.
+	Include []string
+	Exclude []string
+}
+
+// quarantineReport is the content of the sidecar file written next to
+// a quarantined file
+type quarantineReport struct {
+	File     string    `json:"file"`
+	SHA256   string    `json:"sha256"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// lifecycleSource is implemented by the sources which support the lifecycle
+type lifecycleSource interface {
+	setLifecycle(Lifecycle)
+}
+
+// WithLifecycle sets the lifecycle settings of the FileManager and its source
+func (f *FileManager) WithLifecycle(lifecycle Lifecycle) *FileManager {
+	f.lifecycle = lifecycle
+	if source, ok := f.source.(lifecycleSource); ok {
+		source.setLifecycle(lifecycle)
+	}
+	return f
+}
+
+// includes checks the path relative to the source root against the
+// include and exclude patterns. Files not matching the include patterns
+// are logged at debug level, every run and every status request checks
+// them again, so an export named differently than expected can be found
+// with log_level debug.
+func (l Lifecycle) includes(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if strings.HasSuffix(rel, partSuffix) {
+		return false
+	}
+	if len(l.Include) > 0 && !matchAny(l.Include, rel) {
+		zap.S().With("package", "filemanager").Debug("Skipping ", rel, ", it doesn't match the include patterns ", l.Include)
+		return false
+	}
+	return !matchAny(l.Exclude, rel)
+}
+
+// matchAny checks whether the relative path matches one of the patterns
+// ignoring the case
+func matchAny(patterns []string, rel string) bool {
+	rel = strings.ToLower(rel)
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = filepath.Base(rel)
+		}
+		if ok, _ := filepath.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// newQuarantineReport returns the content of the .error.json sidecar file
+func newQuarantineReport(path, sha256 string, importErr error) ([]byte, error) {
+	return json.MarshalIndent(quarantineReport{
+		File:     path,
+		SHA256:   sha256,
+		Error:    importErr.Error(),
+		FailedAt: time.Now().UTC(),
+	}, "", "  ")
+}
+
+// MarkProcessed moves the imported file out of the source
+func (f *FileManager) MarkProcessed(ctx context.Context, path string, importedAt time.Time) error {
+	f.hashCache.forget(path)
+	return f.source.MarkProcessed(ctx, path, importedAt)
+}
+
+// Quarantine moves the file which can't be parsed aside and stores
+// the report describing the failure
+func (f *FileManager) Quarantine(ctx context.Context, path, sha256 string, importErr error) error {
+	f.hashCache.forget(path)
+	return f.source.Quarantine(ctx, path, sha256, importErr)
+}
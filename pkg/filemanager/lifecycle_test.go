@@ -0,0 +1,95 @@
+package filemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newLifecycleManager(t *testing.T) (*FileManager, string) {
+	tempDir := t.TempDir()
+	fileManager := NewFileManager(tempDir, &MockDBModel{}).WithLifecycle(Lifecycle{
+		Archive:       true,
+		ProcessedDir:  "processed",
+		QuarantineDir: "quarantine",
+		Include:       []string{"*.csv", "joint/*.txt"},
+		Exclude:       []string{"*draft*"},
+	})
+	return fileManager, tempDir
+}
+
+func TestFindFilesLifecycle(t *testing.T) {
+	fileManager, tempDir := newLifecycleManager(t)
+
+	files := []string{
+		"export.csv",
+		"EXPORT-2.CSV",
+		"export-draft.csv",
+		"Export-DRAFT.csv",
+		"notes.txt",
+		"joint/export.txt",
+		"export.csv.part",
+		"processed/2025/03/old.csv",
+		"quarantine/broken.csv",
+	}
+	for _, file := range files {
+		path := filepath.Join(tempDir, file)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(file), 0644))
+	}
+
+	assert.NoError(t, fileManager.findFiles(context.Background()))
+	assert.ElementsMatch(t, []string{
+		filepath.Join(tempDir, "export.csv"),
+		filepath.Join(tempDir, "EXPORT-2.CSV"),
+		filepath.Join(tempDir, "joint/export.txt"),
+	}, fileManager.initFiles)
+}
+
+func TestMarkProcessed(t *testing.T) {
+	fileManager, tempDir := newLifecycleManager(t)
+	importedAt := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(tempDir, "export.csv")
+		assert.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+		assert.NoError(t, fileManager.MarkProcessed(context.Background(), path, importedAt))
+		assert.NoFileExists(t, path)
+	}
+
+	// the second file with the same name gets a unique name
+	entries, err := os.ReadDir(filepath.Join(tempDir, "processed", "2025", "03"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// nothing is moved if archiving is disabled
+	fileManager.WithLifecycle(Lifecycle{ProcessedDir: "processed"})
+	path := filepath.Join(tempDir, "export.csv")
+	assert.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+	assert.NoError(t, fileManager.MarkProcessed(context.Background(), path, importedAt))
+	assert.FileExists(t, path)
+}
+
+func TestQuarantine(t *testing.T) {
+	fileManager, tempDir := newLifecycleManager(t)
+	path := filepath.Join(tempDir, "broken.csv")
+	assert.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+
+	assert.NoError(t, fileManager.Quarantine(context.Background(), path, "abc", errors.New("error reading header: EOF")))
+	assert.NoFileExists(t, path)
+	assert.FileExists(t, filepath.Join(tempDir, "quarantine", "broken.csv"))
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "quarantine", "broken.csv.error.json"))
+	assert.NoError(t, err)
+	var report quarantineReport
+	assert.NoError(t, json.Unmarshal(content, &report))
+	assert.Equal(t, path, report.File)
+	assert.Equal(t, "abc", report.SHA256)
+	assert.Equal(t, "error reading header: EOF", report.Error)
+}
@@ -0,0 +1,163 @@
+package filemanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ Source = (*LocalSource)(nil)
+
+// LocalSource struct that holds the input directory and its lifecycle
+type LocalSource struct {
+	dir       string
+	lifecycle Lifecycle
+}
+
+// NewLocalSource returns a new Source for the local directory
+func NewLocalSource(dir string) *LocalSource {
+	return &LocalSource{dir: dir}
+}
+
+// setLifecycle sets the lifecycle settings of the directory
+func (s *LocalSource) setLifecycle(lifecycle Lifecycle) {
+	s.lifecycle = lifecycle
+}
+
+// List recursively finds all files in the directory. The lifecycle
+// directories and files not matching the include and exclude patterns
+// are skipped.
+func (s *LocalSource) List(ctx context.Context) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if s.isLifecycleDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			rel = path
+		}
+		if s.lifecycle.includes(rel) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Open opens the file for reading
+func (s *LocalSource) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// Checksum computes the SHA256 hash of a given file.
+func (s *LocalSource) Checksum(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Stat returns the size and the modification time of the file
+func (s *LocalSource) Stat(ctx context.Context, path string) (int64, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return info.Size(), info.ModTime(), nil
+}
+
+// MarkProcessed moves the imported file to the processed/YYYY/MM directory
+func (s *LocalSource) MarkProcessed(ctx context.Context, path string, importedAt time.Time) error {
+	if !s.lifecycle.Archive || s.lifecycle.ProcessedDir == "" {
+		return nil
+	}
+	dir := filepath.Join(lifecycleDir(s.dir, s.lifecycle.ProcessedDir),
+		importedAt.Format("2006"), importedAt.Format("01"))
+	_, err := moveFile(path, dir)
+	return err
+}
+
+// Quarantine moves the file which can't be parsed to the quarantine directory
+// and writes a sidecar .error.json file describing the failure
+func (s *LocalSource) Quarantine(ctx context.Context, path, sha256 string, importErr error) error {
+	if !s.lifecycle.Archive || s.lifecycle.QuarantineDir == "" {
+		return nil
+	}
+	target, err := moveFile(path, lifecycleDir(s.dir, s.lifecycle.QuarantineDir))
+	if err != nil {
+		return err
+	}
+	report, err := newQuarantineReport(path, sha256, importErr)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(target+".error.json", report, 0o644)
+}
+
+// isLifecycleDir checks whether the directory is one of the lifecycle
+// directories, which are never scanned for new files
+func (s *LocalSource) isLifecycleDir(path string) bool {
+	for _, dir := range []string{s.lifecycle.ProcessedDir, s.lifecycle.QuarantineDir} {
+		if dir != "" && filepath.Clean(path) == lifecycleDir(s.dir, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// lifecycleDir returns the location of a lifecycle directory, relative
+// directories are located in the input directory
+func lifecycleDir(inputDir, dir string) string {
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(inputDir, dir)
+}
+
+// moveFile moves the file into the directory and returns its new path.
+// A timestamp is added to the name if the directory already has such a file.
+// The modification time is set to the time of the move, which the retention
+// counts from, a rename keeps the time of the export.
+func moveFile(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(target); err == nil {
+		target = uniqueName(target)
+	}
+	if err := os.Rename(path, target); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := os.Chtimes(target, now, now); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// uniqueName adds a timestamp to the file name before its extension
+func uniqueName(name string) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), time.Now().UnixNano(), ext)
+}
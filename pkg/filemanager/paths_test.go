@@ -0,0 +1,36 @@
+package filemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"march.csv", "notes.txt", "nested/april.csv"} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(name), 0o644))
+	}
+	march := filepath.Join(dir, "march.csv")
+	notes := filepath.Join(dir, "notes.txt")
+
+	source := NewPathSource([]string{notes, dir, march})
+	source.setLifecycle(Lifecycle{Include: []string{"*.csv"}})
+	files, err := source.List(context.Background())
+	assert.NoError(t, err)
+	// explicit files skip the patterns and every file is listed once
+	assert.Equal(t, []string{notes, march, filepath.Join(dir, "nested", "april.csv")}, files)
+
+	// the files stay in place
+	assert.NoError(t, source.MarkProcessed(context.Background(), march, time.Now()))
+	assert.FileExists(t, march)
+
+	_, err = NewPathSource([]string{filepath.Join(dir, "missing.csv")}).List(context.Background())
+	assert.Error(t, err)
+}
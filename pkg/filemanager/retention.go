@@ -0,0 +1,95 @@
+package filemanager
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// pruneSource is implemented by the sources which keep the processed
+// and quarantined files
+type pruneSource interface {
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// Prune removes the processed and quarantined files which were modified
+// before the given time and returns their number. Sources which don't keep
+// such files are skipped.
+func (f *FileManager) Prune(ctx context.Context, before time.Time) (int, error) {
+	source, ok := f.source.(pruneSource)
+	if !ok {
+		return 0, nil
+	}
+	return source.Prune(ctx, before)
+}
+
+// Prune removes the files of the lifecycle directories modified before
+// the given time, moveFile sets it to the time of archiving
+func (s *LocalSource) Prune(ctx context.Context, before time.Time) (int, error) {
+	removed := 0
+	for _, dir := range []string{s.lifecycle.ProcessedDir, s.lifecycle.QuarantineDir} {
+		if dir == "" {
+			continue
+		}
+		err := filepath.WalkDir(lifecycleDir(s.dir, dir), func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if info.ModTime().Before(before) {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				removed++
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// Prune removes the objects of the lifecycle prefixes modified before
+// the given time, the copy of moveObject is modified at the time of
+// archiving
+func (s *S3Source) Prune(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+
+	removed := 0
+	for _, dir := range []string{s.lifecycle.ProcessedDir, s.lifecycle.QuarantineDir} {
+		if strings.Trim(dir, "/") == "" {
+			continue
+		}
+		for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+			Prefix:    s.lifecycleKey(dir) + "/",
+			Recursive: true,
+		}) {
+			if object.Err != nil {
+				return removed, object.Err
+			}
+			if !object.LastModified.Before(before) {
+				continue
+			}
+			if err := s.client.RemoveObject(ctx, s.bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
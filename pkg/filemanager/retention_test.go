@@ -0,0 +1,56 @@
+package filemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrune(t *testing.T) {
+	fileManager, tempDir := newLifecycleManager(t)
+	now := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+
+	files := map[string]time.Time{
+		"export.csv":                       now.AddDate(-2, 0, 0),
+		"processed/2023/01/old.csv":        now.AddDate(-2, 0, 0),
+		"processed/2025/03/new.csv":        now,
+		"quarantine/broken.csv":            now.AddDate(-2, 0, 0),
+		"quarantine/broken.csv.error.json": now,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(tempDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(name), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	removed, err := fileManager.Prune(context.Background(), now.AddDate(-1, 0, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	// files waiting for the import are never removed
+	assert.FileExists(t, filepath.Join(tempDir, "export.csv"))
+	assert.NoFileExists(t, filepath.Join(tempDir, "processed/2023/01/old.csv"))
+	assert.FileExists(t, filepath.Join(tempDir, "processed/2025/03/new.csv"))
+	assert.NoFileExists(t, filepath.Join(tempDir, "quarantine/broken.csv"))
+	assert.FileExists(t, filepath.Join(tempDir, "quarantine/broken.csv.error.json"))
+}
+
+func TestPruneBackfilled(t *testing.T) {
+	fileManager, tempDir := newLifecycleManager(t)
+	// an export of last year which is imported only now
+	path := filepath.Join(tempDir, "2024-01.csv")
+	assert.NoError(t, os.WriteFile(path, []byte("export"), 0644))
+	exported := time.Now().AddDate(-1, 0, 0)
+	assert.NoError(t, os.Chtimes(path, exported, exported))
+	assert.NoError(t, fileManager.MarkProcessed(context.Background(), path, time.Now()))
+
+	// it's kept for the retention period from the time of archiving
+	removed, err := fileManager.Prune(context.Background(), time.Now().AddDate(0, 0, -30))
+	assert.NoError(t, err)
+	assert.Zero(t, removed)
+}
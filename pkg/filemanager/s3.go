@@ -0,0 +1,255 @@
+package filemanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	s3Scheme  = "s3://"
+	s3Timeout = 30 * time.Second
+)
+
+var _ Source = (*S3Source)(nil)
+
+// S3Config struct that holds the settings of an S3 compatible object storage
+type S3Config struct {
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+}
+
+// S3Source struct that holds the client of an S3 compatible object storage
+// and the bucket prefix with the bank exports
+type S3Source struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	lifecycle Lifecycle
+
+	mu sync.Mutex
+	// objects are the sizes and modification times of the listed objects
+	objects map[string]minio.ObjectInfo
+}
+
+// NewS3Source returns a new Source for the bucket prefix
+func NewS3Source(conf S3Config) (*S3Source, error) {
+	client, err := minio.New(conf.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""),
+		Secure: conf.UseSSL,
+		Region: conf.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Source{
+		client:  client,
+		bucket:  conf.Bucket,
+		prefix:  strings.Trim(conf.Prefix, "/"),
+		objects: make(map[string]minio.ObjectInfo),
+	}, nil
+}
+
+// setLifecycle sets the lifecycle settings of the bucket prefix
+func (s *S3Source) setLifecycle(lifecycle Lifecycle) {
+	s.lifecycle = lifecycle
+}
+
+// List returns all objects under the prefix as s3://bucket/key paths. The
+// lifecycle prefixes and objects not matching the include and exclude
+// patterns are skipped.
+func (s *S3Source) List(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+
+	listPrefix := s.prefix
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+	files := make([]string, 0)
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    listPrefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		rel := strings.TrimPrefix(object.Key, listPrefix)
+		if s.isLifecycleKey(rel) || !s.lifecycle.includes(rel) {
+			continue
+		}
+		s.mu.Lock()
+		s.objects[object.Key] = object
+		s.mu.Unlock()
+		files = append(files, s.path(object.Key))
+	}
+	return files, nil
+}
+
+// Open returns the content of the object as a stream
+func (s *S3Source) Open(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	key, err := s.key(filePath)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, stat the object to report missing objects early
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	return object, nil
+}
+
+// Stat returns the size and the modification time of the object, listed
+// objects don't need another request
+func (s *S3Source) Stat(ctx context.Context, filePath string) (int64, time.Time, error) {
+	key, err := s.key(filePath)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	s.mu.Lock()
+	object, ok := s.objects[key]
+	s.mu.Unlock()
+	if !ok {
+		ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+		defer cancel()
+		if object, err = s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err != nil {
+			return 0, time.Time{}, err
+		}
+	}
+	return object.Size, object.LastModified, nil
+}
+
+// Checksum computes the SHA256 hash of the object content. The ETag can't
+// be used, because it is not a content hash for multipart uploads.
+func (s *S3Source) Checksum(ctx context.Context, filePath string) (string, error) {
+	object, err := s.Open(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, object); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// MarkProcessed moves the imported object to the processed/YYYY/MM prefix
+func (s *S3Source) MarkProcessed(ctx context.Context, filePath string, importedAt time.Time) error {
+	if !s.lifecycle.Archive || s.lifecycle.ProcessedDir == "" {
+		return nil
+	}
+	dir := path.Join(s.lifecycleKey(s.lifecycle.ProcessedDir),
+		importedAt.Format("2006"), importedAt.Format("01"))
+	_, err := s.moveObject(ctx, filePath, dir)
+	return err
+}
+
+// Quarantine moves the object which can't be parsed to the quarantine prefix
+// and uploads a sidecar .error.json object describing the failure
+func (s *S3Source) Quarantine(ctx context.Context, filePath, sha256 string, importErr error) error {
+	if !s.lifecycle.Archive || s.lifecycle.QuarantineDir == "" {
+		return nil
+	}
+	target, err := s.moveObject(ctx, filePath, s.lifecycleKey(s.lifecycle.QuarantineDir))
+	if err != nil {
+		return err
+	}
+	report, err := newQuarantineReport(filePath, sha256, importErr)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+	_, err = s.client.PutObject(ctx, s.bucket, target+".error.json", bytes.NewReader(report),
+		int64(len(report)), minio.PutObjectOptions{
+			ContentType:          "application/json",
+			DisableContentSha256: true,
+		})
+	return err
+}
+
+// moveObject copies the object under the prefix, removes the original and
+// returns the new key. A timestamp is added to the name if the prefix
+// already has such an object.
+func (s *S3Source) moveObject(ctx context.Context, filePath, prefix string) (string, error) {
+	key, err := s.key(filePath)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+
+	target := path.Join(prefix, path.Base(key))
+	if _, err := s.client.StatObject(ctx, s.bucket, target, minio.StatObjectOptions{}); err == nil {
+		target = uniqueName(target)
+	}
+	_, err = s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: target},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: key},
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// isLifecycleKey checks whether the key relative to the prefix is located
+// in one of the lifecycle prefixes, which are never scanned for new files
+func (s *S3Source) isLifecycleKey(rel string) bool {
+	for _, dir := range []string{s.lifecycle.ProcessedDir, s.lifecycle.QuarantineDir} {
+		dir = strings.Trim(dir, "/")
+		if dir != "" && strings.HasPrefix(rel, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// lifecycleKey returns the key prefix of a lifecycle directory, which is
+// always located under the source prefix
+func (s *S3Source) lifecycleKey(dir string) string {
+	return path.Join(s.prefix, strings.Trim(dir, "/"))
+}
+
+// path returns the s3://bucket/key path of the object
+func (s *S3Source) path(key string) string {
+	return s3Scheme + s.bucket + "/" + key
+}
+
+// key returns the object key of the s3://bucket/key path
+func (s *S3Source) key(filePath string) (string, error) {
+	bucketPrefix := s3Scheme + s.bucket + "/"
+	if !strings.HasPrefix(filePath, bucketPrefix) {
+		return "", fmt.Errorf("%s is not located in bucket %s", filePath, s.bucket)
+	}
+	return strings.TrimPrefix(filePath, bucketPrefix), nil
+}
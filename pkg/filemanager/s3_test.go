@@ -0,0 +1,240 @@
+package filemanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeS3 is an in-process stand-in of the S3 API which supports the calls
+// used by S3Source on a single bucket
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+type fakeListResult struct {
+	XMLName     xml.Name        `xml:"ListBucketResult"`
+	Name        string          `xml:"Name"`
+	Prefix      string          `xml:"Prefix"`
+	KeyCount    int             `xml:"KeyCount"`
+	IsTruncated bool            `xml:"IsTruncated"`
+	Contents    []fakeListEntry `xml:"Contents"`
+}
+
+type fakeListEntry struct {
+	Key          string `xml:"Key"`
+	Size         int    `xml:"Size"`
+	ETag         string `xml:"ETag"`
+	LastModified string `xml:"LastModified"`
+}
+
+type fakeCopyResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+func newFakeS3(t *testing.T, bucket string, objects map[string]string) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{bucket: bucket, objects: make(map[string][]byte)}
+	for key, content := range objects {
+		fake.objects[key] = []byte(content)
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucketPrefix := "/" + f.bucket
+	if !strings.HasPrefix(r.URL.Path, bucketPrefix) {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, bucketPrefix), "/")
+	lastModified := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		prefix := r.URL.Query().Get("prefix")
+		result := fakeListResult{Name: f.bucket, Prefix: prefix}
+		for objectKey, content := range f.objects {
+			if strings.HasPrefix(objectKey, prefix) {
+				result.Contents = append(result.Contents, fakeListEntry{
+					Key:          objectKey,
+					Size:         len(content),
+					ETag:         `"etag"`,
+					LastModified: lastModified.Format(time.RFC3339),
+				})
+			}
+		}
+		result.KeyCount = len(result.Contents)
+		w.Header().Set("Content-Type", "application/xml")
+		assertNoError(xml.NewEncoder(w).Encode(result))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			}
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		sourceKey := strings.TrimPrefix(strings.TrimPrefix(source, "/"), f.bucket+"/")
+		content, ok := f.objects[sourceKey]
+		if !ok {
+			http.Error(w, "no such key", http.StatusNotFound)
+			return
+		}
+		f.objects[key] = content
+		w.Header().Set("Content-Type", "application/xml")
+		assertNoError(xml.NewEncoder(w).Encode(fakeCopyResult{
+			ETag: `"etag"`, LastModified: lastModified.Format(time.RFC3339),
+		}))
+	case r.Method == http.MethodPut:
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = content
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func assertNoError(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func newTestS3Source(t *testing.T, server *httptest.Server) *S3Source {
+	source, err := NewS3Source(S3Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Bucket:    "exports",
+		Prefix:    "bank/",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+	})
+	assert.NoError(t, err)
+	return source
+}
+
+func TestS3Source(t *testing.T) {
+	fake, server := newFakeS3(t, "exports", map[string]string{
+		"bank/march.csv":                 "march",
+		"bank/joint/april.csv":           "april",
+		"bank/notes.txt":                 "notes",
+		"bank/processed/2025/02/old.csv": "old",
+		"bank/quarantine/broken.csv":     "broken",
+		"other/may.csv":                  "may",
+	})
+	source := newTestS3Source(t, server)
+
+	mockDB := new(MockDBModel)
+	mockDB.On("GetSHAFiles").Return([]models.SHAFile{}, nil)
+	mockDB.On("InsertSHAFile", mock.Anything).Return(nil)
+	fileManager := NewFileManagerFromSource(source, mockDB).WithLifecycle(Lifecycle{
+		Archive:       true,
+		ProcessedDir:  "processed",
+		QuarantineDir: "quarantine",
+		Include:       []string{"*.csv"},
+	})
+
+	files, err := fileManager.GetFilesToUpload(context.Background())
+	assert.NoError(t, err)
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"s3://exports/bank/march.csv",
+		"s3://exports/bank/joint/april.csv",
+	}, paths)
+
+	// the checksum is calculated from the object content
+	sum, err := source.Checksum(context.Background(), "s3://exports/bank/march.csv")
+	assert.NoError(t, err)
+	expected := sha256.Sum256([]byte("march"))
+	assert.Equal(t, hex.EncodeToString(expected[:]), sum)
+
+	reader, err := fileManager.Open(context.Background(), models.SHAFile{Path: "s3://exports/bank/march.csv"})
+	assert.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "march", string(content))
+
+	_, err = source.Open(context.Background(), "s3://exports/bank/missing.csv")
+	assert.Error(t, err)
+	_, err = source.Open(context.Background(), "s3://other/bank/march.csv")
+	assert.Error(t, err)
+
+	importedAt := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, fileManager.MarkProcessed(context.Background(), "s3://exports/bank/march.csv", importedAt))
+	assert.NoError(t, fileManager.Quarantine(context.Background(), "s3://exports/bank/joint/april.csv", "abc",
+		errors.New("error reading header: EOF")))
+
+	keys := fake.keys()
+	assert.Contains(t, keys, "bank/processed/2025/03/march.csv")
+	assert.Contains(t, keys, "bank/quarantine/april.csv")
+	assert.NotContains(t, keys, "bank/march.csv")
+	assert.NotContains(t, keys, "bank/joint/april.csv")
+
+	var report quarantineReport
+	assert.NoError(t, json.Unmarshal(fake.objects["bank/quarantine/april.csv.error.json"], &report))
+	assert.Equal(t, "s3://exports/bank/joint/april.csv", report.File)
+	assert.Equal(t, "error reading header: EOF", report.Error)
+
+	// nothing is left to import
+	files, err = NewFileManagerFromSource(source, mockDB).GetFilesToUpload(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
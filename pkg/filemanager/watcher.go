@@ -0,0 +1,158 @@
+package filemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// partSuffix marks files which are still being written. Such files are
+// ignored until they are renamed to their final name.
+const partSuffix = ".part"
+
+// pendingFile holds the state of a file which was changed recently
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	seenAt  time.Time
+}
+
+// Watcher struct that holds the watched directory and the settle time after
+// which a file without changes of its size and mtime is considered complete
+type Watcher struct {
+	dir     string
+	skip    []string // lifecycle directories
+	settle  time.Duration
+	logger  *zap.SugaredLogger
+	pending map[string]pendingFile
+}
+
+// NewWatcher returns a new Watcher for the given directory
+func NewWatcher(dir string, settle time.Duration) *Watcher {
+	return &Watcher{
+		dir:     dir,
+		settle:  settle,
+		logger:  zap.S().With("package", "filemanager"),
+		pending: make(map[string]pendingFile),
+	}
+}
+
+// WithLifecycle returns the watcher skipping the lifecycle directories, the
+// files moved there are imported already
+func (w *Watcher) WithLifecycle(lifecycle Lifecycle) *Watcher {
+	for _, dir := range []string{lifecycle.ProcessedDir, lifecycle.QuarantineDir} {
+		if dir != "" {
+			w.skip = append(w.skip, lifecycleDir(w.dir, dir))
+		}
+	}
+	return w
+}
+
+// Run watches the directory recursively and calls trigger every time new
+// files are completely written. It blocks until the context is cancelled.
+func (w *Watcher) Run(ctx context.Context, trigger func()) error {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsWatcher.Close()
+
+	if err := w.addRecursive(fsWatcher, w.dir); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(max(w.settle/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+			w.handleEvent(fsWatcher, event)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger.Error("Error watching input directory", zap.Error(err))
+		case now := <-ticker.C:
+			if w.checkPending(now) {
+				trigger()
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// addRecursive adds the directory and all its sub directories except the
+// lifecycle directories to the watcher
+func (w *Watcher) addRecursive(fsWatcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if slices.Contains(w.skip, filepath.Clean(path)) {
+			return filepath.SkipDir
+		}
+		return fsWatcher.Add(path)
+	})
+}
+
+// handleEvent remembers created and written files. New directories are
+// added to the watcher.
+func (w *Watcher) handleEvent(fsWatcher *fsnotify.Watcher, event fsnotify.Event) {
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		if err := w.addRecursive(fsWatcher, event.Name); err != nil {
+			w.logger.Error("Error watching directory", zap.Error(err))
+		}
+		return
+	}
+	if strings.HasSuffix(event.Name, partSuffix) {
+		return
+	}
+	w.pending[event.Name] = pendingFile{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		seenAt:  time.Now(),
+	}
+}
+
+// checkPending returns true if at least one pending file has the same size
+// and mtime for the settle time. Such files are removed from the pending list.
+func (w *Watcher) checkPending(now time.Time) bool {
+	ready := false
+	for path, file := range w.pending {
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path)
+			continue
+		}
+		if info.Size() != file.size || !info.ModTime().Equal(file.modTime) {
+			w.pending[path] = pendingFile{size: info.Size(), modTime: info.ModTime(), seenAt: now}
+			continue
+		}
+		if now.Sub(file.seenAt) >= w.settle {
+			delete(w.pending, path)
+			ready = true
+		}
+	}
+	return ready
+}
@@ -0,0 +1,110 @@
+package filemanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	tempDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	triggered := make(chan struct{}, 10)
+	watcher := NewWatcher(tempDir, 100*time.Millisecond)
+	done := make(chan error)
+	go func() {
+		done <- watcher.Run(ctx, func() { triggered <- struct{}{} })
+	}()
+	// give the watcher time to register the directory
+	time.Sleep(50 * time.Millisecond)
+
+	// partially written files don't trigger an import
+	partFile := filepath.Join(tempDir, "export.csv.part")
+	assert.NoError(t, os.WriteFile(partFile, []byte("Buchungsdatum"), 0644))
+	select {
+	case <-triggered:
+		t.Fatal("import triggered by a .part file")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// renaming to the final name triggers an import
+	assert.NoError(t, os.Rename(partFile, filepath.Join(tempDir, "export.csv")))
+	select {
+	case <-triggered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("import wasn't triggered")
+	}
+
+	// files in new sub directories are watched as well
+	subDir := filepath.Join(tempDir, "joint")
+	assert.NoError(t, os.Mkdir(subDir, 0755))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(filepath.Join(subDir, "export.csv"), []byte("Buchungsdatum"), 0644))
+	select {
+	case <-triggered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("import wasn't triggered for a sub directory")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestWatcherSkipsLifecycleDirs(t *testing.T) {
+	tempDir := t.TempDir()
+	processedDir := filepath.Join(tempDir, "processed", "2025", "03")
+	assert.NoError(t, os.MkdirAll(processedDir, 0755))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	triggered := make(chan struct{}, 10)
+	watcher := NewWatcher(tempDir, 100*time.Millisecond).
+		WithLifecycle(Lifecycle{ProcessedDir: "processed", QuarantineDir: "quarantine"})
+	done := make(chan error)
+	go func() {
+		done <- watcher.Run(ctx, func() { triggered <- struct{}{} })
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// archived files and new quarantine directories don't trigger an import
+	assert.NoError(t, os.WriteFile(filepath.Join(processedDir, "export.csv"), []byte("Buchungsdatum"), 0644))
+	quarantineDir := filepath.Join(tempDir, "quarantine")
+	assert.NoError(t, os.Mkdir(quarantineDir, 0755))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(filepath.Join(quarantineDir, "broken.csv"), []byte("x"), 0644))
+	select {
+	case <-triggered:
+		t.Fatal("import triggered by a lifecycle directory")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestCheckPending(t *testing.T) {
+	tempDir := t.TempDir()
+	file := filepath.Join(tempDir, "export.csv")
+	assert.NoError(t, os.WriteFile(file, []byte("a"), 0644))
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	watcher := NewWatcher(tempDir, time.Second)
+	watcher.pending[file] = pendingFile{size: info.Size(), modTime: info.ModTime(), seenAt: now}
+
+	// not settled yet
+	assert.False(t, watcher.checkPending(now.Add(500*time.Millisecond)))
+	// the file grows, the settle time starts again
+	assert.NoError(t, os.WriteFile(file, []byte("ab"), 0644))
+	assert.False(t, watcher.checkPending(now.Add(1100*time.Millisecond)))
+	assert.False(t, watcher.checkPending(now.Add(1500*time.Millisecond)))
+	assert.True(t, watcher.checkPending(now.Add(2200*time.Millisecond)))
+	assert.Empty(t, watcher.pending)
+}
@@ -18,7 +18,9 @@ func WaitForShutdown(ctx context.Context) {
 	for {
 		select {
 		case <-sigs:
-			// wait for system signal && initialize termination in that case
+			// wait for system signal && initialize termination in that case,
+			// a second signal kills the process without waiting for the jobs
+			signal.Stop(sigs)
 			log.Print("waiting for the context to be cancelled")
 			return
 		case <-ctx.Done():
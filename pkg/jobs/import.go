@@ -0,0 +1,177 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/filemanager"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// ImportReport struct that holds the result of a one-shot import
+type ImportReport struct {
+	DryRun  bool
+	Imports []models.Import
+	// Duplicates are the files which were imported before
+	Duplicates []string
+}
+
+// Failed checks whether any file couldn't be parsed or stored
+func (r *ImportReport) Failed() bool {
+	for _, imp := range r.Imports {
+		if imp.Status != models.ImportStatusSuccess {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the report as a table
+func (r *ImportReport) Print(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "FILE\tSTATUS\tROWS\tINSERTED\tERROR")
+	for _, imp := range r.Imports {
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%s\n", imp.Path, imp.Status, imp.RowsTotal, imp.RowsInserted, imp.Error)
+	}
+	for _, path := range r.Duplicates {
+		fmt.Fprintf(table, "%s\tduplicate\t0\t0\t\n", path)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	if r.DryRun {
+		_, err := fmt.Fprintln(w, "dry run, nothing was stored")
+		return err
+	}
+	return nil
+}
+
+// Names of the one-shot imports in the metrics
+const (
+	importerCLI    = "cli"
+	importerUpload = "upload"
+)
+
+var (
+	// ErrLocked is returned while another instance runs an import
+	ErrLocked = errors.New("import is running on another instance")
+	// ErrUnknownAccount is returned for an upload to an account which isn't
+	// configured
+	ErrUnknownAccount = errors.New("unknown account")
+)
+
+// accountCheckKey is the context key of the account check of an import
+type accountCheckKey struct{}
+
+// WithAccountCheck returns the context of an import which stores only the
+// files of the accounts allowed by check, the files of other accounts fail
+func WithAccountCheck(ctx context.Context, check func(accountID string) bool) context.Context {
+	return context.WithValue(ctx, accountCheckKey{}, check)
+}
+
+// accountAllowed checks whether the files of the account may be stored by
+// the import of ctx
+func accountAllowed(ctx context.Context, accountID string) bool {
+	check, ok := ctx.Value(accountCheckKey{}).(func(string) bool)
+	return !ok || check(accountID)
+}
+
+// uploadKey is the context key of the account of an upload
+type uploadKey struct{}
+
+// WithUpload returns the context of an import of uploaded files, which is
+// counted under the upload importer in the metrics. The files are stored
+// under the account, their account is resolved for an empty one.
+func WithUpload(ctx context.Context, accountID string) context.Context {
+	return context.WithValue(ctx, uploadKey{}, accountID)
+}
+
+// uploadAccount returns the account of the upload of ctx and whether the
+// import is an upload
+func uploadAccount(ctx context.Context) (string, bool) {
+	accountID, ok := ctx.Value(uploadKey{}).(string)
+	return accountID, ok
+}
+
+// Import runs a single import pass over the files and directories and
+// returns its report. The files stay in place. With dryRun the files are
+// parsed and categorised, but nothing is stored, otherwise the import
+// holds the lock of the import job.
+func (j *Job) Import(ctx context.Context, paths []string, dryRun bool) (*ImportReport, error) {
+	importLock := j.newLock(config.JobImport)
+	if dryRun || importLock == nil {
+		return j.importPaths(ctx, paths, dryRun)
+	}
+
+	var (
+		report    *ImportReport
+		importErr error
+	)
+	ran, err := importLock.Run(ctx, func(ctx context.Context) {
+		report, importErr = j.importPaths(ctx, paths, false)
+	})
+	switch {
+	case !ran && err == nil:
+		return nil, ErrLocked
+	case importErr != nil:
+		return report, importErr
+	case err != nil:
+		return report, fmt.Errorf("error locking import: %w", err)
+	}
+	return report, nil
+}
+
+// importPaths runs the import pass of Import
+func (j *Job) importPaths(ctx context.Context, paths []string, dryRun bool) (*ImportReport, error) {
+	importer := importerCLI
+	if accountID, ok := uploadAccount(ctx); ok {
+		importer = importerUpload
+		if accountID != "" && !j.accounts.Known(accountID) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownAccount, accountID)
+		}
+	}
+	openStore := j.openStore
+	if dryRun {
+		openStore = j.openPreviewStore
+	}
+	store, closeStore, err := openStore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error opening storage: %w", err)
+	}
+	defer closeStore()
+
+	for _, account := range j.accounts.Accounts() {
+		if err := store.InsertAccount(ctx, account); err != nil {
+			j.logger.Error("Error saving account", zap.Error(err))
+		}
+	}
+
+	fileMgr := j.newPathFileManager(store, paths)
+	files, err := j.importFiles(ctx, store, fileMgr, importer)
+
+	report := &ImportReport{DryRun: dryRun}
+	for _, file := range files {
+		report.Imports = append(report.Imports, file.imp)
+	}
+	for _, file := range fileMgr.GetDuplicateFiles() {
+		report.Duplicates = append(report.Duplicates, file.Name())
+	}
+	return report, err
+}
+
+// newPathFileManager returns the FileManager of the files and directories
+// given on the command line, the include and exclude patterns apply to the
+// files of the directories
+func (j *Job) newPathFileManager(store models.Store, paths []string) *filemanager.FileManager {
+	return filemanager.NewFileManagerFromSource(filemanager.NewPathSource(paths), store).
+		WithLifecycle(filemanager.Lifecycle{
+			Include: j.config.Lifecycle.Include,
+			Exclude: j.config.Lifecycle.Exclude,
+		})
+}
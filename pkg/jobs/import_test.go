@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/lock"
+	"github.com/13excite/c24-expense/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// newImportJob returns a job with a local store and an input directory
+// with two copies of the mock export
+func newImportJob(t *testing.T) (*Job, string) {
+	inputDir := t.TempDir()
+	mock, err := os.ReadFile("../../testdata/transaction.csv.mock")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "march.csv"), mock, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "copy.csv"), mock, 0644))
+
+	conf := &config.Config{}
+	conf.Defaults()
+	conf.Storage = config.StorageLocal
+	conf.LocalStore.Path = filepath.Join(t.TempDir(), "store.json")
+	conf.Lock.Dir = t.TempDir()
+	return New(conf), inputDir
+}
+
+func TestImport(t *testing.T) {
+	job, inputDir := newImportJob(t)
+
+	report, err := job.Import(context.Background(), []string{inputDir}, false)
+	assert.NoError(t, err)
+	assert.False(t, report.Failed())
+	assert.Len(t, report.Imports, 1)
+	assert.Equal(t, 55, report.Imports[0].RowsInserted)
+	assert.Len(t, report.Duplicates, 1)
+	// the files stay in place
+	assert.FileExists(t, filepath.Join(inputDir, "march.csv"))
+
+	var out bytes.Buffer
+	assert.NoError(t, report.Print(&out))
+	assert.Contains(t, out.String(), "duplicate")
+
+	broken := filepath.Join(t.TempDir(), "broken.csv")
+	assert.NoError(t, os.WriteFile(broken, nil, 0644))
+	report, err = job.Import(context.Background(), []string{broken}, false)
+	assert.NoError(t, err)
+	assert.True(t, report.Failed())
+}
+
+func TestImportUpload(t *testing.T) {
+	job, inputDir := newImportJob(t)
+	job.config.Accounts = []config.AccountConfig{{ID: "joint"}}
+	m := metrics.New()
+	job = New(job.config).WithMetrics(m)
+
+	_, err := job.Import(WithUpload(context.Background(), "unknown"), []string{inputDir}, false)
+	assert.ErrorIs(t, err, ErrUnknownAccount)
+
+	report, err := job.Import(WithUpload(context.Background(), "joint"), []string{inputDir}, false)
+	assert.NoError(t, err)
+	assert.False(t, report.Failed())
+	store, err := localstore.New(job.config.LocalStore.Path)
+	assert.NoError(t, err)
+	txns, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, txns)
+	for _, txn := range txns {
+		assert.Equal(t, "joint", txn.AccountID)
+	}
+
+	// the upload is counted under its own importer
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `c24_import_files_total{importer="upload",status="success"} 1`)
+}
+
+func TestImportDryRun(t *testing.T) {
+	job, inputDir := newImportJob(t)
+
+	report, err := job.Import(context.Background(), []string{inputDir}, true)
+	assert.NoError(t, err)
+	assert.Len(t, report.Imports, 1)
+	assert.Equal(t, 55, report.Imports[0].RowsInserted)
+
+	store, err := localstore.New(job.config.LocalStore.Path)
+	assert.NoError(t, err)
+	txns, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, txns)
+	files, err := store.GetSHAFiles(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestImportLocked(t *testing.T) {
+	job, inputDir := newImportJob(t)
+	other := lock.NewFileLock(filepath.Join(job.config.Lock.Dir, "import.lock"), time.Minute)
+	held, err := other.TryAcquire()
+	assert.NoError(t, err)
+	assert.True(t, held)
+
+	_, err = job.Import(context.Background(), []string{inputDir}, false)
+	assert.ErrorIs(t, err, ErrLocked)
+	// the dry run doesn't need the lock
+	_, err = job.Import(context.Background(), []string{inputDir}, true)
+	assert.NoError(t, err)
+
+	assert.NoError(t, other.Release())
+	report, err := job.Import(context.Background(), []string{inputDir}, false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Imports, 1)
+	assert.NoFileExists(t, filepath.Join(job.config.Lock.Dir, "import.lock"))
+}
@@ -4,15 +4,22 @@ package jobs
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/13excite/c24-expense/pkg/accounts"
 	"github.com/13excite/c24-expense/pkg/c24parser"
 	"github.com/13excite/c24-expense/pkg/config"
-	"github.com/13excite/c24-expense/pkg/driver"
 	"github.com/13excite/c24-expense/pkg/filemanager"
+	"github.com/13excite/c24-expense/pkg/metrics"
 	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/retry"
+	"github.com/13excite/c24-expense/pkg/scheduler"
+	"github.com/13excite/c24-expense/pkg/storage"
+	"github.com/13excite/c24-expense/pkg/transfers"
 )
 
 // type parser interface {
@@ -21,69 +28,339 @@ import (
 
 // Job struct that holds the logger, parser and configuration of the job
 type Job struct {
-	logger *zap.SugaredLogger
-	config *config.Config
+	logger    *zap.SugaredLogger
+	config    *config.Config
+	accounts  *accounts.Resolver
+	transfers *transfers.Detector
+	// hashCache keeps the file hashes between the runs
+	hashCache *filemanager.HashCache
+	// store is shared by the runs if set, otherwise every run opens its own
+	store models.Store
+	// policy and breaker guard the storage operations against outages
+	policy  retry.Policy
+	breaker *retry.Breaker
+	metrics *metrics.Metrics
 }
 
 // New returns a new Job struct
 func New(conf *config.Config) *Job {
+	resolver := accounts.NewResolver(conf)
 	return &Job{
-		config: conf,
-		logger: zap.S().With("package", "job"),
+		config:    conf,
+		logger:    zap.S().With("package", "job"),
+		accounts:  resolver,
+		transfers: transfers.NewDetector(resolver, conf.InternalTransferWindow),
+		hashCache: filemanager.NewHashCache(),
+		policy:    storage.RetryPolicy(conf),
+		breaker:   storage.NewBreaker(conf),
+		metrics:   metrics.New(),
 	}
 }
 
-func (j *Job) parserRunner() {
+// Breaker returns the circuit breaker of the storage operations
+func (j *Job) Breaker() *retry.Breaker {
+	return j.breaker
+}
+
+// withRetry calls fn with the backoff of the storage operations while the
+// circuit breaker lets the calls pass
+func (j *Job) withRetry(ctx context.Context, fn func() error) error {
+	return j.breaker.Do(ctx, j.policy, fn)
+}
+
+// withInsertRetry calls fn like withRetry, but inserts into ClickHouse are
+// called once. It can't roll back an insert whose response was lost, so
+// a retry could store the rows twice while the first insert is still
+// running. The file is imported again by the next run instead, which
+// skips the stored hashes.
+func (j *Job) withInsertRetry(ctx context.Context, fn func() error) error {
+	policy := j.policy
+	if j.config.Storage == config.StorageClickhouse || j.config.Storage == "" {
+		policy.Attempts = 1
+	}
+	return j.breaker.Do(ctx, policy, fn)
+}
+
+// finishTimeout bounds the bookkeeping of a run stopped by the shutdown
+const finishTimeout = 10 * time.Second
+
+// detached returns a context which isn't cancelled together with ctx, so
+// a run stopped by the shutdown can still save its bookkeeping within
+// finishTimeout
+func detached(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+}
+
+// WithMetrics makes the runs record the imports to the metrics, which are
+// usually exposed by the metrics server
+func (j *Job) WithMetrics(m *metrics.Metrics) *Job {
+	j.metrics = m
+	return j
+}
+
+// WithStore makes the runs use the store instead of opening a new one
+func (j *Job) WithStore(store models.Store) *Job {
+	j.store = store
+	return j
+}
+
+// parserRunner imports the new files of the input source and archives them
+func (j *Job) parserRunner(ctx context.Context, store models.Store) (runStats, error) {
 	j.logger.Debug("Starting parserRunner at ", time.Now().Format(time.RFC3339))
-	// job runs not so often, so we can afford to create a new connection every time
-	conn, err := driver.OpenDB(j.config.Clickhouse.Username,
-		j.config.Clickhouse.Password, j.config.Clickhouse.Address, j.config.Clickhouse.Database)
-	if err != nil {
-		j.logger.Error("Error opening database connection", zap.Error(err))
-		return
+	for _, account := range j.accounts.Accounts() {
+		if err := store.InsertAccount(ctx, account); err != nil {
+			j.logger.Error("Error saving account", zap.Error(err))
+		}
 	}
-	defer conn.Close()
 
-	model := models.NewModel(conn)
+	fileMgr, err := j.newFileManager(store)
+	if err != nil {
+		return runStats{}, fmt.Errorf("error opening input source: %w", err)
+	}
+	files, err := j.importFiles(ctx, store, fileMgr, j.importer())
+	stats := runStats{files: len(files)}
+	failed := 0
+	for _, file := range files {
+		stats.rows += file.imp.RowsInserted
+		if file.imp.Status != models.ImportStatusSuccess {
+			failed++
+		}
+	}
+	// a stopped run may have left entries of an archive behind, the files
+	// are archived as duplicates by the next run instead
+	if err != nil {
+		return stats, fmt.Errorf("import pipeline stopped: %w", err)
+	}
+	paths, results := worstImports(files)
+	for _, path := range paths {
+		j.archiveFile(ctx, fileMgr, path, results[path])
+	}
+	// files which were imported before are archived as well, copies of
+	// a file of this run only once the file is imported successfully
+	imported := make(map[string]string, len(files))
+	for _, file := range files {
+		imported[file.file.SHA256] = file.imp.Status
+	}
+	for _, file := range fileMgr.GetDuplicateFiles() {
+		if _, ok := results[file.Path]; ok {
+			continue
+		}
+		if status, ok := imported[file.SHA256]; ok && status != models.ImportStatusSuccess {
+			continue
+		}
+		results[file.Path] = models.Import{Status: models.ImportStatusSuccess}
+		if err := fileMgr.MarkProcessed(ctx, file.Path, time.Now()); err != nil {
+			j.logger.Error("Error archiving file", zap.Error(err))
+		}
+	}
+	if failed > 0 {
+		return stats, fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return stats, nil
+}
 
-	fileMgr := filemanager.NewFileManager(j.config.InputDir, &model.DB)
-	files, err := fileMgr.GetFilesToUpload()
+// importFiles runs the import pipeline and saves the import records of the
+// finished files, which are returned even if the pipeline is stopped. The
+// files are counted in the metrics of the importer.
+func (j *Job) importFiles(ctx context.Context, store models.Store, fileMgr *filemanager.FileManager, importer string) ([]pipelineFile, error) {
+	files, err := j.runPipeline(ctx, store, fileMgr)
 	if err != nil {
-		j.logger.Error("Error getting files to upload", zap.Error(err))
-		return
+		j.logger.Error("Import pipeline stopped", zap.Error(err))
+	}
+	for _, file := range files {
+		j.observeImport(importer, file)
+	}
+	// the imports of the files interrupted by the shutdown are saved too
+	ctx, cancel := detached(ctx)
+	defer cancel()
+	for _, file := range files {
+		if err := store.InsertImport(ctx, file.imp); err != nil {
+			j.logger.Error("Error saving import", zap.Error(err))
+		}
 	}
+	return files, err
+}
+
+// importer returns the name of the background import in the metrics,
+// which is the configured input source
+func (j *Job) importer() string {
+	if j.config.Source == "" {
+		return config.SourceLocal
+	}
+	return j.config.Source
+}
+
+// observeImport records the imported file to the metrics
+func (j *Job) observeImport(importer string, file pipelineFile) {
+	j.metrics.ObserveImport(importer, file.imp)
+	j.metrics.ObserveSkippedRows(importer, metrics.SkipDuplicate, file.duplicates)
+	skipped := make(map[string]int)
+	for _, row := range file.skipped {
+		skipped[row.Kind]++
+	}
+	for kind, rows := range skipped {
+		j.metrics.ObserveSkippedRows(importer, kind, rows)
+	}
+	j.metrics.ObserveFallbacks(importer, file.fallbacks)
+}
 
-	csvParser := c24parser.NewParser()
+// worstImports returns the imported paths in order with the worst import of
+// each path. Archives are moved once all of their entries are imported, so
+// the worst result of the entries decides where the archive goes.
+func worstImports(files []pipelineFile) ([]string, map[string]models.Import) {
+	results := make(map[string]models.Import)
+	paths := make([]string, 0, len(files))
 	for _, file := range files {
-		if err := csvParser.ParseFile(file.Path); err != nil {
-			j.logger.Error("Error parsing file", zap.Error(err))
-			continue
+		prev, ok := results[file.file.Path]
+		if !ok {
+			paths = append(paths, file.file.Path)
 		}
-		j.logger.Info("Starts to create transaction")
-		for _, t := range csvParser.GetTransactions() {
-			err := model.DB.InsertTransaction(t)
-			if err != nil {
-				j.logger.Error("Error inserting transaction", zap.Error(err))
-				continue
-			}
+		if !ok || statusSeverity[file.imp.Status] > statusSeverity[prev.Status] {
+			results[file.file.Path] = file.imp
 		}
 	}
+	return paths, results
 }
 
-// RunBackgroundParseJob runs the background job that parses the CSV files
-func (j *Job) RunBackgroundParseJob(ctx context.Context) error {
-	j.logger.Info("Background ParseFileJob is starting with run every ", j.config.RunEvery, " minutes")
+// statusSeverity orders the import statuses from the best to the worst one
+var statusSeverity = map[string]int{
+	models.ImportStatusSuccess:     0,
+	models.ImportStatusInvalid:     1,
+	models.ImportStatusFailed:      2,
+	models.ImportStatusInterrupted: 3,
+}
 
-	ticker := time.NewTicker(time.Duration(j.config.RunEvery) * time.Minute)
+// archiveFile moves the imported file to the processed directory and the file
+// which couldn't be parsed to the quarantine. Files which failed because of
+// storage errors or were interrupted stay in the input directory.
+func (j *Job) archiveFile(ctx context.Context, fileMgr *filemanager.FileManager, path string, imp models.Import) {
+	var err error
+	switch imp.Status {
+	case models.ImportStatusSuccess:
+		err = fileMgr.MarkProcessed(ctx, path, imp.StartedAt)
+	case models.ImportStatusInvalid:
+		err = fileMgr.Quarantine(ctx, path, imp.SHA256, errors.New(imp.Error))
+	}
+	if err != nil {
+		j.logger.Error("Error archiving file", zap.Error(err))
+	}
+}
 
-	for {
-		select {
-		case <-ticker.C:
+// parseFile parses the file or the archive entry as a stream and returns
+// the id of the account it belongs to
+func (j *Job) parseFile(ctx context.Context, fileMgr *filemanager.FileManager, csvParser *c24parser.Parser, file models.SHAFile) (string, error) {
+	reader, err := fileMgr.Open(ctx, file)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer reader.Close()
 
-			j.parserRunner()
+	preamble, content := accounts.Preamble(reader)
+	return j.accounts.Resolve(file, preamble), csvParser.Parse(ctx, content)
+}
 
-		case <-ctx.Done():
-			return nil
+// newFileManager returns the FileManager of the configured input source
+// with the lifecycle settings and the shared hash cache
+func (j *Job) newFileManager(store filemanager.DBModel) (*filemanager.FileManager, error) {
+	source, err := j.newSource()
+	if err != nil {
+		return nil, err
+	}
+	return filemanager.NewFileManagerFromSource(source, store).WithLifecycle(filemanager.Lifecycle{
+		Archive:       j.config.Lifecycle.Archive,
+		ProcessedDir:  j.config.Lifecycle.ProcessedDir,
+		QuarantineDir: j.config.Lifecycle.QuarantineDir,
+		Include:       j.config.Lifecycle.Include,
+		Exclude:       j.config.Lifecycle.Exclude,
+	}).WithHashCache(j.hashCache), nil
+}
+
+// newSource returns the input source configured by source
+func (j *Job) newSource() (filemanager.Source, error) {
+	switch j.config.Source {
+	case config.SourceLocal, "":
+		return filemanager.NewLocalSource(j.config.InputDir), nil
+	case config.SourceS3:
+		return filemanager.NewS3Source(filemanager.S3Config{
+			Endpoint:  j.config.S3.Endpoint,
+			Bucket:    j.config.S3.Bucket,
+			Prefix:    j.config.S3.Prefix,
+			AccessKey: j.config.S3.AccessKey,
+			SecretKey: j.config.S3.SecretKey,
+			Region:    j.config.S3.Region,
+			UseSSL:    j.config.S3.UseSSL,
+		})
+	case config.SourceIMAP:
+		return filemanager.NewIMAPSource(filemanager.IMAPConfig{
+			Address:          j.config.IMAP.Address,
+			Username:         j.config.IMAP.Username,
+			Password:         j.config.IMAP.Password,
+			TLS:              j.config.IMAP.TLS,
+			Folder:           j.config.IMAP.Folder,
+			ProcessedFolder:  j.config.IMAP.ProcessedFolder,
+			QuarantineFolder: j.config.IMAP.QuarantineFolder,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown source %q", j.config.Source)
+	}
+}
+
+// RunBackgroundJobs runs the background jobs on their schedules until ctx
+// is cancelled. If watching is enabled, the import job also runs as soon as
+// new files appear in the input directory.
+func (j *Job) RunBackgroundJobs(ctx context.Context) error {
+	sched, err := j.newScheduler()
+	if err != nil {
+		return err
+	}
+
+	// only the local directory can be watched, other sources are polled
+	if j.config.Watch && (j.config.Source == config.SourceLocal || j.config.Source == "") {
+		watcher := filemanager.NewWatcher(j.config.InputDir, time.Duration(j.config.WatchSettle)*time.Second).
+			WithLifecycle(filemanager.Lifecycle{
+				ProcessedDir:  j.config.Lifecycle.ProcessedDir,
+				QuarantineDir: j.config.Lifecycle.QuarantineDir,
+			})
+		go func() {
+			err := watcher.Run(ctx, func() {
+				j.logger.Info("New files in the input directory, starting import")
+				sched.Trigger(config.JobImport)
+			})
+			if err != nil {
+				j.logger.Error("Error watching input directory, falling back to polling", zap.Error(err))
+			}
+		}()
+	}
+
+	return sched.Run(ctx)
+}
+
+// newScheduler returns the scheduler of the configured jobs. Jobs without
+// a schedule run every run_every minutes. A job runs only on the instance
+// holding its lock and every run is recorded.
+func (j *Job) newScheduler() (*scheduler.Scheduler, error) {
+	tasks := map[string]jobTask{
+		config.JobImport:       j.parserRunner,
+		config.JobRecategorise: j.recategorise,
+		config.JobReport:       j.report,
+		config.JobRetention:    j.retention,
+	}
+
+	sched := scheduler.New()
+	for _, jobConf := range j.config.Jobs {
+		task, ok := tasks[jobConf.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown job %q", jobConf.Name)
+		}
+		spec := jobConf.Schedule
+		if spec == "" {
+			spec = fmt.Sprintf("@every %dm", j.config.RunEvery)
+		}
+		jitter := time.Duration(jobConf.Jitter) * time.Second
+		run := j.locked(jobConf.Name, j.recorded(jobConf.Name, task))
+		if err := sched.Add(jobConf.Name, spec, jobConf.RunOnStart, jitter, run); err != nil {
+			return nil, err
 		}
 	}
+	return sched, nil
 }
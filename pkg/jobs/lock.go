@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/lock"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/scheduler"
+)
+
+// newLock returns the lock of the job, nil if locking is disabled
+func (j *Job) newLock(name string) *lock.FileLock {
+	if j.config.Lock.Dir == "" {
+		return nil
+	}
+	return lock.NewFileLock(filepath.Join(j.config.Lock.Dir, name+".lock"),
+		time.Duration(j.config.Lock.TTL)*time.Second)
+}
+
+// locked returns the task which runs only while this instance holds the
+// lock of the job, runs held by another instance are skipped. A lock which
+// can't be taken is recorded as a failed run of the job.
+func (j *Job) locked(name string, task scheduler.Task) scheduler.Task {
+	return func(ctx context.Context) {
+		jobLock := j.newLock(name)
+		if jobLock == nil {
+			task(ctx)
+			return
+		}
+		ran, err := jobLock.Run(ctx, task)
+		switch {
+		case err != nil && !ran:
+			j.logger.Error("Error locking job ", name, zap.Error(err))
+			j.recorded(name, func(context.Context, models.Store) (runStats, error) {
+				return runStats{}, fmt.Errorf("error locking job: %w", err)
+			})(ctx)
+		case err != nil:
+			// the run itself is recorded, the lock was lost or not released
+			j.logger.Error("Error locking job ", name, zap.Error(err))
+		case !ran:
+			j.logger.Info("Job ", name, " is running on another instance, skipping")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// PendingFiles returns the files and archive entries of the input source
+// which aren't imported yet. Unchanged local files aren't hashed again, but
+// the remote sources are listed on every call. The listing doesn't change
+// the source, the mailbox returns the attachments of the messages which
+// aren't processed yet without downloading them.
+func (j *Job) PendingFiles(ctx context.Context) ([]string, error) {
+	store, closeStore, err := j.openStore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error opening storage: %w", err)
+	}
+	defer closeStore()
+
+	fileMgr, err := j.newFileManager(store)
+	if err != nil {
+		return nil, fmt.Errorf("error opening input source: %w", err)
+	}
+	if paths, ok, err := fileMgr.ListPending(ctx); ok {
+		if err != nil {
+			return nil, fmt.Errorf("error listing files: %w", err)
+		}
+		return paths, nil
+	}
+	paths, err := fileMgr.ListFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %w", err)
+	}
+	pending := make([]string, 0, len(paths))
+	for _, path := range paths {
+		files, err := fileMgr.DeduplicateFile(ctx, path)
+		// like the import, files which can't be read are left for later
+		if err != nil {
+			j.logger.Error("Error hashing file ", path, zap.Error(err))
+			continue
+		}
+		for _, file := range files {
+			pending = append(pending, file.Name())
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingFiles(t *testing.T) {
+	job, inputDir := newImportJob(t)
+	job.config.InputDir = inputDir
+
+	pending, err := job.PendingFiles(context.Background())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pending)
+
+	_, err = job.Import(context.Background(), []string{inputDir}, false)
+	assert.NoError(t, err)
+	pending, err = job.PendingFiles(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,376 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/13excite/c24-expense/pkg/c24parser"
+	"github.com/13excite/c24-expense/pkg/filemanager"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/rules"
+)
+
+// pipelineFile is a file passed between the stages of the pipeline
+type pipelineFile struct {
+	file      models.SHAFile
+	accountID string
+	imp       models.Import
+	txns      []models.Transaction
+	// internal are the hashes of the stored transactions which became
+	// internal transfers because of txns, they are updated once txns
+	// are inserted
+	internal []string
+	// skipped are the rows which couldn't be parsed, duplicates and
+	// fallbacks count the rows stored before and the rows left in the
+	// fallback category
+	skipped    []c24parser.SkippedRow
+	duplicates int
+	fallbacks  int
+}
+
+// runPipeline imports the new files of the FileManager in stages connected
+// by bounded queues: discover → hash → parse → categorise → batch insert.
+// A stage blocks while the queue to the next one is full, so the memory use
+// doesn't grow with the number of files. Hashing and parsing run on several
+// workers, categorising and inserting run on one goroutine each, because
+// transfers are paired across files and must be inserted in order.
+// The imports of all finished files are returned even if the pipeline is
+// stopped by an error or the cancellation of ctx.
+func (j *Job) runPipeline(ctx context.Context, store models.Store, fileMgr *filemanager.FileManager) ([]pipelineFile, error) {
+	conf := j.config.Pipeline
+	group, ctx := errgroup.WithContext(ctx)
+
+	paths := make(chan string, conf.QueueSize)
+	group.Go(func() error {
+		defer close(paths)
+		return j.discoverStage(ctx, fileMgr, paths)
+	})
+
+	files := make(chan models.SHAFile, conf.QueueSize)
+	runWorkers(group, conf.HashWorkers, func() { close(files) }, func() error {
+		return j.hashStage(ctx, fileMgr, paths, files)
+	})
+
+	parsed := make(chan pipelineFile, conf.QueueSize)
+	runWorkers(group, conf.ParseWorkers, func() { close(parsed) }, func() error {
+		return j.parseStage(ctx, fileMgr, files, parsed)
+	})
+
+	categorised := make(chan pipelineFile, conf.QueueSize)
+	group.Go(func() error {
+		defer close(categorised)
+		return j.categoriseStage(ctx, store, parsed, categorised)
+	})
+
+	var results []pipelineFile
+	group.Go(func() error {
+		results = j.insertStage(ctx, store, fileMgr, categorised)
+		return nil
+	})
+
+	err := group.Wait()
+	return results, err
+}
+
+// runWorkers starts count workers in the group and calls done once all
+// of them returned
+func runWorkers(group *errgroup.Group, count int, done func(), worker func() error) {
+	if count < 1 {
+		count = 1
+	}
+	var wg sync.WaitGroup
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		group.Go(func() error {
+			defer wg.Done()
+			return worker()
+		})
+	}
+	go func() {
+		wg.Wait()
+		done()
+	}()
+}
+
+// send passes the item to the next stage unless ctx is cancelled first
+func send[T any](ctx context.Context, out chan<- T, item T) error {
+	// select picks a random ready case, so a free queue could win
+	// over the cancellation
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case out <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// discoverStage lists the files of the source
+func (j *Job) discoverStage(ctx context.Context, fileMgr *filemanager.FileManager, out chan<- string) error {
+	paths, err := fileMgr.ListFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing files: %w", err)
+	}
+	for _, path := range paths {
+		if err := send(ctx, out, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashStage passes the files and archive entries which weren't imported
+// before. Files which can't be read are skipped until the next run.
+func (j *Job) hashStage(ctx context.Context, fileMgr *filemanager.FileManager, in <-chan string, out chan<- models.SHAFile) error {
+	for path := range in {
+		files, err := fileMgr.DeduplicateFile(ctx, path)
+		if err != nil {
+			j.logger.Error("Error hashing file ", path, zap.Error(err))
+			continue
+		}
+		for _, file := range files {
+			if err := send(ctx, out, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseStage parses the files, files which can't be parsed are passed on
+// with the invalid import status, files of accounts the import isn't
+// allowed to store with the failed one. The files of an upload to an
+// account belong to it.
+func (j *Job) parseStage(ctx context.Context, fileMgr *filemanager.FileManager, in <-chan models.SHAFile, out chan<- pipelineFile) error {
+	for file := range in {
+		item := pipelineFile{
+			file: file,
+			imp: models.Import{
+				Path:      file.Name(),
+				SHA256:    file.SHA256,
+				StartedAt: time.Now().UTC(),
+				Status:    models.ImportStatusSuccess,
+			},
+		}
+		item.imp.ID = fmt.Sprintf("%s-%d", file.SHA256, item.imp.StartedAt.UnixNano())
+
+		csvParser := c24parser.NewParser()
+		accountID, err := j.parseFile(ctx, fileMgr, csvParser, file)
+		if upload, _ := uploadAccount(ctx); upload != "" {
+			accountID = upload
+		}
+		if err != nil {
+			// the file isn't invalid if it's the parsing which was stopped
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			j.logger.Error("Error parsing file", zap.Error(err))
+			item.imp.Status = models.ImportStatusInvalid
+			item.imp.Error = err.Error()
+		} else if !accountAllowed(ctx, accountID) {
+			j.logger.Warn("Not storing ", file.Name(), " of account ", accountID)
+			item.imp.Status = models.ImportStatusFailed
+			item.imp.Error = fmt.Sprintf("account %q isn't visible to the user", accountID)
+		} else {
+			item.accountID = accountID
+			item.txns = csvParser.GetTransactions()
+			item.imp.RowsTotal = len(item.txns)
+			item.skipped = csvParser.GetSkippedRows()
+			if len(item.skipped) > 0 {
+				j.logger.Warn("Skipped ", len(item.skipped), " rows of ", file.Name())
+			}
+		}
+		if err := send(ctx, out, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// categoriseStage resolves the account of the transactions, applies the
+// categorisation rules and overrides and detects the internal transfers.
+// Rows which were stored before are dropped, so a file whose import failed
+// halfway can be imported again. Transfers are paired with the stored
+// transactions in the date window of the file and with the transactions of
+// the earlier files of the run. The run fails if the stored transactions
+// can't be loaded.
+func (j *Job) categoriseStage(ctx context.Context, store models.Store, in <-chan pipelineFile, out chan<- pipelineFile) error {
+	categoriser := j.newCategoriser(ctx, store)
+	var (
+		run       []models.Transaction // transactions of the earlier files
+		runHashes = make(map[string]bool)
+	)
+
+	for item := range in {
+		if item.imp.Status == models.ImportStatusSuccess {
+			for i := range item.txns {
+				item.txns[i].AccountID = item.accountID
+			}
+			storedHashes, candidates, err := j.storedFor(ctx, store, item.txns)
+			if err != nil {
+				// without them every row would be inserted again
+				return fmt.Errorf("error getting stored transactions: %w", err)
+			}
+			parsed := len(item.txns)
+			item.txns = slices.DeleteFunc(item.txns, func(txn models.Transaction) bool {
+				return storedHashes[txn.Hash()]
+			})
+			item.duplicates = parsed - len(item.txns)
+			for i := range item.txns {
+				categoriser.Apply(&item.txns[i])
+				if item.txns[i].Category == c24parser.FallbackCategory {
+					item.fallbacks++
+				}
+			}
+			// earlier files of the run may be inserted already, their
+			// transactions are paired from the run
+			candidates = slices.DeleteFunc(candidates, func(txn models.Transaction) bool {
+				return runHashes[txn.Hash()]
+			})
+			pool := append(candidates, run...)
+			item.internal = j.transfers.Detect(item.txns, pool)
+			run = append(pool[len(candidates):], item.txns...)
+			for _, txn := range item.txns {
+				runHashes[txn.Hash()] = true
+			}
+		}
+		if err := send(ctx, out, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storedFor returns which of the txns are stored already and the stored
+// transactions they can be paired with as transfers
+func (j *Job) storedFor(ctx context.Context, store models.Store, txns []models.Transaction) (map[string]bool, []models.Transaction, error) {
+	if len(txns) == 0 {
+		return nil, nil, nil
+	}
+	hashes := make([]string, 0, len(txns))
+	for _, txn := range txns {
+		hashes = append(hashes, txn.Hash())
+	}
+	var stored map[string]bool
+	err := j.withRetry(ctx, func() (err error) {
+		stored, err = store.StoredHashes(ctx, hashes)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	from, to, ok := j.transfers.Range(txns)
+	if !ok {
+		return stored, nil, nil
+	}
+	external := false
+	filter := models.TransactionFilter{From: from, To: to, Internal: &external}
+	var candidates []models.Transaction
+	err = j.withRetry(ctx, func() (err error) {
+		candidates, err = store.QueryTransactions(ctx, filter, nil, 0)
+		return err
+	})
+	return stored, candidates, err
+}
+
+// newCategoriser returns the categoriser of the stored rules and overrides,
+// transactions keep the categories of the parser if they can't be loaded
+func (j *Job) newCategoriser(ctx context.Context, store models.Store) *rules.Categoriser {
+	storedRules, err := store.GetRules(ctx)
+	if err != nil {
+		j.logger.Error("Error getting categorisation rules", zap.Error(err))
+	}
+	overrides, err := store.GetOverrides(ctx)
+	if err != nil {
+		j.logger.Error("Error getting category overrides", zap.Error(err))
+	}
+	return rules.NewCategoriser(storedRules, overrides)
+}
+
+// insertStage inserts the transactions in batches of batch_size and returns
+// the files with their final import records. Failed batches are retried with
+// the backoff of the storage, except for ClickHouse, see withInsertRetry.
+// The hashes of the imported files are stored, files which failed are
+// imported again by the next run. It drains its queue
+// even if the pipeline is cancelled: the batch in flight is either committed
+// or rolled back by the storage, the rest of its file and the queued files
+// are marked as interrupted and imported again by the next run.
+func (j *Job) insertStage(ctx context.Context, store models.Store, fileMgr *filemanager.FileManager, in <-chan pipelineFile) []pipelineFile {
+	batchSize := j.config.Pipeline.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	var results []pipelineFile
+	for item := range in {
+		if ctx.Err() != nil {
+			interrupt(ctx, &item)
+		}
+		for start := 0; start < len(item.txns) && item.imp.Status == models.ImportStatusSuccess; start += batchSize {
+			if ctx.Err() != nil {
+				interrupt(ctx, &item)
+				break
+			}
+			batch := item.txns[start:min(start+batchSize, len(item.txns))]
+			err := j.withInsertRetry(ctx, func() error {
+				return store.InsertTransactions(ctx, batch)
+			})
+			if err != nil && ctx.Err() != nil {
+				interrupt(ctx, &item)
+				break
+			}
+			if err != nil {
+				j.logger.Error("Error inserting transactions", zap.Error(err))
+				item.imp.Status = models.ImportStatusFailed
+				item.imp.Error = err.Error()
+				break
+			}
+			item.imp.RowsInserted += len(batch)
+		}
+		j.finishFile(ctx, store, fileMgr, item)
+		item.imp.FinishedAt = time.Now().UTC()
+		item.txns = nil
+		results = append(results, item)
+	}
+	return results
+}
+
+// finishFile marks the internal transfers of the inserted file and stores
+// its hash. A file whose rows are all inserted is finished even if the
+// shutdown started meanwhile.
+func (j *Job) finishFile(ctx context.Context, store models.Store, fileMgr *filemanager.FileManager, item pipelineFile) {
+	if item.imp.Status != models.ImportStatusSuccess && item.imp.Status != models.ImportStatusInvalid {
+		return
+	}
+	ctx, cancel := detached(ctx)
+	defer cancel()
+
+	if len(item.internal) > 0 && item.imp.Status == models.ImportStatusSuccess {
+		if err := store.MarkInternal(ctx, item.internal); err != nil {
+			j.logger.Error("Error marking internal transfers", zap.Error(err))
+		}
+	}
+	err := j.withRetry(ctx, func() error {
+		return fileMgr.RecordFile(ctx, item.file)
+	})
+	if err != nil {
+		j.logger.Error("Error saving file hash", zap.Error(err))
+	}
+}
+
+// interrupt marks the import of the file as stopped by the cancellation of
+// ctx, its hash isn't stored, so it's imported again by the next run
+func interrupt(ctx context.Context, item *pipelineFile) {
+	item.imp.Status = models.ImportStatusInterrupted
+	item.imp.Error = fmt.Sprintf("stopped after %d of %d rows: %v",
+		item.imp.RowsInserted, len(item.txns), context.Cause(ctx))
+}
@@ -0,0 +1,363 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/accounts"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/filemanager"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPipelineJob returns a job and a FileManager for an input directory
+// with two copies of the mock export and a broken file
+func newPipelineJob(t *testing.T) (*Job, *localstore.Store, *filemanager.FileManager) {
+	inputDir := t.TempDir()
+	mock, err := os.ReadFile("../../testdata/transaction.csv.mock")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "march.csv"), mock, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "copy.csv"), mock, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "broken.csv"), nil, 0644))
+
+	conf := &config.Config{}
+	conf.Defaults()
+	conf.InputDir = inputDir
+	conf.Storage = config.StorageLocal
+	conf.Pipeline = config.PipelineConfig{HashWorkers: 2, ParseWorkers: 2, QueueSize: 1, BatchSize: 10}
+
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	fileMgr := filemanager.NewFileManager(inputDir, store).WithLifecycle(filemanager.Lifecycle{
+		Include: []string{"*.csv"},
+	})
+	return New(conf), store, fileMgr
+}
+
+func TestRunPipeline(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	assert.NoError(t, store.InsertRule(context.Background(), models.Rule{ID: "1", Pattern: "globus", Category: "Shopping", Subcategory: "Market"}))
+
+	files, err := job.runPipeline(context.Background(), store, fileMgr)
+	assert.NoError(t, err)
+
+	// the copy has the same content and is imported only once
+	assert.Len(t, files, 2)
+	assert.Len(t, fileMgr.GetDuplicateFiles(), 1)
+	statuses := make(map[string]models.Import)
+	for _, file := range files {
+		statuses[file.imp.Status] = file.imp
+	}
+	assert.Equal(t, 55, statuses[models.ImportStatusSuccess].RowsTotal)
+	assert.Equal(t, 55, statuses[models.ImportStatusSuccess].RowsInserted)
+	assert.NotEmpty(t, statuses[models.ImportStatusInvalid].Error)
+
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stored)
+	for _, txn := range stored {
+		assert.Equal(t, "main", txn.AccountID)
+		if txn.Recipient == "Globus" {
+			assert.Equal(t, "Shopping", txn.Category)
+			assert.Equal(t, "Market", txn.Subcategory)
+		}
+	}
+}
+
+func TestRunPipelineCancelled(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	files, err := job.runPipeline(ctx, store, fileMgr)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, files)
+}
+
+// flakyStore fails the inserts of transactions the given number of times
+type flakyStore struct {
+	*localstore.Store
+	failures int
+}
+
+func (s *flakyStore) InsertTransactions(ctx context.Context, txns []models.Transaction) error {
+	if s.failures != 0 {
+		s.failures--
+		return errors.New("connection refused")
+	}
+	return s.Store.InsertTransactions(ctx, txns)
+}
+
+// stoppingStore cancels the import once the first batch is inserted, like
+// a shutdown arriving during the import
+type stoppingStore struct {
+	*localstore.Store
+	stop context.CancelFunc
+}
+
+func (s *stoppingStore) InsertTransactions(ctx context.Context, txns []models.Transaction) error {
+	defer s.stop()
+	return s.Store.InsertTransactions(ctx, txns)
+}
+
+func TestRunPipelineInterrupted(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	files, _ := job.runPipeline(ctx, &stoppingStore{Store: store, stop: cancel}, fileMgr)
+	interrupted := 0
+	for _, file := range files {
+		if file.imp.Status == models.ImportStatusInterrupted {
+			interrupted++
+			assert.Equal(t, 10, file.imp.RowsInserted)
+		}
+	}
+	assert.Equal(t, 1, interrupted)
+
+	// the interrupted file is imported again, without the committed batch
+	fileMgr = filemanager.NewFileManager(job.config.InputDir, store).WithLifecycle(filemanager.Lifecycle{
+		Include: []string{"*.csv"},
+	})
+	files, err := job.runPipeline(context.Background(), store, fileMgr)
+	assert.NoError(t, err)
+	rows := 0
+	for _, file := range files {
+		if file.imp.Status == models.ImportStatusSuccess {
+			rows += file.imp.RowsInserted
+			assert.Equal(t, 10, file.duplicates)
+		}
+	}
+	assert.Equal(t, 45, rows)
+}
+
+func TestRunPipelineRetry(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	job.policy = retry.Policy{Attempts: 3, InitialDelay: time.Millisecond}
+
+	// the batch succeeds with the third attempt
+	files, err := job.runPipeline(context.Background(), &flakyStore{Store: store, failures: 2}, fileMgr)
+	assert.NoError(t, err)
+	for _, file := range files {
+		if file.imp.Status != models.ImportStatusInvalid {
+			assert.Equal(t, models.ImportStatusSuccess, file.imp.Status)
+			assert.Equal(t, 55, file.imp.RowsInserted)
+		}
+	}
+}
+
+func TestRunPipelineNoClickhouseRetry(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	job.config.Storage = config.StorageClickhouse
+	job.policy = retry.Policy{Attempts: 3, InitialDelay: time.Millisecond}
+
+	flaky := &flakyStore{Store: store, failures: 2}
+	files, err := job.runPipeline(context.Background(), flaky, fileMgr)
+	assert.NoError(t, err)
+	// the insert isn't retried, the file is imported again by the next run
+	assert.Equal(t, 1, flaky.failures)
+	for _, file := range files {
+		if file.imp.Status != models.ImportStatusInvalid {
+			assert.Equal(t, models.ImportStatusFailed, file.imp.Status)
+		}
+	}
+}
+
+func TestRunPipelineFailedFile(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	job.policy = retry.Policy{Attempts: 2, InitialDelay: time.Millisecond}
+
+	files, err := job.runPipeline(context.Background(), &flakyStore{Store: store, failures: -1}, fileMgr)
+	assert.NoError(t, err)
+	statuses := make(map[string]int)
+	for _, file := range files {
+		statuses[file.imp.Status]++
+	}
+	assert.Equal(t, map[string]int{models.ImportStatusFailed: 1, models.ImportStatusInvalid: 1}, statuses)
+
+	// only the hash of the broken file is stored, the failed file is
+	// imported again by the next run
+	hashes, err := store.GetSHAFiles(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, hashes, 1)
+
+	job.breaker = retry.NewBreaker(5, time.Minute)
+	fileMgr = filemanager.NewFileManager(job.config.InputDir, store).WithLifecycle(filemanager.Lifecycle{
+		Include: []string{"*.csv"},
+	})
+	files, err = job.runPipeline(context.Background(), store, fileMgr)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, models.ImportStatusSuccess, files[0].imp.Status)
+	assert.Equal(t, 55, files[0].imp.RowsInserted)
+}
+
+func TestRunPipelineAccounts(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	job.accounts = accounts.NewResolver(&config.Config{
+		InputDir:       job.config.InputDir,
+		DefaultAccount: "main",
+		Accounts:       []config.AccountConfig{{ID: "joint"}},
+	})
+	// the same rows exported from the joint account, the blank line only
+	// changes the checksum of the file
+	mock, err := os.ReadFile("../../testdata/transaction.csv.mock")
+	assert.NoError(t, err)
+	assert.NoError(t, os.Mkdir(filepath.Join(job.config.InputDir, "joint"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(job.config.InputDir, "joint", "march.csv"), append(mock, '\n'), 0644))
+
+	_, err = job.runPipeline(context.Background(), store, fileMgr)
+	assert.NoError(t, err)
+
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	perAccount := make(map[string]int)
+	for _, txn := range stored {
+		perAccount[txn.AccountID]++
+	}
+	assert.Equal(t, map[string]int{"main": 55, "joint": 55}, perAccount)
+}
+
+func TestRunPipelineIdenticalRows(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	// two coffees on the same day, the later export overlaps the first one
+	header := "Transaktionstyp,Buchungsdatum,Betrag,Zahlungsempfänger,IBAN,BIC,Verwendungszweck\n"
+	coffee := "Kartenzahlung,01.04.2025,\"-3,50\",Kiosk,,,\n"
+	lunch := "Kartenzahlung,02.04.2025,\"-8,00\",Canteen,,,\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(job.config.InputDir, "april-1.csv"), []byte(header+coffee+coffee), 0644))
+
+	_, err := job.runPipeline(context.Background(), store, fileMgr)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(job.config.InputDir, "april-2.csv"), []byte(header+coffee+coffee+lunch), 0644))
+	_, err = job.runPipeline(context.Background(), store, fileMgr)
+	assert.NoError(t, err)
+
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	recipients := make(map[string]int)
+	for _, txn := range stored {
+		recipients[txn.Recipient]++
+	}
+	assert.Equal(t, 2, recipients["Kiosk"])
+	assert.Equal(t, 1, recipients["Canteen"])
+}
+
+// unreadableStore fails the lookup of the stored transactions the given
+// number of times
+type unreadableStore struct {
+	*localstore.Store
+	failures int
+}
+
+func (s *unreadableStore) StoredHashes(ctx context.Context, hashes []string) (map[string]bool, error) {
+	if s.failures != 0 {
+		s.failures--
+		return nil, errors.New("connection refused")
+	}
+	return s.Store.StoredHashes(ctx, hashes)
+}
+
+// GetTransactions fails, the pipeline only looks up the transactions of the
+// imported files
+func (s *unreadableStore) GetTransactions(context.Context) ([]models.Transaction, error) {
+	return nil, errors.New("the whole table is loaded")
+}
+
+func TestRunPipelineStoredTransactions(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	job.policy = retry.Policy{Attempts: 2, InitialDelay: time.Millisecond}
+
+	// the run fails instead of inserting every row again
+	_, err := job.runPipeline(context.Background(), &unreadableStore{Store: store, failures: -1}, fileMgr)
+	assert.ErrorContains(t, err, "error getting stored transactions")
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+	// only the empty file before the failure is recorded, like in every run
+	hashes, err := store.GetSHAFiles(context.Background())
+	assert.NoError(t, err)
+	for _, hash := range hashes {
+		assert.Equal(t, "broken.csv", filepath.Base(hash.Path))
+	}
+
+	// a single failure is retried
+	job.breaker = retry.NewBreaker(5, time.Minute)
+	fileMgr = filemanager.NewFileManager(job.config.InputDir, store).WithLifecycle(filemanager.Lifecycle{
+		Include: []string{"*.csv"},
+	})
+	_, err = job.runPipeline(context.Background(), &unreadableStore{Store: store, failures: 1}, fileMgr)
+	assert.NoError(t, err)
+	stored, err = store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, stored, 55)
+}
+
+// windowStore records the filters of the transaction queries
+type windowStore struct {
+	*localstore.Store
+	filters []models.TransactionFilter
+}
+
+func (s *windowStore) QueryTransactions(ctx context.Context, filter models.TransactionFilter, after *models.Cursor, limit int) ([]models.Transaction, error) {
+	s.filters = append(s.filters, filter)
+	return s.Store.QueryTransactions(ctx, filter, after, limit)
+}
+
+func TestRunPipelineStoredTransfers(t *testing.T) {
+	job, store, fileMgr := newPipelineJob(t)
+	// the other side of the transfer to John Smith on 16.03.2025
+	received := models.Transaction{AccountID: "other", TransactionType: "SEPA", Date: "2025-03-17", Amount: 400, Recipient: "Main"}
+	assert.NoError(t, store.InsertTransactions(context.Background(), []models.Transaction{received}))
+
+	windowed := &windowStore{Store: store}
+	_, err := job.runPipeline(context.Background(), windowed, fileMgr)
+	assert.NoError(t, err)
+
+	// the candidates are loaded for the dates of the export and the window
+	assert.Len(t, windowed.filters, 1)
+	for _, filter := range windowed.filters {
+		assert.Equal(t, "2025-02-25", filter.From)
+		assert.Equal(t, "2025-07-09", filter.To)
+	}
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	for _, txn := range stored {
+		if txn.Recipient == "John Smith" || txn.Hash() == received.Hash() {
+			assert.True(t, txn.Internal, txn.Recipient)
+		}
+	}
+}
+
+func TestParserRunnerArchivesDuplicates(t *testing.T) {
+	job, store, _ := newPipelineJob(t)
+	job.config.Lifecycle.Archive = true
+	job.policy = retry.Policy{Attempts: 1}
+	inputDir := job.config.InputDir
+	processed := func() []string {
+		files, err := filepath.Glob(filepath.Join(inputDir, "processed", "*", "*", "*.csv"))
+		assert.NoError(t, err)
+		for i := range files {
+			files[i] = filepath.Base(files[i])
+		}
+		return files
+	}
+
+	// the copy stays while the file it's a duplicate of failed
+	_, err := job.parserRunner(context.Background(), &flakyStore{Store: store, failures: -1})
+	assert.Error(t, err)
+	assert.Empty(t, processed())
+	assert.FileExists(t, filepath.Join(inputDir, "march.csv"))
+	assert.FileExists(t, filepath.Join(inputDir, "copy.csv"))
+
+	job.breaker = retry.NewBreaker(5, time.Minute)
+	_, err = job.parserRunner(context.Background(), store)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"march.csv", "copy.csv"}, processed())
+}
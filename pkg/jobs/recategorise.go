@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// Recategorise applies the current rules and overrides to the stored
+// transactions at once and returns the number of changed transactions
+func (j *Job) Recategorise(ctx context.Context) (int, error) {
+	store, closeStore, err := j.openStore(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error opening storage: %w", err)
+	}
+	defer closeStore()
+
+	stats, err := j.recategorise(ctx, store)
+	return stats.rows, err
+}
+
+// recategorise applies the current rules and overrides to the stored
+// transactions, so rules created after an import take effect
+func (j *Job) recategorise(ctx context.Context, store models.Store) (runStats, error) {
+	txns, err := store.GetTransactions(ctx)
+	if err != nil {
+		return runStats{}, fmt.Errorf("error getting stored transactions: %w", err)
+	}
+	categoriser := j.newCategoriser(ctx, store)
+
+	var changed []models.Transaction
+	for _, txn := range txns {
+		if categoriser.Apply(&txn) {
+			changed = append(changed, txn)
+		}
+	}
+	if err := ctx.Err(); err != nil || len(changed) == 0 {
+		return runStats{}, err
+	}
+	if err := store.UpdateCategories(ctx, changed); err != nil {
+		return runStats{}, fmt.Errorf("error updating categories: %w", err)
+	}
+	j.logger.Info("Recategorised ", len(changed), " transactions")
+	return runStats{rows: len(changed)}, nil
+}
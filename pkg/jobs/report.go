@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// reportRow struct that holds the totals of a category in a month
+type reportRow struct {
+	Month    string
+	Category string
+	Income   float64
+	Expenses float64
+	Count    int
+}
+
+// report writes the monthly totals per category to a CSV file in
+// reports.dir, internal transfers are left out
+func (j *Job) report(ctx context.Context, store models.Store) (runStats, error) {
+	txns, err := store.GetTransactions(ctx)
+	if err != nil {
+		return runStats{}, fmt.Errorf("error getting stored transactions: %w", err)
+	}
+	path := filepath.Join(j.config.Reports.Dir, "report-"+time.Now().Format(time.DateOnly)+".csv")
+	if err := writeReport(path, buildReport(txns)); err != nil {
+		return runStats{}, fmt.Errorf("error writing report: %w", err)
+	}
+	j.logger.Info("Report written to ", path)
+	return runStats{files: 1}, nil
+}
+
+// buildReport groups the transactions by month and category
+func buildReport(txns []models.Transaction) []reportRow {
+	rows := make(map[[2]string]*reportRow)
+	for _, txn := range txns {
+		if txn.Internal || len(txn.Date) < 7 {
+			continue
+		}
+		key := [2]string{txn.Date[:7], txn.Category}
+		row, ok := rows[key]
+		if !ok {
+			row = &reportRow{Month: key[0], Category: key[1]}
+			rows[key] = row
+		}
+		if txn.Amount >= 0 {
+			row.Income += txn.Amount
+		} else {
+			row.Expenses -= txn.Amount
+		}
+		row.Count++
+	}
+
+	report := make([]reportRow, 0, len(rows))
+	for _, row := range rows {
+		report = append(report, *row)
+	}
+	sort.Slice(report, func(a, b int) bool {
+		if report[a].Month != report[b].Month {
+			return report[a].Month < report[b].Month
+		}
+		return report[a].Category < report[b].Category
+	})
+	return report
+}
+
+// writeReport writes the report rows as CSV
+func writeReport(path string, report []reportRow) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating reports directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	records := [][]string{{"month", "category", "income", "expenses", "count"}}
+	for _, row := range report {
+		records = append(records, []string{
+			row.Month,
+			row.Category,
+			strconv.FormatFloat(row.Income, 'f', 2, 64),
+			strconv.FormatFloat(row.Expenses, 'f', 2, 64),
+			strconv.Itoa(row.Count),
+		})
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return file.Close()
+}
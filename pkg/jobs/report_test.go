@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildReport(t *testing.T) {
+	report := buildReport([]models.Transaction{
+		{Date: "2025-04-02", Amount: -20, Category: "Food"},
+		{Date: "2025-03-01", Amount: 2000, Category: "Salary"},
+		{Date: "2025-03-05", Amount: -30.5, Category: "Food"},
+		{Date: "2025-03-07", Amount: 5, Category: "Food"},
+		{Date: "2025-03-09", Amount: -500, Category: "Savings", Internal: true},
+	})
+	assert.Equal(t, []reportRow{
+		{Month: "2025-03", Category: "Food", Income: 5, Expenses: 30.5, Count: 2},
+		{Month: "2025-03", Category: "Salary", Income: 2000, Count: 1},
+		{Month: "2025-04", Category: "Food", Expenses: 20, Count: 1},
+	}, report)
+}
+
+func TestWriteReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "report.csv")
+	assert.NoError(t, writeReport(path, []reportRow{
+		{Month: "2025-03", Category: "Food", Income: 5, Expenses: 30.5, Count: 2},
+	}))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "month,category,income,expenses,count\n2025-03,Food,5.00,30.50,2\n", string(content))
+}
@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// retention removes the processed and quarantined files older than
+// retention.days
+func (j *Job) retention(ctx context.Context, store models.Store) (runStats, error) {
+	if j.config.Retention.Days <= 0 {
+		return runStats{}, nil
+	}
+	fileMgr, err := j.newFileManager(store)
+	if err != nil {
+		return runStats{}, fmt.Errorf("error opening input source: %w", err)
+	}
+	before := time.Now().AddDate(0, 0, -j.config.Retention.Days)
+	removed, err := fileMgr.Prune(ctx, before)
+	if err != nil {
+		return runStats{files: removed}, fmt.Errorf("error removing old files: %w", err)
+	}
+	j.logger.Info("Removed ", removed, " files older than ", before.Format(time.DateOnly))
+	return runStats{files: removed}, nil
+}
@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/retry"
+	"github.com/13excite/c24-expense/pkg/scheduler"
+	"github.com/13excite/c24-expense/pkg/storage"
+)
+
+// runStats struct that holds the counters of a job run
+type runStats struct {
+	files int
+	rows  int
+}
+
+// jobTask is the work of a background job on the opened store
+type jobTask func(ctx context.Context, store models.Store) (runStats, error)
+
+// recorded returns the scheduler task which runs the job and saves the run
+// to the job_runs table
+func (j *Job) recorded(name string, task jobTask) scheduler.Task {
+	return func(ctx context.Context) {
+		run := models.JobRun{Job: name, StartedAt: time.Now().UTC()}
+		run.ID = fmt.Sprintf("%s-%d", name, run.StartedAt.UnixNano())
+
+		store, closeStore, err := j.openStore(ctx)
+		if err != nil {
+			j.logger.Error("Error opening storage, skipping job ", name, zap.Error(err))
+			return
+		}
+		defer closeStore()
+
+		stats, err := task(ctx, store)
+		run.FinishedAt = time.Now().UTC()
+		run.FilesProcessed, run.RowsInserted = stats.files, stats.rows
+		switch {
+		case ctx.Err() != nil:
+			run.Status = models.JobRunCancelled
+		case err != nil:
+			run.Status = models.JobRunFailed
+		default:
+			run.Status = models.JobRunSuccess
+		}
+		if err != nil {
+			run.Error = err.Error()
+			j.logger.Error("Job ", name, " failed", zap.Error(err))
+		}
+		j.metrics.ObserveJobRun(run)
+		// a cancelled run is still saved after the shutdown started
+		saveCtx, cancel := detached(ctx)
+		defer cancel()
+		err = j.withRetry(saveCtx, func() error {
+			return store.InsertJobRun(saveCtx, run)
+		})
+		if err != nil {
+			j.logger.Error("Error saving job run", zap.Error(err))
+		}
+	}
+}
+
+// openStore returns the store shared by WithStore or opens a new one with
+// the backoff of the storage operations. The returned function closes only
+// the stores opened here.
+func (j *Job) openStore(ctx context.Context) (models.Store, func(), error) {
+	if j.store != nil {
+		return j.store, func() {}, nil
+	}
+	// jobs run not so often, so we can afford to create a new connection every time
+	var store models.Store
+	err := j.withRetry(ctx, func() error {
+		var err error
+		store, err = storage.Open(j.config)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return j.metrics.Store(j.config.Storage, store), func() { store.Close() }, nil
+}
+
+// openPreviewStore returns the store of the validation and the dry run like
+// openStore, but the schema isn't migrated and the writes are discarded
+func (j *Job) openPreviewStore(ctx context.Context) (models.Store, func(), error) {
+	if j.store != nil {
+		return storage.ReadOnly(j.store), func() {}, nil
+	}
+	var store models.Store
+	err := j.withRetry(ctx, func() error {
+		var err error
+		store, err = storage.OpenExisting(ctx, j.config)
+		if errors.Is(err, storage.ErrSchemaOutdated) || errors.Is(err, storage.ErrUnknownBackend) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return storage.ReadOnly(j.metrics.Store(j.config.Storage, store)), func() { store.Close() }, nil
+}
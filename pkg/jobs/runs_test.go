@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorded(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	conf := &config.Config{}
+	conf.Defaults()
+	job := New(conf).WithStore(store)
+
+	job.recorded("import", func(context.Context, models.Store) (runStats, error) {
+		return runStats{files: 2, rows: 55}, nil
+	})(context.Background())
+	job.recorded("report", func(context.Context, models.Store) (runStats, error) {
+		return runStats{}, errors.New("disk full")
+	})(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	job.recorded("recategorise", func(ctx context.Context, _ models.Store) (runStats, error) {
+		return runStats{}, ctx.Err()
+	})(ctx)
+
+	runs, err := store.GetJobRuns(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 3)
+	byJob := make(map[string]models.JobRun)
+	for _, run := range runs {
+		byJob[run.Job] = run
+	}
+	assert.Equal(t, models.JobRunSuccess, byJob["import"].Status)
+	assert.Equal(t, 2, byJob["import"].FilesProcessed)
+	assert.Equal(t, 55, byJob["import"].RowsInserted)
+	assert.Equal(t, models.JobRunFailed, byJob["report"].Status)
+	assert.Equal(t, "disk full", byJob["report"].Error)
+	assert.Equal(t, models.JobRunCancelled, byJob["recategorise"].Status)
+	assert.False(t, byJob["import"].FinishedAt.Before(byJob["import"].StartedAt))
+}
+
+func TestLockedFailure(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	conf := &config.Config{}
+	conf.Defaults()
+	// a file where the directory of the locks should be
+	conf.Lock.Dir = filepath.Join(t.TempDir(), "locks")
+	assert.NoError(t, os.WriteFile(conf.Lock.Dir, nil, 0o644))
+	job := New(conf).WithStore(store)
+
+	ran := false
+	job.locked("import", func(context.Context) { ran = true })(context.Background())
+	assert.False(t, ran)
+
+	runs, err := store.GetJobRuns(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, models.JobRunFailed, runs[0].Status)
+	assert.Contains(t, runs[0].Error, "error locking job")
+}
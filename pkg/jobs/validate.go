@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/13excite/c24-expense/pkg/c24parser"
+)
+
+// ValidatedRow struct that holds a parsed row as it would be imported
+type ValidatedRow struct {
+	Date        string  `json:"date"`
+	Amount      float64 `json:"amount"`
+	Recipient   string  `json:"recipient"`
+	AccountID   string  `json:"account_id"`
+	Category    string  `json:"category"`
+	Subcategory string  `json:"subcategory"`
+	Internal    bool    `json:"internal"`
+	// Duplicate rows are already stored or appear earlier in the preview
+	Duplicate bool `json:"duplicate"`
+}
+
+// ValidatedFile struct that holds the preview of a file
+type ValidatedFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Duplicate files were imported before and aren't parsed again
+	Duplicate bool                   `json:"duplicate"`
+	Error     string                 `json:"error,omitempty"`
+	Rows      []ValidatedRow         `json:"rows"`
+	Skipped   []c24parser.SkippedRow `json:"skipped"`
+}
+
+// ValidationReport struct that holds the preview of an import
+type ValidationReport struct {
+	Files []ValidatedFile `json:"files"`
+}
+
+// Failed checks whether any file couldn't be read or parsed
+func (r *ValidationReport) Failed() bool {
+	for _, file := range r.Files {
+		if file.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintJSON writes the report as JSON
+func (r *ValidationReport) PrintJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Print writes the rows of every file as a table followed by its summary
+func (r *ValidationReport) Print(w io.Writer) error {
+	for _, file := range r.Files {
+		fmt.Fprintf(w, "== %s\n", file.Path)
+		switch {
+		case file.Duplicate:
+			fmt.Fprintln(w, "file was imported before")
+			continue
+		case file.Error != "":
+			fmt.Fprintln(w, "error:", file.Error)
+			continue
+		}
+
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "DATE\tAMOUNT\tRECIPIENT\tACCOUNT\tCATEGORY\tSUBCATEGORY\tSTATUS")
+		duplicates := 0
+		for _, row := range file.Rows {
+			status := "new"
+			switch {
+			case row.Duplicate:
+				status = "duplicate"
+				duplicates++
+			case row.Internal:
+				status = "internal"
+			}
+			fmt.Fprintf(table, "%s\t%.2f\t%s\t%s\t%s\t%s\t%s\n", row.Date, row.Amount,
+				row.Recipient, row.AccountID, row.Category, row.Subcategory, status)
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+		for _, skipped := range file.Skipped {
+			fmt.Fprintf(w, "skipped line %d: %s\n", skipped.Line, skipped.Reason)
+		}
+		fmt.Fprintf(w, "%d rows, %d new, %d duplicates, %d skipped\n", len(file.Rows),
+			len(file.Rows)-duplicates, duplicates, len(file.Skipped))
+	}
+	return nil
+}
+
+// Validate previews the import of the files and directories. The files go
+// through the same dedupe, parsing and categorisation as an import, but the
+// store is read-only, so nothing is changed.
+func (j *Job) Validate(ctx context.Context, paths []string) (*ValidationReport, error) {
+	store, closeStore, err := j.openPreviewStore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error opening storage: %w", err)
+	}
+	defer closeStore()
+
+	fileMgr := j.newPathFileManager(store, paths)
+	listed, err := fileMgr.ListFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %w", err)
+	}
+	stored, err := store.GetTransactions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting stored transactions: %w", err)
+	}
+	seen := make(map[string]bool, len(stored))
+	for _, txn := range stored {
+		seen[txn.Hash()] = true
+	}
+	categoriser := j.newCategoriser(ctx, store)
+
+	report := &ValidationReport{}
+	for _, path := range listed {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		files, err := fileMgr.DeduplicateFile(ctx, path)
+		if err != nil {
+			report.Files = append(report.Files, ValidatedFile{Path: path, Error: err.Error()})
+			continue
+		}
+		for _, file := range files {
+			validated := ValidatedFile{Path: file.Name(), SHA256: file.SHA256}
+			csvParser := c24parser.NewParser()
+			accountID, err := j.parseFile(ctx, fileMgr, csvParser, file)
+			if err != nil {
+				validated.Error = err.Error()
+				report.Files = append(report.Files, validated)
+				continue
+			}
+			validated.Skipped = csvParser.GetSkippedRows()
+
+			txns := csvParser.GetTransactions()
+			for i := range txns {
+				txns[i].AccountID = accountID
+				categoriser.Apply(&txns[i])
+			}
+			j.transfers.Detect(txns, stored)
+			stored = append(stored, txns...)
+
+			for _, txn := range txns {
+				hash := txn.Hash()
+				validated.Rows = append(validated.Rows, ValidatedRow{
+					Date:        txn.Date,
+					Amount:      txn.Amount,
+					Recipient:   txn.Recipient,
+					AccountID:   txn.AccountID,
+					Category:    txn.Category,
+					Subcategory: txn.Subcategory,
+					Internal:    txn.Internal,
+					Duplicate:   seen[hash],
+				})
+				seen[hash] = true
+			}
+			report.Files = append(report.Files, validated)
+		}
+	}
+	for _, file := range fileMgr.GetDuplicateFiles() {
+		report.Files = append(report.Files, ValidatedFile{Path: file.Name(), SHA256: file.SHA256, Duplicate: true})
+	}
+	return report, nil
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	job, inputDir := newImportJob(t)
+	_, err := job.Import(context.Background(), []string{filepath.Join(inputDir, "march.csv")}, false)
+	assert.NoError(t, err)
+
+	// the first row is already stored with the mock export
+	april := "Transaktionstyp,Buchungsdatum,Betrag,Zahlungsempfänger\n" +
+		"Zinszahlung,28.02.2025,\"100,99\",C24 Bank\n" +
+		"Kartenzahlung,02.04.2025,\"-4,50\",SuperCafe\n" +
+		"Kartenzahlung,april,\"-4,50\",SuperCafe\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "april.csv"), []byte(april), 0644))
+
+	report, err := job.Validate(context.Background(), []string{inputDir})
+	assert.NoError(t, err)
+	assert.False(t, report.Failed())
+	assert.Len(t, report.Files, 3)
+
+	file := report.Files[0]
+	assert.Equal(t, filepath.Join(inputDir, "april.csv"), file.Path)
+	assert.Len(t, file.Rows, 2)
+	assert.True(t, file.Rows[0].Duplicate)
+	assert.False(t, file.Rows[1].Duplicate)
+	assert.Equal(t, "main", file.Rows[1].AccountID)
+	assert.Len(t, file.Skipped, 1)
+	// both copies of the mock export were imported before
+	assert.True(t, report.Files[1].Duplicate)
+	assert.True(t, report.Files[2].Duplicate)
+
+	var out bytes.Buffer
+	assert.NoError(t, report.Print(&out))
+	assert.Contains(t, out.String(), "2 rows, 1 new, 1 duplicates, 1 skipped")
+	out.Reset()
+	assert.NoError(t, report.PrintJSON(&out))
+	var decoded ValidationReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, *report, decoded)
+
+	// nothing is stored by the preview
+	store, err := localstore.New(job.config.LocalStore.Path)
+	assert.NoError(t, err)
+	files, err := store.GetSHAFiles(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
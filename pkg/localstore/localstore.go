@@ -0,0 +1,748 @@
+// Package localstore provides a file backed implementation of the models.Store.
+// It keeps all data in a single JSON file and is meant for small households
+// and tests where running ClickHouse is not an option.
+package localstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/13excite/c24-expense/pkg/lock"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+var _ models.Store = (*Store)(nil)
+
+// data is the on-disk layout of the store file
+type data struct {
+	Transactions []models.Transaction `json:"transactions"`
+	Accounts     []models.Account     `json:"accounts"`
+	SHAFiles     []models.SHAFile     `json:"file_hashes"`
+	Imports      []models.Import      `json:"imports"`
+	JobRuns      []models.JobRun      `json:"job_runs"`
+	Rules        []models.Rule        `json:"rules"`
+	Overrides    []models.Override    `json:"overrides"`
+	Users        []models.User        `json:"users"`
+	APITokens    []models.APIToken    `json:"api_tokens"`
+	AuditLog     []models.AuditEntry  `json:"audit_log"`
+}
+
+// Store struct that holds the path of the store file and its content
+type Store struct {
+	mu     sync.RWMutex
+	path   string
+	data   data
+	hashes map[string]struct{}
+	// info is the state of the store file when it was read or written last
+	info os.FileInfo
+}
+
+// New returns a new Store backed by the file at the given path.
+// The file is created on the first write if it doesn't exist yet.
+func New(path string) (*Store, error) {
+	s := &Store{path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the content of the store from the file. Must be called with
+// the write lock held.
+func (s *Store) load() error {
+	var (
+		loaded data
+		info   os.FileInfo
+	)
+	file, err := os.Open(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("error reading store file: %w", err)
+	default:
+		defer file.Close()
+		// the state of the opened file, a later rename doesn't change it
+		if info, err = file.Stat(); err != nil {
+			return fmt.Errorf("error reading store file: %w", err)
+		}
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return fmt.Errorf("error reading store file: %w", err)
+		}
+		if len(content) > 0 {
+			if err := json.Unmarshal(content, &loaded); err != nil {
+				return fmt.Errorf("error decoding store file: %w", err)
+			}
+		}
+	}
+	s.data = loaded
+	s.info = info
+	s.hashes = make(map[string]struct{}, len(loaded.Transactions))
+	for _, txn := range s.data.Transactions {
+		s.hashes[txn.Hash()] = struct{}{}
+	}
+	return nil
+}
+
+// reload reads the store file again if another process changed it, e.g. the
+// user command while the service runs. Otherwise the next flush would drop
+// the change. Must be called with the write lock held.
+func (s *Store) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error reading store file: %w", err)
+	}
+	switch {
+	case info == nil && s.info == nil:
+		// the file wasn't created yet
+		return nil
+	case info != nil && s.info != nil && os.SameFile(info, s.info) &&
+		info.Size() == s.info.Size() && info.ModTime().Equal(s.info.ModTime()):
+		return nil
+	}
+	return s.load()
+}
+
+// refresh reloads the store file before a read if another process changed it
+func (s *Store) refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reload()
+}
+
+// lockForWrite takes the write lock and the lock file next to the store
+// file, so no other process writes the file between the reload and the
+// flush, and reads the file again if another process changed it. The
+// returned function releases both locks.
+func (s *Store) lockForWrite() (func(), error) {
+	s.mu.Lock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	lockFile, err := lock.LockFile(s.path + ".lock")
+	if err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("error locking store file: %w", err)
+	}
+	unlock := func() {
+		lockFile.Close()
+		s.mu.Unlock()
+	}
+	if err := s.reload(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// flush writes the content of the store to a temporary file and renames it,
+// so a crash never leaves a half written store behind. The content is read
+// from the file again if it can't be written, so the change isn't kept in
+// memory only. Must be called from lockForWrite.
+func (s *Store) flush() error {
+	if err := s.write(); err != nil {
+		if loadErr := s.load(); loadErr != nil {
+			// the next reload reads the file again
+			s.info = nil
+		}
+		return err
+	}
+	return nil
+}
+
+// write replaces the store file with the content of the store
+func (s *Store) write() error {
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	// the rename keeps the state of the written file
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.info = info
+	return nil
+}
+
+// InsertTransaction stores a new transaction. Transactions which are already
+// stored are skipped silently.
+func (s *Store) InsertTransaction(ctx context.Context, txn models.Transaction) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	hash := txn.Hash()
+	if _, ok := s.hashes[hash]; ok {
+		return nil
+	}
+	s.data.Transactions = append(s.data.Transactions, txn)
+	s.hashes[hash] = struct{}{}
+	return s.flush()
+}
+
+// InsertTransactions stores the new transactions with a single write of
+// the store file. Transactions which are already stored are skipped silently.
+func (s *Store) InsertTransactions(ctx context.Context, txns []models.Transaction) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, txn := range txns {
+		hash := txn.Hash()
+		if _, ok := s.hashes[hash]; ok {
+			continue
+		}
+		s.data.Transactions = append(s.data.Transactions, txn)
+		s.hashes[hash] = struct{}{}
+	}
+	return s.flush()
+}
+
+// GetTransactions returns all stored transactions ordered by date
+func (s *Store) GetTransactions(ctx context.Context) ([]models.Transaction, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	txns := append([]models.Transaction(nil), s.data.Transactions...)
+	sort.SliceStable(txns, func(i, j int) bool {
+		return txns[i].Date < txns[j].Date
+	})
+	return txns, nil
+}
+
+// QueryTransactions returns up to limit transactions matching the filter
+// after the cursor, newest first. All of them are returned for limit 0, from
+// the first one for a nil cursor.
+func (s *Store) QueryTransactions(ctx context.Context, filter models.TransactionFilter, after *models.Cursor, limit int) ([]models.Transaction, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var txns []models.Transaction
+	for _, txn := range s.data.Transactions {
+		if filter.Match(txn) && (after == nil || after.After(txn)) {
+			txns = append(txns, txn)
+		}
+	}
+	sort.Slice(txns, func(i, j int) bool {
+		if txns[i].Date != txns[j].Date {
+			return txns[i].Date > txns[j].Date
+		}
+		return txns[i].Hash() < txns[j].Hash()
+	})
+	if limit > 0 && len(txns) > limit {
+		txns = txns[:limit]
+	}
+	return txns, nil
+}
+
+// GetTransactionByHash returns the transaction with the hash or
+// models.ErrTransactionNotFound
+func (s *Store) GetTransactionByHash(ctx context.Context, hash string) (models.Transaction, error) {
+	if err := s.refresh(); err != nil {
+		return models.Transaction{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, txn := range s.data.Transactions {
+		if txn.Hash() == hash {
+			return txn, nil
+		}
+	}
+	return models.Transaction{}, models.ErrTransactionNotFound
+}
+
+// StoredHashes returns which of the hashes belong to stored transactions
+func (s *Store) StoredHashes(ctx context.Context, hashes []string) (map[string]bool, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		wanted[hash] = true
+	}
+	stored := make(map[string]bool)
+	for _, txn := range s.data.Transactions {
+		if hash := txn.Hash(); wanted[hash] {
+			stored[hash] = true
+		}
+	}
+	return stored, nil
+}
+
+// AggregateTransactions returns the totals of the transactions matching the
+// filter grouped by month, category or recipient. Internal transfers are
+// left out like in the reports.
+func (s *Store) AggregateTransactions(ctx context.Context, filter models.TransactionFilter, by string) ([]models.TransactionGroup, error) {
+	if !models.ValidGroup(by) {
+		return nil, fmt.Errorf("unknown grouping %q", by)
+	}
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make(map[string]*models.TransactionGroup)
+	var keys []string
+	for _, txn := range s.data.Transactions {
+		if txn.Internal || !filter.Match(txn) {
+			continue
+		}
+		key := models.GroupKey(txn, by)
+		group, ok := groups[key]
+		if !ok {
+			group = &models.TransactionGroup{Key: key, Example: txn.Hash()}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.Count++
+		if txn.Amount >= 0 {
+			group.Income += txn.Amount
+		} else {
+			group.Expenses -= txn.Amount
+		}
+		if hash := txn.Hash(); hash < group.Example {
+			group.Example = hash
+		}
+	}
+	result := make([]models.TransactionGroup, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *groups[key])
+	}
+	return result, nil
+}
+
+// MarkInternal flags the transactions with the given hashes as internal transfers
+func (s *Store) MarkInternal(ctx context.Context, hashes []string) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	marked := make(map[string]struct{}, len(hashes))
+	for _, hash := range hashes {
+		marked[hash] = struct{}{}
+	}
+	for i := range s.data.Transactions {
+		if _, ok := marked[s.data.Transactions[i].Hash()]; ok {
+			s.data.Transactions[i].Internal = true
+		}
+	}
+	return s.flush()
+}
+
+// UpdateCategories stores the categories of the already stored txns
+func (s *Store) UpdateCategories(ctx context.Context, txns []models.Transaction) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	updated := make(map[string]models.Transaction, len(txns))
+	for _, txn := range txns {
+		updated[txn.Hash()] = txn
+	}
+	for i := range s.data.Transactions {
+		if txn, ok := updated[s.data.Transactions[i].Hash()]; ok {
+			s.data.Transactions[i].Category = txn.Category
+			s.data.Transactions[i].Subcategory = txn.Subcategory
+		}
+	}
+	return s.flush()
+}
+
+// UpdateTags stores the tags of the already stored txns
+func (s *Store) UpdateTags(ctx context.Context, txns []models.Transaction) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	updated := make(map[string]models.Transaction, len(txns))
+	for _, txn := range txns {
+		updated[txn.Hash()] = txn
+	}
+	for i := range s.data.Transactions {
+		if txn, ok := updated[s.data.Transactions[i].Hash()]; ok {
+			s.data.Transactions[i].Tags = append([]string(nil), txn.Tags...)
+		}
+	}
+	return s.flush()
+}
+
+// InsertAccount stores an account. An account with the same id is replaced.
+func (s *Store) InsertAccount(ctx context.Context, account models.Account) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range s.data.Accounts {
+		if s.data.Accounts[i].ID == account.ID {
+			s.data.Accounts[i] = account
+			return s.flush()
+		}
+	}
+	s.data.Accounts = append(s.data.Accounts, account)
+	return s.flush()
+}
+
+// GetAccounts returns all stored accounts ordered by id
+func (s *Store) GetAccounts(ctx context.Context) ([]models.Account, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accounts := append([]models.Account(nil), s.data.Accounts...)
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].ID < accounts[j].ID
+	})
+	return accounts, nil
+}
+
+// GetSHAFiles returns all stored file hashes
+func (s *Store) GetSHAFiles(ctx context.Context) ([]models.SHAFile, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.SHAFile(nil), s.data.SHAFiles...), nil
+}
+
+// InsertSHAFile stores a new file hash
+func (s *Store) InsertSHAFile(ctx context.Context, shaFile models.SHAFile) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.data.SHAFiles = append(s.data.SHAFiles, shaFile)
+	return s.flush()
+}
+
+// InsertImport stores the result of a file import
+func (s *Store) InsertImport(ctx context.Context, imp models.Import) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.data.Imports = append(s.data.Imports, imp)
+	return s.flush()
+}
+
+// GetImports returns all stored file imports ordered by start time
+func (s *Store) GetImports(ctx context.Context) ([]models.Import, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	imports := append([]models.Import(nil), s.data.Imports...)
+	sort.SliceStable(imports, func(i, j int) bool {
+		return imports[i].StartedAt.Before(imports[j].StartedAt)
+	})
+	return imports, nil
+}
+
+// InsertJobRun stores a finished run of a background job
+func (s *Store) InsertJobRun(ctx context.Context, run models.JobRun) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.data.JobRuns = append(s.data.JobRuns, run)
+	return s.flush()
+}
+
+// GetJobRuns returns the latest runs of the background jobs, newest first
+func (s *Store) GetJobRuns(ctx context.Context, limit int) ([]models.JobRun, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := append([]models.JobRun(nil), s.data.JobRuns...)
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+// InsertRule stores a categorisation rule. A rule with the same id is replaced.
+func (s *Store) InsertRule(ctx context.Context, rule models.Rule) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range s.data.Rules {
+		if s.data.Rules[i].ID == rule.ID {
+			s.data.Rules[i] = rule
+			return s.flush()
+		}
+	}
+	s.data.Rules = append(s.data.Rules, rule)
+	return s.flush()
+}
+
+// GetRules returns all categorisation rules ordered by priority
+func (s *Store) GetRules(ctx context.Context) ([]models.Rule, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := append([]models.Rule(nil), s.data.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+// DeleteRule removes the categorisation rule with the given id
+func (s *Store) DeleteRule(ctx context.Context, id string) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	rules := s.data.Rules[:0]
+	for _, rule := range s.data.Rules {
+		if rule.ID != id {
+			rules = append(rules, rule)
+		}
+	}
+	s.data.Rules = rules
+	return s.flush()
+}
+
+// UpsertOverride stores a manual category correction of a transaction,
+// replacing the previous one
+func (s *Store) UpsertOverride(ctx context.Context, override models.Override) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range s.data.Overrides {
+		if s.data.Overrides[i].TransactionHash == override.TransactionHash {
+			s.data.Overrides[i] = override
+			return s.flush()
+		}
+	}
+	s.data.Overrides = append(s.data.Overrides, override)
+	return s.flush()
+}
+
+// GetOverrides returns all manual category corrections
+func (s *Store) GetOverrides(ctx context.Context) ([]models.Override, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.Override(nil), s.data.Overrides...), nil
+}
+
+// UpsertUser stores a user. A user with the same name is replaced.
+func (s *Store) UpsertUser(ctx context.Context, user models.User) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range s.data.Users {
+		if s.data.Users[i].Name == user.Name {
+			s.data.Users[i] = user
+			return s.flush()
+		}
+	}
+	s.data.Users = append(s.data.Users, user)
+	return s.flush()
+}
+
+// GetUsers returns all users ordered by name
+func (s *Store) GetUsers(ctx context.Context) ([]models.User, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := append([]models.User(nil), s.data.Users...)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+	return users, nil
+}
+
+// DeleteUser removes the user with the given name
+func (s *Store) DeleteUser(ctx context.Context, name string) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	users := s.data.Users[:0]
+	for _, user := range s.data.Users {
+		if user.Name != name {
+			users = append(users, user)
+		}
+	}
+	s.data.Users = users
+	return s.flush()
+}
+
+// InsertAPIToken stores a new API token
+func (s *Store) InsertAPIToken(ctx context.Context, token models.APIToken) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.data.APITokens = append(s.data.APITokens, token)
+	return s.flush()
+}
+
+// GetAPITokens returns all API tokens ordered by creation
+func (s *Store) GetAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := append([]models.APIToken(nil), s.data.APITokens...)
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// DeleteAPIToken removes the API token with the given id
+func (s *Store) DeleteAPIToken(ctx context.Context, id string) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tokens := s.data.APITokens[:0]
+	for _, token := range s.data.APITokens {
+		if token.ID != id {
+			tokens = append(tokens, token)
+		}
+	}
+	s.data.APITokens = tokens
+	return s.flush()
+}
+
+// InsertAuditEntry appends a change made by hand to the audit log
+func (s *Store) InsertAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.data.AuditLog = append(s.data.AuditLog, entry)
+	return s.flush()
+}
+
+// GetAuditEntries returns the audit log, newest first
+func (s *Store) GetAuditEntries(ctx context.Context) ([]models.AuditEntry, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]models.AuditEntry, 0, len(s.data.AuditLog))
+	for i := len(s.data.AuditLog) - 1; i >= 0; i-- {
+		entries = append(entries, s.data.AuditLog[i])
+	}
+	return entries, nil
+}
+
+// Ping is a no-op, the file is read once by New
+func (s *Store) Ping(context.Context) error {
+	return nil
+}
+
+// CheckSchema is a no-op, the file has no schema
+func (s *Store) CheckSchema(context.Context) error {
+	return nil
+}
+
+// Close is a no-op, every write is flushed immediately
+func (s *Store) Close() error {
+	return nil
+}
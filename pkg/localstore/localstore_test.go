@@ -0,0 +1,225 @@
+package localstore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/storage/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	store, err := New(path)
+	assert.NoError(t, err)
+
+	txns := []models.Transaction{
+		{TransactionType: "Card", Date: "2025-03-04", Amount: -45.67, Recipient: "Rewe"},
+		{TransactionType: "Card", Date: "2025-03-01", Amount: -9.99, Recipient: "SuperCafe"},
+	}
+	for _, txn := range txns {
+		assert.NoError(t, store.InsertTransaction(context.Background(), txn))
+	}
+	// duplicates are skipped
+	assert.NoError(t, store.InsertTransaction(context.Background(), txns[0]))
+
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Transaction{txns[1], txns[0]}, stored)
+
+	// data survives reopening the store
+	reopened, err := New(path)
+	assert.NoError(t, err)
+	stored, err = reopened.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, stored, len(txns))
+
+	assert.NoError(t, reopened.MarkInternal(context.Background(), []string{txns[1].Hash()}))
+	stored, err = reopened.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, stored[0].Internal)
+	assert.False(t, stored[1].Internal)
+
+	recategorised := txns[0]
+	recategorised.Category = "Groceries"
+	assert.NoError(t, reopened.UpdateCategories(context.Background(), []models.Transaction{recategorised}))
+	stored, err = reopened.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Groceries", stored[1].Category)
+	assert.Empty(t, stored[0].Category)
+
+	tagged := txns[1]
+	tagged.Tags = []string{"coffee", "work"}
+	assert.NoError(t, reopened.UpdateTags(context.Background(), []models.Transaction{tagged}))
+	stored, err = reopened.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"coffee", "work"}, stored[0].Tags)
+	assert.Empty(t, stored[1].Tags)
+	// tags don't change the identity of the transaction
+	assert.Equal(t, txns[1].Hash(), stored[0].Hash())
+}
+
+func TestInsertTransactions(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+
+	txns := []models.Transaction{
+		{TransactionType: "Card", Date: "2025-03-04", Amount: -45.67, Recipient: "Rewe"},
+		{TransactionType: "Card", Date: "2025-03-01", Amount: -9.99, Recipient: "SuperCafe"},
+	}
+	assert.NoError(t, store.InsertTransaction(context.Background(), txns[0]))
+	// the already stored transaction of the batch is skipped
+	assert.NoError(t, store.InsertTransactions(context.Background(), txns))
+
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Transaction{txns[1], txns[0]}, stored)
+}
+
+func TestSHAFilesAndImports(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+
+	shaFile := models.SHAFile{Path: "file1.csv", SHA256: "abc"}
+	assert.NoError(t, store.InsertSHAFile(context.Background(), shaFile))
+	files, err := store.GetSHAFiles(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.SHAFile{shaFile}, files)
+
+	now := time.Now().UTC()
+	imports := []models.Import{
+		{ID: "2", Path: "file2.csv", StartedAt: now, Status: models.ImportStatusFailed},
+		{ID: "1", Path: "file1.csv", StartedAt: now.Add(-time.Hour), Status: models.ImportStatusSuccess},
+	}
+	for _, imp := range imports {
+		assert.NoError(t, store.InsertImport(context.Background(), imp))
+	}
+	stored, err := store.GetImports(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "1", stored[0].ID)
+	assert.Equal(t, "2", stored[1].ID)
+}
+
+func TestJobRuns(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	for i, job := range []string{"import", "report", "import"} {
+		run := models.JobRun{
+			ID:        job + "-" + string(rune('a'+i)),
+			Job:       job,
+			StartedAt: now.Add(time.Duration(i) * time.Minute),
+			Status:    models.JobRunSuccess,
+		}
+		assert.NoError(t, store.InsertJobRun(context.Background(), run))
+	}
+
+	// the newest runs come first
+	runs, err := store.GetJobRuns(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+	assert.Equal(t, "import-c", runs[0].ID)
+	assert.Equal(t, "report-b", runs[1].ID)
+}
+
+func TestRulesAndOverrides(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.InsertRule(context.Background(), models.Rule{ID: "a", Pattern: "Rewe", Category: "Groceries"}))
+	assert.NoError(t, store.InsertRule(context.Background(), models.Rule{ID: "b", Pattern: "Cafe", Category: "Restaurant_Cafe", Priority: 10}))
+	// same id replaces the rule
+	assert.NoError(t, store.InsertRule(context.Background(), models.Rule{ID: "a", Pattern: "REWE", Category: "Groceries"}))
+
+	rules, err := store.GetRules(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+	assert.Equal(t, "b", rules[0].ID)
+	assert.Equal(t, "REWE", rules[1].Pattern)
+
+	assert.NoError(t, store.DeleteRule(context.Background(), "b"))
+	rules, err = store.GetRules(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	assert.NoError(t, store.UpsertOverride(context.Background(), models.Override{TransactionHash: "h1", Category: "Rent"}))
+	assert.NoError(t, store.UpsertOverride(context.Background(), models.Override{TransactionHash: "h1", Category: "Housing"}))
+	overrides, err := store.GetOverrides(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Override{{TransactionHash: "h1", Category: "Housing"}}, overrides)
+}
+
+func TestReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+	service, err := New(path)
+	assert.NoError(t, err)
+	assert.NoError(t, service.InsertJobRun(ctx, models.JobRun{ID: "run-1", Job: "import"}))
+
+	// the user command writes the file while the service keeps it open
+	cli, err := New(path)
+	assert.NoError(t, err)
+	assert.NoError(t, cli.UpsertUser(ctx, models.User{Name: "partner", Role: models.RoleViewer}))
+
+	users, err := service.GetUsers(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	// the next write of the service keeps the user
+	assert.NoError(t, cli.DeleteUser(ctx, "partner"))
+	assert.NoError(t, cli.UpsertUser(ctx, models.User{Name: "kid", Role: models.RoleViewer}))
+	assert.NoError(t, service.InsertJobRun(ctx, models.JobRun{ID: "run-2", Job: "import"}))
+	reopened, err := New(path)
+	assert.NoError(t, err)
+	users, err = reopened.GetUsers(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "kid", users[0].Name)
+	runs, err := reopened.GetJobRuns(ctx, 10)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+}
+
+func TestConcurrentProcesses(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	// the stores stand for processes writing the same file at once
+	var wg sync.WaitGroup
+	for i := range 2 {
+		store, err := New(path)
+		assert.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				assert.NoError(t, store.InsertJobRun(ctx, models.JobRun{ID: fmt.Sprintf("run-%d-%d", i, j), Job: "import"}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	reopened, err := New(path)
+	assert.NoError(t, err)
+	runs, err := reopened.GetJobRuns(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 40)
+	// no temporary files are left behind
+	files, err := filepath.Glob(path + ".*.tmp")
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) models.Store {
+		store, err := New(filepath.Join(t.TempDir(), "store.json"))
+		assert.NoError(t, err)
+		return store
+	})
+}
@@ -0,0 +1,188 @@
+// Package lock provides the lock which keeps several instances of the
+// service from running the same job at once.
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLost is returned when the lease was taken over by another owner
+var ErrLost = errors.New("lock was taken over by another instance")
+
+// lease is the content of the lock file
+type lease struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FileLock struct that holds a lock file on a volume shared by the
+// instances. The lock is a lease which expires after the TTL unless it's
+// refreshed, so the lock of a crashed instance is taken over eventually.
+// The lease is read and written while holding the lock of a guard file.
+type FileLock struct {
+	path  string
+	owner string
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewFileLock returns a new FileLock for the lock file at the path
+func NewFileLock(path string, ttl time.Duration) *FileLock {
+	hostname, _ := os.Hostname()
+	return &FileLock{
+		path:  path,
+		owner: fmt.Sprintf("%s-%d-%08x", hostname, os.Getpid(), rand.Uint32()),
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// TryAcquire takes the lock unless another owner holds a lease which
+// hasn't expired yet and reports whether the lock is held
+func (l *FileLock) TryAcquire() (bool, error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return false, err
+	}
+	held := false
+	err := l.guarded(func() error {
+		current, err := l.read()
+		switch {
+		case errors.Is(err, fs.ErrNotExist), errors.As(err, new(*json.SyntaxError)):
+			// no lease or a broken one, which never expires otherwise
+		case err != nil:
+			return err
+		case current.Owner != l.owner && l.now().Before(current.ExpiresAt):
+			return nil
+		}
+		held = true
+		return l.write()
+	})
+	return held, err
+}
+
+// Refresh extends the lease by the TTL. ErrLost is returned if another
+// owner took the lock over.
+func (l *FileLock) Refresh() error {
+	return l.guarded(func() error {
+		current, err := l.read()
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrLost
+		}
+		if err != nil {
+			return err
+		}
+		if current.Owner != l.owner {
+			return ErrLost
+		}
+		return l.write()
+	})
+}
+
+// Release removes the lock file if the lock is held
+func (l *FileLock) Release() error {
+	return l.guarded(func() error {
+		current, err := l.read()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.Owner != l.owner {
+			return nil
+		}
+		return os.Remove(l.path)
+	})
+}
+
+// Run runs fn while holding the lock and returns false without running
+// fn if the lock is held by another owner. The lease is refreshed every
+// third of the TTL, the context of fn is cancelled if the lock is lost.
+// The lock is released once fn returned, so fn must stop when ctx is
+// cancelled.
+func (l *FileLock) Run(ctx context.Context, fn func(ctx context.Context)) (bool, error) {
+	held, err := l.TryAcquire()
+	if err != nil || !held {
+		return false, err
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		ticker := time.NewTicker(max(l.ttl/3, time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.Refresh(); err != nil {
+					cancel(err)
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	fn(ctx)
+	cancel(nil)
+	<-refreshed
+	if err := context.Cause(ctx); errors.Is(err, ErrLost) {
+		return true, err
+	}
+	return true, l.Release()
+}
+
+// guarded runs fn while holding the guard file next to the lock file, so
+// the lease isn't changed by another instance between reading and writing it
+func (l *FileLock) guarded(fn func() error) error {
+	guard, err := LockFile(l.path + ".guard")
+	if err != nil {
+		return fmt.Errorf("error locking %s: %w", l.path, err)
+	}
+	defer guard.Close()
+	return fn()
+}
+
+// write replaces the lock file with the lease of the owner. The file is
+// renamed into place, so readers never see a partial lease.
+func (l *FileLock) write() error {
+	content, err := json.Marshal(lease{Owner: l.owner, ExpiresAt: l.now().Add(l.ttl)})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
+
+// read returns the lease of the lock file
+func (l *FileLock) read() (lease, error) {
+	var current lease
+	content, err := os.ReadFile(l.path)
+	if err != nil {
+		return current, err
+	}
+	err = json.Unmarshal(content, &current)
+	return current, err
+}
@@ -0,0 +1,116 @@
+package lock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "import.lock")
+	now := time.Now()
+	first := NewFileLock(path, time.Minute)
+	second := NewFileLock(path, time.Minute)
+	first.now = func() time.Time { return now }
+	second.now = func() time.Time { return now }
+
+	held, err := first.TryAcquire()
+	assert.NoError(t, err)
+	assert.True(t, held)
+	held, err = second.TryAcquire()
+	assert.NoError(t, err)
+	assert.False(t, held)
+
+	// the lease of the first owner expires without refreshing
+	now = now.Add(2 * time.Minute)
+	held, err = second.TryAcquire()
+	assert.NoError(t, err)
+	assert.True(t, held)
+	assert.ErrorIs(t, first.Refresh(), ErrLost)
+
+	// only the owner removes the lock file
+	assert.NoError(t, first.Release())
+	assert.FileExists(t, path)
+	assert.NoError(t, second.Release())
+	assert.NoFileExists(t, path)
+
+	held, err = first.TryAcquire()
+	assert.NoError(t, err)
+	assert.True(t, held)
+}
+
+func TestFileLockContended(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "import.lock")
+	expired := NewFileLock(path, -time.Minute)
+	held, err := expired.TryAcquire()
+	assert.NoError(t, err)
+	assert.True(t, held)
+
+	// only one of the instances finding the expired lease takes it over
+	var (
+		wg    sync.WaitGroup
+		taken atomic.Int32
+	)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			held, err := NewFileLock(path, time.Minute).TryAcquire()
+			assert.NoError(t, err)
+			if held {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), taken.Load())
+	assert.ErrorIs(t, expired.Refresh(), ErrLost)
+
+	// a broken lease doesn't block the lock forever
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	held, err = NewFileLock(path, time.Minute).TryAcquire()
+	assert.NoError(t, err)
+	assert.True(t, held)
+}
+
+func TestFileLockRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "import.lock")
+	first := NewFileLock(path, 30*time.Millisecond)
+	second := NewFileLock(path, 30*time.Millisecond)
+
+	ran, err := first.Run(context.Background(), func(ctx context.Context) {
+		// the lease is refreshed while the job runs longer than the TTL
+		time.Sleep(100 * time.Millisecond)
+		held, err := second.TryAcquire()
+		assert.NoError(t, err)
+		assert.False(t, held)
+	})
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.NoFileExists(t, path)
+
+	// the job is cancelled when the lock is taken over
+	ran, err = first.Run(context.Background(), func(ctx context.Context) {
+		assert.NoError(t, os.Remove(path))
+		held, err := second.TryAcquire()
+		assert.NoError(t, err)
+		assert.True(t, held)
+		<-ctx.Done()
+	})
+	assert.ErrorIs(t, err, ErrLost)
+	assert.True(t, ran)
+	assert.FileExists(t, path)
+
+	// and it's not run while another instance holds the lock
+	ran, err = first.Run(context.Background(), func(context.Context) {
+		t.Error("job must not run")
+	})
+	assert.NoError(t, err)
+	assert.False(t, ran)
+}
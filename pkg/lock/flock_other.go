@@ -0,0 +1,12 @@
+//go:build !unix
+
+package lock
+
+import "os"
+
+// LockFile opens the file at the path, which is created if it doesn't
+// exist. Files can't be locked on this platform, so it keeps other
+// processes out only on unix.
+func LockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+}
@@ -0,0 +1,154 @@
+// Package metrics provides the Prometheus metrics of the imports, the
+// background jobs and the storage operations.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+const namespace = "c24"
+
+// Reasons of the skipped rows besides the kinds of the parser
+const (
+	// SkipDuplicate is a row which was stored before
+	SkipDuplicate = "duplicate"
+	// ParseErrorInvalidFile is a file which couldn't be parsed at all
+	ParseErrorInvalidFile = "invalid_file"
+)
+
+// Metrics struct that holds the collectors and the registry exposing them
+type Metrics struct {
+	registry *prometheus.Registry
+
+	jobRuns         *prometheus.CounterVec
+	files           *prometheus.CounterVec
+	rowsInserted    *prometheus.CounterVec
+	rowsSkipped     *prometheus.CounterVec
+	parseErrors     *prometheus.CounterVec
+	fallbacks       *prometheus.CounterVec
+	lastImport      prometheus.Gauge
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+}
+
+// New returns new Metrics registered in their own registry together with
+// the Go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		jobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_runs_total",
+			Help:      "Runs of the background jobs by job and status.",
+		}, []string{"job", "status"}),
+		files: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "import_files_total",
+			Help:      "Imported files by importer and import status.",
+		}, []string{"importer", "status"}),
+		rowsInserted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "import_rows_inserted_total",
+			Help:      "Inserted transactions by importer.",
+		}, []string{"importer"}),
+		rowsSkipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "import_rows_skipped_total",
+			Help:      "Rows which weren't inserted by importer and reason.",
+		}, []string{"importer", "reason"}),
+		parseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "parse_errors_total",
+			Help:      "Rows and files which couldn't be parsed by reason.",
+		}, []string{"reason"}),
+		fallbacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "categorisation_fallbacks_total",
+			Help:      "Transactions left in the fallback category by importer.",
+		}, []string{"importer"}),
+		lastImport: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_successful_import_timestamp_seconds",
+			Help:      "Unix time of the end of the last successful import run.",
+		}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Duration of the storage operations by backend and operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Failed storage operations by backend and operation.",
+		}, []string{"backend", "operation"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.jobRuns, m.files, m.rowsInserted, m.rowsSkipped, m.parseErrors,
+		m.fallbacks, m.lastImport, m.storageDuration, m.storageErrors,
+	)
+	return m
+}
+
+// Handler returns the handler exposing the metrics in the Prometheus format
+func (m *Metrics) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+// ObserveJobRun counts the finished run, a successful run of the import
+// job also updates the time of the last successful import
+func (m *Metrics) ObserveJobRun(run models.JobRun) {
+	m.jobRuns.WithLabelValues(run.Job, run.Status).Inc()
+	if run.Job == config.JobImport && run.Status == models.JobRunSuccess {
+		m.lastImport.Set(float64(run.FinishedAt.Unix()))
+	}
+}
+
+// ObserveImport counts the imported file and its inserted rows
+func (m *Metrics) ObserveImport(importer string, imp models.Import) {
+	m.files.WithLabelValues(importer, imp.Status).Inc()
+	m.rowsInserted.WithLabelValues(importer).Add(float64(imp.RowsInserted))
+	if imp.Status == models.ImportStatusInvalid {
+		m.parseErrors.WithLabelValues(ParseErrorInvalidFile).Inc()
+	}
+}
+
+// ObserveSkippedRows counts the rows of the importer which weren't inserted
+// for the reason, rows which couldn't be parsed count as parse errors too
+func (m *Metrics) ObserveSkippedRows(importer, reason string, rows int) {
+	if rows == 0 {
+		return
+	}
+	m.rowsSkipped.WithLabelValues(importer, reason).Add(float64(rows))
+	if reason != SkipDuplicate {
+		m.parseErrors.WithLabelValues(reason).Add(float64(rows))
+	}
+}
+
+// ObserveFallbacks counts the transactions of the importer which were left
+// in the fallback category
+func (m *Metrics) ObserveFallbacks(importer string, txns int) {
+	if txns > 0 {
+		m.fallbacks.WithLabelValues(importer).Add(float64(txns))
+	}
+}
+
+// observeStorage records the duration and the error of a storage operation
+func (m *Metrics) observeStorage(backend, operation string, start time.Time, err error) {
+	m.storageDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.storageErrors.WithLabelValues(backend, operation).Inc()
+	}
+}
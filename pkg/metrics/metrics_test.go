@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// scrape returns the metrics exposed by the handler
+func scrape(t *testing.T, m *Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func TestObserveImport(t *testing.T) {
+	m := New()
+	m.ObserveImport("local", models.Import{Status: models.ImportStatusSuccess, RowsInserted: 40})
+	m.ObserveImport("local", models.Import{Status: models.ImportStatusInvalid})
+	m.ObserveSkippedRows("local", SkipDuplicate, 15)
+	m.ObserveSkippedRows("local", "invalid_date", 2)
+	m.ObserveFallbacks("local", 3)
+	finished := time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)
+	m.ObserveJobRun(models.JobRun{Job: "import", Status: models.JobRunSuccess, FinishedAt: finished})
+	m.ObserveJobRun(models.JobRun{Job: "report", Status: models.JobRunFailed, FinishedAt: finished.Add(time.Hour)})
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `c24_import_files_total{importer="local",status="success"} 1`)
+	assert.Contains(t, body, `c24_import_files_total{importer="local",status="invalid"} 1`)
+	assert.Contains(t, body, `c24_import_rows_inserted_total{importer="local"} 40`)
+	assert.Contains(t, body, `c24_import_rows_skipped_total{importer="local",reason="duplicate"} 15`)
+	assert.Contains(t, body, `c24_import_rows_skipped_total{importer="local",reason="invalid_date"} 2`)
+	// duplicates aren't parse errors
+	assert.NotContains(t, body, `c24_parse_errors_total{reason="duplicate"}`)
+	assert.Contains(t, body, `c24_parse_errors_total{reason="invalid_date"} 2`)
+	assert.Contains(t, body, `c24_parse_errors_total{reason="invalid_file"} 1`)
+	assert.Contains(t, body, `c24_categorisation_fallbacks_total{importer="local"} 3`)
+	assert.Contains(t, body, `c24_job_runs_total{job="import",status="success"} 1`)
+	assert.Contains(t, body, `c24_job_runs_total{job="report",status="failed"} 1`)
+	assert.Contains(t, body, `c24_last_successful_import_timestamp_seconds 1.7408088e+09`)
+}
+
+// failingStore fails reading the rules
+type failingStore struct {
+	models.Store
+}
+
+func (failingStore) GetRules(context.Context) ([]models.Rule, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingStore) GetOverrides(context.Context) ([]models.Override, error) {
+	return nil, nil
+}
+
+func TestStore(t *testing.T) {
+	m := New()
+	store := m.Store("clickhouse", failingStore{})
+
+	_, err := store.GetRules(context.Background())
+	assert.Error(t, err)
+	_, err = store.GetOverrides(context.Background())
+	assert.NoError(t, err)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `c24_storage_operation_duration_seconds_count{backend="clickhouse",operation="get_rules"} 1`)
+	assert.Contains(t, body, `c24_storage_operation_duration_seconds_count{backend="clickhouse",operation="get_overrides"} 1`)
+	assert.Contains(t, body, `c24_storage_errors_total{backend="clickhouse",operation="get_rules"} 1`)
+	assert.NotContains(t, body, `c24_storage_errors_total{backend="clickhouse",operation="get_overrides"}`)
+}
@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// instrumentedStore struct that holds a store whose operations are timed
+// and whose errors are counted
+type instrumentedStore struct {
+	store   models.Store
+	metrics *Metrics
+	backend string
+}
+
+// Store returns the store with the duration and the errors of every
+// operation recorded under the backend label
+func (m *Metrics) Store(backend string, store models.Store) models.Store {
+	return &instrumentedStore{store: store, metrics: m, backend: backend}
+}
+
+// do runs the operation and records it
+func (s *instrumentedStore) do(operation string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	s.metrics.observeStorage(s.backend, operation, start, err)
+	return err
+}
+
+// query runs the operation returning a value and records it
+func query[T any](s *instrumentedStore, operation string, fn func() (T, error)) (T, error) {
+	start := time.Now()
+	value, err := fn()
+	s.metrics.observeStorage(s.backend, operation, start, err)
+	return value, err
+}
+
+func (s *instrumentedStore) InsertTransaction(ctx context.Context, txn models.Transaction) error {
+	return s.do("insert_transaction", func() error {
+		return s.store.InsertTransaction(ctx, txn)
+	})
+}
+
+func (s *instrumentedStore) InsertTransactions(ctx context.Context, txns []models.Transaction) error {
+	return s.do("insert_transactions", func() error {
+		return s.store.InsertTransactions(ctx, txns)
+	})
+}
+
+func (s *instrumentedStore) GetTransactions(ctx context.Context) ([]models.Transaction, error) {
+	return query(s, "get_transactions", func() ([]models.Transaction, error) {
+		return s.store.GetTransactions(ctx)
+	})
+}
+
+func (s *instrumentedStore) QueryTransactions(ctx context.Context, filter models.TransactionFilter, after *models.Cursor, limit int) ([]models.Transaction, error) {
+	return query(s, "query_transactions", func() ([]models.Transaction, error) {
+		return s.store.QueryTransactions(ctx, filter, after, limit)
+	})
+}
+
+func (s *instrumentedStore) AggregateTransactions(ctx context.Context, filter models.TransactionFilter, by string) ([]models.TransactionGroup, error) {
+	return query(s, "aggregate_transactions", func() ([]models.TransactionGroup, error) {
+		return s.store.AggregateTransactions(ctx, filter, by)
+	})
+}
+
+func (s *instrumentedStore) StoredHashes(ctx context.Context, hashes []string) (map[string]bool, error) {
+	return query(s, "stored_hashes", func() (map[string]bool, error) {
+		return s.store.StoredHashes(ctx, hashes)
+	})
+}
+
+// GetTransactionByHash doesn't count unknown hashes as errors of the storage
+func (s *instrumentedStore) GetTransactionByHash(ctx context.Context, hash string) (models.Transaction, error) {
+	start := time.Now()
+	txn, err := s.store.GetTransactionByHash(ctx, hash)
+	observed := err
+	if errors.Is(err, models.ErrTransactionNotFound) {
+		observed = nil
+	}
+	s.metrics.observeStorage(s.backend, "get_transaction_by_hash", start, observed)
+	return txn, err
+}
+
+func (s *instrumentedStore) MarkInternal(ctx context.Context, hashes []string) error {
+	return s.do("mark_internal", func() error {
+		return s.store.MarkInternal(ctx, hashes)
+	})
+}
+
+func (s *instrumentedStore) UpdateCategories(ctx context.Context, txns []models.Transaction) error {
+	return s.do("update_categories", func() error {
+		return s.store.UpdateCategories(ctx, txns)
+	})
+}
+
+func (s *instrumentedStore) UpdateTags(ctx context.Context, txns []models.Transaction) error {
+	return s.do("update_tags", func() error {
+		return s.store.UpdateTags(ctx, txns)
+	})
+}
+
+func (s *instrumentedStore) InsertAccount(ctx context.Context, account models.Account) error {
+	return s.do("insert_account", func() error {
+		return s.store.InsertAccount(ctx, account)
+	})
+}
+
+func (s *instrumentedStore) GetAccounts(ctx context.Context) ([]models.Account, error) {
+	return query(s, "get_accounts", func() ([]models.Account, error) {
+		return s.store.GetAccounts(ctx)
+	})
+}
+
+func (s *instrumentedStore) GetSHAFiles(ctx context.Context) ([]models.SHAFile, error) {
+	return query(s, "get_sha_files", func() ([]models.SHAFile, error) {
+		return s.store.GetSHAFiles(ctx)
+	})
+}
+
+func (s *instrumentedStore) InsertSHAFile(ctx context.Context, shaFile models.SHAFile) error {
+	return s.do("insert_sha_file", func() error {
+		return s.store.InsertSHAFile(ctx, shaFile)
+	})
+}
+
+func (s *instrumentedStore) InsertImport(ctx context.Context, imp models.Import) error {
+	return s.do("insert_import", func() error {
+		return s.store.InsertImport(ctx, imp)
+	})
+}
+
+func (s *instrumentedStore) GetImports(ctx context.Context) ([]models.Import, error) {
+	return query(s, "get_imports", func() ([]models.Import, error) {
+		return s.store.GetImports(ctx)
+	})
+}
+
+func (s *instrumentedStore) InsertJobRun(ctx context.Context, run models.JobRun) error {
+	return s.do("insert_job_run", func() error {
+		return s.store.InsertJobRun(ctx, run)
+	})
+}
+
+func (s *instrumentedStore) GetJobRuns(ctx context.Context, limit int) ([]models.JobRun, error) {
+	return query(s, "get_job_runs", func() ([]models.JobRun, error) {
+		return s.store.GetJobRuns(ctx, limit)
+	})
+}
+
+func (s *instrumentedStore) InsertRule(ctx context.Context, rule models.Rule) error {
+	return s.do("insert_rule", func() error {
+		return s.store.InsertRule(ctx, rule)
+	})
+}
+
+func (s *instrumentedStore) GetRules(ctx context.Context) ([]models.Rule, error) {
+	return query(s, "get_rules", func() ([]models.Rule, error) {
+		return s.store.GetRules(ctx)
+	})
+}
+
+func (s *instrumentedStore) DeleteRule(ctx context.Context, id string) error {
+	return s.do("delete_rule", func() error {
+		return s.store.DeleteRule(ctx, id)
+	})
+}
+
+func (s *instrumentedStore) UpsertOverride(ctx context.Context, override models.Override) error {
+	return s.do("upsert_override", func() error {
+		return s.store.UpsertOverride(ctx, override)
+	})
+}
+
+func (s *instrumentedStore) GetOverrides(ctx context.Context) ([]models.Override, error) {
+	return query(s, "get_overrides", func() ([]models.Override, error) {
+		return s.store.GetOverrides(ctx)
+	})
+}
+
+func (s *instrumentedStore) UpsertUser(ctx context.Context, user models.User) error {
+	return s.do("upsert_user", func() error {
+		return s.store.UpsertUser(ctx, user)
+	})
+}
+
+func (s *instrumentedStore) GetUsers(ctx context.Context) ([]models.User, error) {
+	return query(s, "get_users", func() ([]models.User, error) {
+		return s.store.GetUsers(ctx)
+	})
+}
+
+func (s *instrumentedStore) DeleteUser(ctx context.Context, name string) error {
+	return s.do("delete_user", func() error {
+		return s.store.DeleteUser(ctx, name)
+	})
+}
+
+func (s *instrumentedStore) InsertAPIToken(ctx context.Context, token models.APIToken) error {
+	return s.do("insert_api_token", func() error {
+		return s.store.InsertAPIToken(ctx, token)
+	})
+}
+
+func (s *instrumentedStore) GetAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	return query(s, "get_api_tokens", func() ([]models.APIToken, error) {
+		return s.store.GetAPITokens(ctx)
+	})
+}
+
+func (s *instrumentedStore) DeleteAPIToken(ctx context.Context, id string) error {
+	return s.do("delete_api_token", func() error {
+		return s.store.DeleteAPIToken(ctx, id)
+	})
+}
+
+func (s *instrumentedStore) InsertAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	return s.do("insert_audit_entry", func() error {
+		return s.store.InsertAuditEntry(ctx, entry)
+	})
+}
+
+func (s *instrumentedStore) GetAuditEntries(ctx context.Context) ([]models.AuditEntry, error) {
+	return query(s, "get_audit_entries", func() ([]models.AuditEntry, error) {
+		return s.store.GetAuditEntries(ctx)
+	})
+}
+
+func (s *instrumentedStore) Ping(ctx context.Context) error {
+	return s.do("ping", func() error {
+		return s.store.Ping(ctx)
+	})
+}
+
+func (s *instrumentedStore) CheckSchema(ctx context.Context) error {
+	return s.do("check_schema", func() error {
+		return s.store.CheckSchema(ctx)
+	})
+}
+
+func (s *instrumentedStore) Close() error {
+	return s.store.Close()
+}
@@ -3,7 +3,11 @@ package models
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"slices"
 	"time"
 )
 
@@ -26,36 +30,245 @@ func NewModel(db *sql.DB) Model {
 
 // Transaction struct that holds the transaction data
 type Transaction struct {
+	AccountID       string
 	TransactionType string
 	Date            string
 	Amount          float64
 	Recipient       string
-	Usage           string
+	IBAN            string // counterparty IBAN
+	BIC             string // counterparty BIC
+	Usage           string // usage/reference text
+	Description     string
 	Category        string
 	Subcategory     string
+	Internal        bool     // transfer between own accounts or pockets
+	Tags            []string // free form labels set by hand
+	// Occurrence counts the identical rows before this one in the export
+	Occurrence int
 }
 
-// SHAFile struct that holds the path and sha of a file for preventing duplicate uploads
+// Hash returns a stable identifier of the transaction which is used for
+// deduplication and for attaching manual overrides. The account is part of
+// it, so the same row in the exports of two accounts stays two transactions.
+// The occurrence keeps identical rows of one export apart, e.g. two coffees
+// on the same day, it's left out for the first one.
+func (t Transaction) Hash() string {
+	key := fmt.Sprintf("%s|%s|%s|%.2f|%s|%s",
+		t.AccountID, t.TransactionType, t.Date, t.Amount, t.Recipient, t.Usage)
+	if t.Occurrence > 0 {
+		key += fmt.Sprintf("|%d", t.Occurrence)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Account struct that holds an own bank account or pocket
+type Account struct {
+	ID    string
+	IBAN  string
+	Name  string
+	Bank  string
+	Owner string
+	Type  string
+}
+
+// SHAFile struct that holds the path and sha of a file for preventing duplicate uploads.
+// For entries of archives Path is the archive, Entry is the path inside of it and
+// SHA256 is derived from the archive SHA256 and the entry path.
 type SHAFile struct {
 	Path   string
+	Entry  string
 	SHA256 string
 }
 
-// InsertTransaction inserts a new txn and returns its id
-func (m *DBModel) InsertTransaction(txn Transaction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// Name returns the human readable name of the file or archive entry
+func (f SHAFile) Name() string {
+	if f.Entry == "" {
+		return f.Path
+	}
+	return f.Path + "!/" + f.Entry
+}
+
+// Import struct that holds the result of a single file import
+type Import struct {
+	ID           string
+	Path         string
+	SHA256       string
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	Status       string
+	RowsTotal    int
+	RowsInserted int
+	Error        string
+}
+
+// JobRun struct that holds a single run of a background job
+type JobRun struct {
+	ID             string    `json:"id"`
+	Job            string    `json:"job"`
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	Status         string    `json:"status"`
+	FilesProcessed int       `json:"files_processed"`
+	RowsInserted   int       `json:"rows_inserted"`
+	Error          string    `json:"error"`
+}
+
+// Rule struct that holds a user defined categorisation rule. The rule matches
+// when Pattern is a substring of the transaction recipient
+type Rule struct {
+	ID          string
+	Pattern     string
+	Category    string
+	Subcategory string
+	Priority    int
+	Accounts    []string // accounts the rule applies to, empty for all
+}
+
+// Override struct that holds a manual category correction of a single transaction
+type Override struct {
+	TransactionHash string
+	Category        string
+	Subcategory     string
+	UpdatedAt       time.Time
+}
+
+// User struct that holds a local user of the HTTP API and the web UI
+type User struct {
+	Name         string
+	PasswordHash string // bcrypt
+	Role         string
+	Accounts     []string // ids of the visible accounts, AllAccounts for all
+	CreatedAt    time.Time
+}
+
+// AllAccounts is the account id which makes all accounts visible to a user,
+// a user without accounts sees none
+const AllAccounts = "*"
+
+// CanSee checks whether the transactions of the account are visible to the user
+func (u User) CanSee(accountID string) bool {
+	return slices.Contains(u.Accounts, AllAccounts) || slices.Contains(u.Accounts, accountID)
+}
+
+// APIToken struct that holds a token of a user for scripts. Only the SHA256
+// of the token is stored.
+type APIToken struct {
+	ID        string
+	User      string
+	Name      string
+	Hash      string
+	CreatedAt time.Time
+}
+
+// AuditEntry struct that holds a change made by hand. Before and After hold
+// the JSON of the changed value, Before is empty for created values and After
+// for deleted ones.
+type AuditEntry struct {
+	ID        string    `json:"id"`
+	ChangedAt time.Time `json:"changed_at"`
+	User      string    `json:"user"`
+	Source    string    `json:"source"`
+	Entity    string    `json:"entity"`
+	EntityID  string    `json:"entity_id"`  // transaction hash or rule id
+	AccountID string    `json:"account_id"` // account of the transaction, empty for rules
+	Before    string    `json:"before"`
+	After     string    `json:"after"`
+}
+
+// Audit log entities
+const (
+	AuditOverride = "override" // category of a transaction
+	AuditTags     = "tags"     // tags of a transaction
+	AuditRule     = "rule"
+)
+
+// Audit log sources
+const (
+	AuditSourceCLI = "cli"
+	AuditSourceAPI = "api"
+	AuditSourceUI  = "ui"
+)
+
+// User roles, every role can do everything of the roles before it
+const (
+	RoleViewer = "viewer" // reads transactions
+	RoleEditor = "editor" // corrects categories and tags, creates rules, uploads
+	RoleAdmin  = "admin"  // manages users and tokens
+)
+
+// Import statuses
+const (
+	ImportStatusSuccess     = "success"
+	ImportStatusFailed      = "failed"      // rows couldn't be stored
+	ImportStatusInvalid     = "invalid"     // file couldn't be parsed
+	ImportStatusInterrupted = "interrupted" // stopped by the shutdown
+)
+
+// Job run statuses
+const (
+	JobRunSuccess   = "success"
+	JobRunFailed    = "failed"
+	JobRunCancelled = "cancelled" // stopped by the shutdown
+)
+
+// Store is the interface every storage backend has to implement
+type Store interface {
+	InsertTransaction(ctx context.Context, txn Transaction) error
+	InsertTransactions(ctx context.Context, txns []Transaction) error
+	GetTransactions(ctx context.Context) ([]Transaction, error)
+	// QueryTransactions returns a page of the transactions matching the
+	// filter, newest first, see Cursor
+	QueryTransactions(ctx context.Context, filter TransactionFilter, after *Cursor, limit int) ([]Transaction, error)
+	AggregateTransactions(ctx context.Context, filter TransactionFilter, by string) ([]TransactionGroup, error)
+	GetTransactionByHash(ctx context.Context, hash string) (Transaction, error)
+	// StoredHashes returns which of the hashes belong to stored transactions
+	StoredHashes(ctx context.Context, hashes []string) (map[string]bool, error)
+	MarkInternal(ctx context.Context, hashes []string) error
+	UpdateCategories(ctx context.Context, txns []Transaction) error
+	UpdateTags(ctx context.Context, txns []Transaction) error
+	InsertAccount(ctx context.Context, account Account) error
+	GetAccounts(ctx context.Context) ([]Account, error)
+	GetSHAFiles(ctx context.Context) ([]SHAFile, error)
+	InsertSHAFile(ctx context.Context, shaFile SHAFile) error
+	InsertImport(ctx context.Context, imp Import) error
+	GetImports(ctx context.Context) ([]Import, error)
+	InsertJobRun(ctx context.Context, run JobRun) error
+	GetJobRuns(ctx context.Context, limit int) ([]JobRun, error)
+	InsertRule(ctx context.Context, rule Rule) error
+	GetRules(ctx context.Context) ([]Rule, error)
+	DeleteRule(ctx context.Context, id string) error
+	UpsertOverride(ctx context.Context, override Override) error
+	GetOverrides(ctx context.Context) ([]Override, error)
+	UpsertUser(ctx context.Context, user User) error
+	GetUsers(ctx context.Context) ([]User, error)
+	DeleteUser(ctx context.Context, name string) error
+	InsertAPIToken(ctx context.Context, token APIToken) error
+	GetAPITokens(ctx context.Context) ([]APIToken, error)
+	DeleteAPIToken(ctx context.Context, id string) error
+	// the audit log is append-only, entries can't be changed or removed
+	InsertAuditEntry(ctx context.Context, entry AuditEntry) error
+	GetAuditEntries(ctx context.Context) ([]AuditEntry, error)
+	// Ping checks that the storage is reachable
+	Ping(ctx context.Context) error
+	// CheckSchema checks that the tables exist and the migrations are applied
+	CheckSchema(ctx context.Context) error
+	Close() error
+}
+
+// DBModel is the ClickHouse implementation of the Store
+var _ Store = (*DBModel)(nil)
+
+// InsertTransaction inserts a new txn, an already stored txn is skipped
+func (m *DBModel) InsertTransaction(ctx context.Context, txn Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	stmt := `
-		INSERT INTO transactions
-			(kind, date, recipient,
-			 amount, primary_class, secondary_class)
-		VALUES (?, ?, ?, ?, ?, ?)
-		`
-	_, err := m.DB.ExecContext(ctx, stmt,
-		txn.TransactionType, txn.Date, txn.Recipient,
-		txn.Amount, txn.Category, txn.Subcategory,
-	)
+	txns, err := m.newTransactions(ctx, []Transaction{txn})
+	if err != nil || len(txns) == 0 {
+		return err
+	}
+	_, err = m.DB.ExecContext(ctx, insertTransactionStmt, transactionArgs(txn)...)
 
 	if err != nil {
 		return err
@@ -64,9 +277,114 @@ func (m *DBModel) InsertTransaction(txn Transaction) error {
 	return nil
 }
 
+// InsertTransactions inserts the txns as a single batch, either all of them
+// are inserted or none. Already stored txns are skipped like the unique hash
+// does in the other backends.
+func (m *DBModel) InsertTransactions(ctx context.Context, txns []Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	txns, err := m.newTransactions(ctx, txns)
+	if err != nil || len(txns) == 0 {
+		return err
+	}
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// the clickhouse driver sends all rows of the prepared statement
+	// as one block on commit
+	stmt, err := tx.PrepareContext(ctx, insertTransactionStmt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, txn := range txns {
+		if _, err := stmt.ExecContext(ctx, transactionArgs(txn)...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// StoredHashes returns which of the hashes belong to stored transactions
+func (m *DBModel) StoredHashes(ctx context.Context, hashes []string) (map[string]bool, error) {
+	stored := make(map[string]bool)
+	if len(hashes) == 0 {
+		return stored, nil
+	}
+	rows, err := m.DB.QueryContext(ctx, `SELECT hash FROM transactions WHERE has(?, hash)`, hashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		stored[hash] = true
+	}
+	return stored, rows.Err()
+}
+
+// newTransactions returns the txns whose hashes aren't stored yet, only the
+// first of identical txns is returned. MergeTree has no unique key, the
+// import jobs are the only writers of transactions.
+func (m *DBModel) newTransactions(ctx context.Context, txns []Transaction) ([]Transaction, error) {
+	hashes := make([]string, 0, len(txns))
+	for _, txn := range txns {
+		hashes = append(hashes, txn.Hash())
+	}
+	seen, err := m.StoredHashes(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	newTxns := make([]Transaction, 0, len(txns))
+	for i, txn := range txns {
+		if !seen[hashes[i]] {
+			seen[hashes[i]] = true
+			newTxns = append(newTxns, txn)
+		}
+	}
+	return newTxns, nil
+}
+
+const insertTransactionStmt = `
+	INSERT INTO transactions
+		(account_id, kind, date, recipient,
+		 amount, primary_class, secondary_class, hash,
+		 iban, bic, usage, description, internal, tags, occurrence)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+// transactionArgs returns the values of insertTransactionStmt
+func transactionArgs(txn Transaction) []any {
+	return []any{
+		txn.AccountID, txn.TransactionType, txn.Date, txn.Recipient,
+		txn.Amount, txn.Category, txn.Subcategory, txn.Hash(),
+		txn.IBAN, txn.BIC, txn.Usage, txn.Description, boolToUInt8(txn.Internal),
+		nonNilTags(txn.Tags), uint32(txn.Occurrence),
+	}
+}
+
+// nonNilTags returns the tags or an empty list, the driver can't insert nil
+// into an array column
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
 // GetSHAFiles retrieves all SHA files from the database
-func (m *DBModel) GetSHAFiles() ([]SHAFile, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DBModel) GetSHAFiles(ctx context.Context) ([]SHAFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	stmt := `SELECT path, sha256 FROM file_hashes`
@@ -95,8 +413,8 @@ func (m *DBModel) GetSHAFiles() ([]SHAFile, error) {
 }
 
 // InsertSHAFile inserts a new SHA file into the database
-func (m *DBModel) InsertSHAFile(shaFile SHAFile) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DBModel) InsertSHAFile(ctx context.Context, shaFile SHAFile) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	stmt := `
@@ -114,3 +432,591 @@ func (m *DBModel) InsertSHAFile(shaFile SHAFile) error {
 
 	return nil
 }
+
+// GetTransactions retrieves all transactions from the database
+func (m *DBModel) GetTransactions(ctx context.Context) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		ORDER BY date`, transactionColumns))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTransactions(rows)
+}
+
+// MarkInternal flags the transactions with the given hashes as internal transfers
+func (m *DBModel) MarkInternal(ctx context.Context, hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `ALTER TABLE transactions UPDATE internal = 1 WHERE has(?, hash)`
+	_, err := m.DB.ExecContext(ctx, stmt, hashes)
+	return err
+}
+
+// UpdateCategories stores the categories of the already stored txns.
+// Transactions with the same category are updated by one mutation.
+func (m *DBModel) UpdateCategories(ctx context.Context, txns []Transaction) error {
+	type category struct{ primary, secondary string }
+	hashes := make(map[category][]string)
+	for _, txn := range txns {
+		key := category{txn.Category, txn.Subcategory}
+		hashes[key] = append(hashes[key], txn.Hash())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	stmt := `
+		ALTER TABLE transactions
+		UPDATE primary_class = ?, secondary_class = ?
+		WHERE has(?, hash)
+		`
+	for key, keyHashes := range hashes {
+		if _, err := m.DB.ExecContext(ctx, stmt, key.primary, key.secondary, keyHashes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateTags stores the tags of the already stored txns, every
+// transaction is updated by its own mutation
+func (m *DBModel) UpdateTags(ctx context.Context, txns []Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	stmt := `ALTER TABLE transactions UPDATE tags = ? WHERE hash = ?`
+	for _, txn := range txns {
+		if _, err := m.DB.ExecContext(ctx, stmt, nonNilTags(txn.Tags), txn.Hash()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertAccount inserts an account, an account with the same id is replaced
+func (m *DBModel) InsertAccount(ctx context.Context, account Account) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO accounts
+			(id, iban, name, bank, owner, type)
+		VALUES (?, ?, ?, ?, ?, ?)
+		`
+	_, err := m.DB.ExecContext(ctx, stmt,
+		account.ID, account.IBAN, account.Name, account.Bank, account.Owner, account.Type,
+	)
+	return err
+}
+
+// GetAccounts retrieves all accounts from the database
+func (m *DBModel) GetAccounts(ctx context.Context) ([]Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `SELECT id, iban, name, bank, owner, type FROM accounts FINAL ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []Account
+	for rows.Next() {
+		var account Account
+		err := rows.Scan(&account.ID, &account.IBAN, &account.Name,
+			&account.Bank, &account.Owner, &account.Type)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// InsertImport inserts the result of a file import into the database
+func (m *DBModel) InsertImport(ctx context.Context, imp Import) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO imports
+			(id, path, sha256, started_at, finished_at,
+			 status, rows_total, rows_inserted, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+	_, err := m.DB.ExecContext(ctx, stmt,
+		imp.ID, imp.Path, imp.SHA256, imp.StartedAt, imp.FinishedAt,
+		imp.Status, imp.RowsTotal, imp.RowsInserted, imp.Error,
+	)
+	return err
+}
+
+// GetImports retrieves all file imports from the database
+func (m *DBModel) GetImports(ctx context.Context) ([]Import, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, path, sha256, started_at, finished_at,
+			status, rows_total, rows_inserted, error
+		FROM imports
+		ORDER BY started_at
+		`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var imports []Import
+	for rows.Next() {
+		var (
+			imp                     Import
+			rowsTotal, rowsInserted uint32
+		)
+		err := rows.Scan(&imp.ID, &imp.Path, &imp.SHA256, &imp.StartedAt, &imp.FinishedAt,
+			&imp.Status, &rowsTotal, &rowsInserted, &imp.Error)
+		if err != nil {
+			return nil, err
+		}
+		imp.RowsTotal, imp.RowsInserted = int(rowsTotal), int(rowsInserted)
+		imports = append(imports, imp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
+
+// InsertJobRun inserts a finished run of a background job into the database
+func (m *DBModel) InsertJobRun(ctx context.Context, run JobRun) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO job_runs
+			(id, job, started_at, finished_at, status,
+			 files_processed, rows_inserted, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`
+	_, err := m.DB.ExecContext(ctx, stmt,
+		run.ID, run.Job, run.StartedAt, run.FinishedAt, run.Status,
+		run.FilesProcessed, run.RowsInserted, run.Error,
+	)
+	return err
+}
+
+// GetJobRuns retrieves the latest runs of the background jobs from the
+// database, newest first
+func (m *DBModel) GetJobRuns(ctx context.Context, limit int) ([]JobRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, job, started_at, finished_at, status,
+			files_processed, rows_inserted, error
+		FROM job_runs
+		ORDER BY started_at DESC
+		LIMIT ?
+		`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []JobRun
+	for rows.Next() {
+		var (
+			run                 JobRun
+			files, rowsInserted uint32
+		)
+		err := rows.Scan(&run.ID, &run.Job, &run.StartedAt, &run.FinishedAt, &run.Status,
+			&files, &rowsInserted, &run.Error)
+		if err != nil {
+			return nil, err
+		}
+		run.FilesProcessed, run.RowsInserted = int(files), int(rowsInserted)
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// InsertRule inserts a new categorisation rule into the database
+func (m *DBModel) InsertRule(ctx context.Context, rule Rule) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO rules
+			(id, pattern, primary_class, secondary_class, priority, accounts)
+		VALUES (?, ?, ?, ?, ?, ?)
+		`
+	accounts := rule.Accounts
+	if accounts == nil {
+		accounts = []string{}
+	}
+	_, err := m.DB.ExecContext(ctx, stmt,
+		rule.ID, rule.Pattern, rule.Category, rule.Subcategory, rule.Priority, accounts,
+	)
+	return err
+}
+
+// GetRules retrieves all categorisation rules ordered by priority
+func (m *DBModel) GetRules(ctx context.Context) ([]Rule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, pattern, primary_class, secondary_class, priority, accounts
+		FROM rules FINAL
+		ORDER BY priority DESC, id
+		`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var (
+			rule     Rule
+			priority int32
+		)
+		err := rows.Scan(&rule.ID, &rule.Pattern, &rule.Category, &rule.Subcategory, &priority, &rule.Accounts)
+		if err != nil {
+			return nil, err
+		}
+		rule.Priority = int(priority)
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// DeleteRule removes the categorisation rule with the given id
+func (m *DBModel) DeleteRule(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM rules WHERE id = ?`, id)
+	return err
+}
+
+// UpsertOverride stores a manual category correction. The overrides table uses
+// ReplacingMergeTree, so the latest override of a transaction wins
+func (m *DBModel) UpsertOverride(ctx context.Context, override Override) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO overrides
+			(transaction_hash, primary_class, secondary_class, updated_at)
+		VALUES (?, ?, ?, ?)
+		`
+	_, err := m.DB.ExecContext(ctx, stmt,
+		override.TransactionHash, override.Category, override.Subcategory, override.UpdatedAt,
+	)
+	return err
+}
+
+// GetOverrides retrieves all manual category corrections
+func (m *DBModel) GetOverrides(ctx context.Context) ([]Override, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT transaction_hash, primary_class, secondary_class, updated_at
+		FROM overrides FINAL
+		`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides []Override
+	for rows.Next() {
+		var override Override
+		err := rows.Scan(&override.TransactionHash, &override.Category,
+			&override.Subcategory, &override.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, override)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// UpsertUser inserts a user, a user with the same name is replaced
+func (m *DBModel) UpsertUser(ctx context.Context, user User) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO users
+			(name, password_hash, role, accounts, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		`
+	accounts := user.Accounts
+	if accounts == nil {
+		accounts = []string{}
+	}
+	_, err := m.DB.ExecContext(ctx, stmt,
+		user.Name, user.PasswordHash, user.Role, accounts, user.CreatedAt,
+	)
+	return err
+}
+
+// GetUsers retrieves all users ordered by name
+func (m *DBModel) GetUsers(ctx context.Context) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT name, password_hash, role, accounts, created_at
+		FROM users FINAL
+		ORDER BY name
+		`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.Name, &user.PasswordHash, &user.Role, &user.Accounts, &user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// DeleteUser removes the user with the given name
+func (m *DBModel) DeleteUser(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM users WHERE name = ?`, name)
+	return err
+}
+
+// InsertAPIToken inserts a new API token into the database
+func (m *DBModel) InsertAPIToken(ctx context.Context, token APIToken) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO api_tokens
+			(id, user_name, name, hash, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		`
+	_, err := m.DB.ExecContext(ctx, stmt,
+		token.ID, token.User, token.Name, token.Hash, token.CreatedAt,
+	)
+	return err
+}
+
+// GetAPITokens retrieves all API tokens ordered by creation
+func (m *DBModel) GetAPITokens(ctx context.Context) ([]APIToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, user_name, name, hash, created_at
+		FROM api_tokens FINAL
+		ORDER BY created_at, id
+		`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var token APIToken
+		err := rows.Scan(&token.ID, &token.User, &token.Name, &token.Hash, &token.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteAPIToken removes the API token with the given id
+func (m *DBModel) DeleteAPIToken(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ?`, id)
+	return err
+}
+
+// InsertAuditEntry appends a change made by hand to the audit log
+func (m *DBModel) InsertAuditEntry(ctx context.Context, entry AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO audit_log
+			(id, changed_at, user_name, source, entity, entity_id,
+			 account_id, before_value, after_value)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+	_, err := m.DB.ExecContext(ctx, stmt,
+		entry.ID, entry.ChangedAt, entry.User, entry.Source, entry.Entity, entry.EntityID,
+		entry.AccountID, entry.Before, entry.After,
+	)
+	return err
+}
+
+// GetAuditEntries retrieves the audit log from the database, newest first
+func (m *DBModel) GetAuditEntries(ctx context.Context) ([]AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, changed_at, user_name, source, entity, entity_id,
+			account_id, before_value, after_value
+		FROM audit_log
+		ORDER BY changed_at DESC, id DESC
+		`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		err := rows.Scan(&entry.ID, &entry.ChangedAt, &entry.User, &entry.Source, &entry.Entity,
+			&entry.EntityID, &entry.AccountID, &entry.Before, &entry.After)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// schemaTables are the tables of tables.sql
+var schemaTables = []string{
+	"transactions", "accounts", "file_hashes", "imports", "rules", "overrides", "job_runs",
+	"users", "api_tokens", "audit_log",
+}
+
+// Ping checks the connection to the database
+func (m *DBModel) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.DB.PingContext(ctx)
+}
+
+// CheckSchema checks that all tables of tables.sql exist in the database
+func (m *DBModel) CheckSchema(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT name FROM system.tables WHERE database = currentDatabase()
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, table := range schemaTables {
+		if !existing[table] {
+			return fmt.Errorf("table %s doesn't exist, apply tables.sql", table)
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying database connection pool
+func (m *DBModel) Close() error {
+	return m.DB.Close()
+}
+
+// boolToUInt8 converts a bool to the ClickHouse UInt8 representation
+func boolToUInt8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrTransactionNotFound is returned for an unknown transaction hash
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// Groupings of the transaction aggregates
+const (
+	GroupByMonth     = "month"
+	GroupByCategory  = "category"
+	GroupByRecipient = "recipient"
+)
+
+// TransactionFilter struct that holds the conditions a transaction has to
+// match, empty fields match every transaction
+type TransactionFilter struct {
+	From        string // first date, inclusive
+	To          string // last date, inclusive
+	Accounts    []string
+	Category    string // case insensitive
+	Subcategory string // case insensitive
+	Recipient   string // part of the recipient, case insensitive
+	MinAmount   *float64
+	MaxAmount   *float64
+	Tags        []string // all of them have to be set
+	Text        string   // part of any text field, case insensitive
+	Internal    *bool
+	// Viewer is the user the transactions are shown to, the transactions
+	// of the accounts they can't see are left out. Nil for all accounts.
+	Viewer *User
+}
+
+// Cursor struct that holds the position after the last transaction of a
+// page. Pages are ordered newest first, transactions of the same day by
+// their hash.
+type Cursor struct {
+	Date string
+	Hash string
+}
+
+// TransactionGroup struct that holds the totals of a group of transactions
+type TransactionGroup struct {
+	Key      string
+	Count    int
+	Income   float64
+	Expenses float64 // positive
+	Example  string  // hash of one transaction of the group
+}
+
+// Match checks whether the transaction matches all conditions
+func (f TransactionFilter) Match(txn Transaction) bool {
+	switch {
+	case f.From != "" && txn.Date < f.From,
+		f.To != "" && txn.Date > f.To,
+		len(f.Accounts) > 0 && !slices.Contains(f.Accounts, txn.AccountID),
+		f.Viewer != nil && !f.Viewer.CanSee(txn.AccountID),
+		f.Category != "" && !strings.EqualFold(f.Category, txn.Category),
+		f.Subcategory != "" && !strings.EqualFold(f.Subcategory, txn.Subcategory),
+		f.Recipient != "" && !containsFold(txn.Recipient, f.Recipient),
+		f.MinAmount != nil && txn.Amount < *f.MinAmount,
+		f.MaxAmount != nil && txn.Amount > *f.MaxAmount,
+		f.Internal != nil && txn.Internal != *f.Internal:
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !slices.Contains(txn.Tags, tag) {
+			return false
+		}
+	}
+	return f.Text == "" || slices.ContainsFunc(txn.textFields(), func(field string) bool {
+		return containsFold(field, f.Text)
+	})
+}
+
+// textFields returns the fields searched by the text of a filter
+func (t Transaction) textFields() []string {
+	return append([]string{
+		t.Recipient, t.Usage, t.Description, t.IBAN,
+		t.Category, t.Subcategory, t.TransactionType,
+	}, t.Tags...)
+}
+
+// containsFold checks whether substr is part of s ignoring the case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// After checks whether the transaction comes after the cursor in the order
+// of the pages
+func (c Cursor) After(txn Transaction) bool {
+	if txn.Date != c.Date {
+		return txn.Date < c.Date
+	}
+	return txn.Hash() > c.Hash
+}
+
+// GroupKey returns the key of the transaction in the grouping
+func GroupKey(txn Transaction, by string) string {
+	switch by {
+	case GroupByMonth:
+		if len(txn.Date) < 7 {
+			return txn.Date
+		}
+		return txn.Date[:7]
+	case GroupByCategory:
+		return txn.Category
+	default:
+		return txn.Recipient
+	}
+}
+
+// ValidGroup checks whether transactions can be grouped by the value
+func ValidGroup(by string) bool {
+	return by == GroupByMonth || by == GroupByCategory || by == GroupByRecipient
+}
+
+// clickhouseWhere returns the WHERE clause of the filter and its arguments,
+// or "1" for an empty filter
+func clickhouseWhere(filter TransactionFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, values ...any) {
+		conds = append(conds, cond)
+		args = append(args, values...)
+	}
+	if filter.From != "" {
+		add("date >= toDate(?)", filter.From)
+	}
+	if filter.To != "" {
+		add("date <= toDate(?)", filter.To)
+	}
+	if len(filter.Accounts) > 0 {
+		add("has(?, account_id)", filter.Accounts)
+	}
+	if filter.Viewer != nil && !slices.Contains(filter.Viewer.Accounts, AllAccounts) {
+		if len(filter.Viewer.Accounts) == 0 {
+			add("0")
+		} else {
+			add("has(?, account_id)", filter.Viewer.Accounts)
+		}
+	}
+	if filter.Category != "" {
+		add("lowerUTF8(primary_class) = lowerUTF8(?)", filter.Category)
+	}
+	if filter.Subcategory != "" {
+		add("lowerUTF8(secondary_class) = lowerUTF8(?)", filter.Subcategory)
+	}
+	if filter.Recipient != "" {
+		add("positionCaseInsensitiveUTF8(recipient, ?) > 0", filter.Recipient)
+	}
+	if filter.MinAmount != nil {
+		add("toFloat64(amount) >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		add("toFloat64(amount) <= ?", *filter.MaxAmount)
+	}
+	if len(filter.Tags) > 0 {
+		add("hasAll(tags, ?)", filter.Tags)
+	}
+	if filter.Text != "" {
+		var fields []string
+		for _, column := range []string{"recipient", "usage", "description", "iban", "primary_class", "secondary_class", "kind"} {
+			fields = append(fields, fmt.Sprintf("positionCaseInsensitiveUTF8(%s, ?) > 0", column))
+			args = append(args, filter.Text)
+		}
+		fields = append(fields, "arrayExists(tag -> positionCaseInsensitiveUTF8(tag, ?) > 0, tags)")
+		add("("+strings.Join(fields, " OR ")+")", filter.Text)
+	}
+	if filter.Internal != nil {
+		add("internal = ?", boolToUInt8(*filter.Internal))
+	}
+	if len(conds) == 0 {
+		return "1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// QueryTransactions returns up to limit transactions matching the filter
+// after the cursor, newest first. All of them are returned for limit 0, from
+// the first one for a nil cursor.
+func (m *DBModel) QueryTransactions(ctx context.Context, filter TransactionFilter, after *Cursor, limit int) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	where, args := clickhouseWhere(filter)
+	if after != nil {
+		where += " AND (date < toDate(?) OR (date = toDate(?) AND hash > ?))"
+		args = append(args, after.Date, after.Date, after.Hash)
+	}
+	stmt := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE %s
+		ORDER BY date DESC, hash`, transactionColumns, where)
+	if limit > 0 {
+		stmt += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTransactions(rows)
+}
+
+// GetTransactionByHash returns the transaction with the hash or
+// ErrTransactionNotFound
+func (m *DBModel) GetTransactionByHash(ctx context.Context, hash string) (Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE hash = ?
+		LIMIT 1`, transactionColumns), hash)
+	if err != nil {
+		return Transaction{}, err
+	}
+	defer rows.Close()
+	txns, err := scanTransactions(rows)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if len(txns) == 0 {
+		return Transaction{}, ErrTransactionNotFound
+	}
+	return txns[0], nil
+}
+
+// AggregateTransactions returns the totals of the transactions matching the
+// filter grouped by month, category or recipient. Internal transfers are
+// left out like in the reports.
+func (m *DBModel) AggregateTransactions(ctx context.Context, filter TransactionFilter, by string) ([]TransactionGroup, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	key := map[string]string{
+		GroupByMonth:     "formatDateTime(date, '%Y-%m')",
+		GroupByCategory:  "primary_class",
+		GroupByRecipient: "recipient",
+	}[by]
+	if key == "" {
+		return nil, fmt.Errorf("unknown grouping %q", by)
+	}
+	where, args := clickhouseWhere(filter)
+	rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s AS key, toInt64(count()),
+			sumIf(toFloat64(amount), amount >= 0), -sumIf(toFloat64(amount), amount < 0),
+			min(hash)
+		FROM transactions
+		WHERE %s AND internal = 0
+		GROUP BY key`, key, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []TransactionGroup
+	for rows.Next() {
+		var (
+			group TransactionGroup
+			count int64
+		)
+		if err := rows.Scan(&group.Key, &count, &group.Income, &group.Expenses, &group.Example); err != nil {
+			return nil, err
+		}
+		group.Count = int(count)
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// transactionColumns are the columns read by scanTransactions
+const transactionColumns = `account_id, kind, toString(date), recipient, toFloat64(amount),
+	primary_class, secondary_class, iban, bic, usage, description, internal, tags,
+	toInt64(occurrence)`
+
+// scanTransactions reads the transactions of the rows selecting
+// transactionColumns
+func scanTransactions(rows *sql.Rows) ([]Transaction, error) {
+	var txns []Transaction
+	for rows.Next() {
+		var (
+			txn        Transaction
+			internal   uint8
+			occurrence int64
+		)
+		err := rows.Scan(&txn.AccountID, &txn.TransactionType, &txn.Date, &txn.Recipient,
+			&txn.Amount, &txn.Category, &txn.Subcategory,
+			&txn.IBAN, &txn.BIC, &txn.Usage, &txn.Description, &internal, &txn.Tags, &occurrence)
+		if err != nil {
+			return nil, err
+		}
+		txn.Internal = internal == 1
+		txn.Occurrence = int(occurrence)
+		txns = append(txns, txn)
+	}
+	return txns, rows.Err()
+}
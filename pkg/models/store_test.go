@@ -0,0 +1,44 @@
+package models_test
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	// register the clickhouse database/sql driver
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/storage/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConformance runs against the ClickHouse database of
+// TEST_CLICKHOUSE_DSN, like clickhouse://localhost:9000/test. The database
+// should be a dedicated one, the transactions are truncated.
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_CLICKHOUSE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_CLICKHOUSE_DSN is not set")
+	}
+	db, err := sql.Open("clickhouse", dsn)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer db.Close()
+	tables, err := os.ReadFile("../../clickhouse/tables.sql")
+	assert.NoError(t, err)
+	for _, stmt := range strings.Split(string(tables), ";") {
+		if strings.TrimSpace(stmt) != "" {
+			_, err := db.Exec(stmt)
+			assert.NoError(t, err)
+		}
+	}
+
+	storetest.Run(t, func(t *testing.T) models.Store {
+		_, err := db.Exec(`TRUNCATE TABLE transactions`)
+		assert.NoError(t, err)
+		return &models.DBModel{DB: db}
+	})
+}
@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.up.sql
+var migrations embed.FS
+
+// Migrate applies all migrations which are not recorded in the
+// schema_migrations table yet. Every migration runs in its own transaction.
+func Migrate(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	names, err := migrationNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		version := migrationVersion(name)
+
+		var applied bool
+		err := db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version,
+		).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		content, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := applyMigration(ctx, db, version, string(content)); err != nil {
+			return fmt.Errorf("error applying migration %s: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// CheckMigrations returns an error if any migration isn't recorded in the
+// schema_migrations table
+func CheckMigrations(ctx context.Context, db *sql.DB) error {
+	names, err := migrationNames()
+	if err != nil {
+		return err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if version := migrationVersion(name); !applied[version] {
+			return fmt.Errorf("migration %s isn't applied", version)
+		}
+	}
+	return nil
+}
+
+// migrationNames returns the embedded migrations in the order of versions
+func migrationNames() ([]string, error) {
+	names, err := fs.Glob(migrations, "migrations/*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// migrationVersion returns the version of the migration file
+func migrationVersion(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".up.sql")
+}
+
+// applyMigration runs a single migration and records its version
+func applyMigration(ctx context.Context, db *sql.DB, version, stmt string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint:errcheck
+
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
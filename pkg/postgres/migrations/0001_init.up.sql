@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS transactions (
+    hash TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    date DATE NOT NULL,
+    recipient TEXT NOT NULL,
+    amount NUMERIC(18, 2) NOT NULL,
+    primary_class TEXT NOT NULL DEFAULT '',
+    secondary_class TEXT NOT NULL DEFAULT '',
+    internal BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS transactions_date_idx ON transactions (date);
+
+CREATE TABLE IF NOT EXISTS file_hashes (
+    path TEXT NOT NULL,
+    sha256 TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS file_hashes_sha256_idx ON file_hashes (sha256);
+
+CREATE TABLE IF NOT EXISTS imports (
+    id TEXT PRIMARY KEY,
+    path TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL,
+    rows_total INTEGER NOT NULL DEFAULT 0,
+    rows_inserted INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS rules (
+    id TEXT PRIMARY KEY,
+    pattern TEXT NOT NULL,
+    primary_class TEXT NOT NULL,
+    secondary_class TEXT NOT NULL DEFAULT '',
+    priority INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS overrides (
+    transaction_hash TEXT PRIMARY KEY,
+    primary_class TEXT NOT NULL,
+    secondary_class TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL
+);
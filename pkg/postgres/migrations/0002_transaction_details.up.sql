@@ -0,0 +1,7 @@
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS iban TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS bic TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS usage TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS transactions_iban_idx ON transactions (iban);
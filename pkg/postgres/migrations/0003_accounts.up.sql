@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS accounts (
+    id TEXT PRIMARY KEY,
+    iban TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL DEFAULT '',
+    bank TEXT NOT NULL DEFAULT '',
+    owner TEXT NOT NULL DEFAULT '',
+    type TEXT NOT NULL DEFAULT ''
+);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS account_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS transactions_account_id_idx ON transactions (account_id);
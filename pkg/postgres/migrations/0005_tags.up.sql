@@ -0,0 +1,3 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS transactions_tags_idx ON transactions USING GIN (tags);
@@ -0,0 +1,2 @@
+-- identical rows of one export are told apart by their occurrence
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS occurrence INTEGER NOT NULL DEFAULT 0;
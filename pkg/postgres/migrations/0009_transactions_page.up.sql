@@ -0,0 +1,2 @@
+-- the transaction pages are read newest first, see models.Cursor
+CREATE INDEX IF NOT EXISTS transactions_page_idx ON transactions (date DESC, hash);
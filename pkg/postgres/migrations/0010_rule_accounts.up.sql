@@ -0,0 +1,2 @@
+-- rules created by users who can't see all accounts apply to their accounts
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS accounts TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,733 @@
+// Package postgres provides the PostgreSQL implementation of the models.Store.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	// register the pgx database/sql driver
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+var _ models.Store = (*Store)(nil)
+
+// pgTypes scans the array columns which database/sql can't handle
+var pgTypes = pgtype.NewMap()
+
+// Store is the type for postgres connection values
+type Store struct {
+	DB *sql.DB
+}
+
+// OpenDB opens a connection to the PostgreSQL database and applies the migrations
+func OpenDB(user, password, addr, database, sslMode string) (*Store, error) {
+	store, err := Connect(user, password, addr, database, sslMode)
+	if err != nil {
+		return nil, err
+	}
+	if err := Migrate(store.DB); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Connect opens a connection to the PostgreSQL database without applying
+// the migrations
+func Connect(user, password, addr, database, sslMode string) (*Store, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, password),
+		Host:     addr,
+		Path:     database,
+		RawQuery: url.Values{"sslmode": []string{sslMode}}.Encode(),
+	}
+	db, err := sql.Open("pgx", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{DB: db}, nil
+}
+
+// InsertTransaction inserts a new txn, already stored transactions are skipped
+func (s *Store) InsertTransaction(ctx context.Context, txn models.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, insertTransactionStmt, transactionArgs(txn)...)
+	return err
+}
+
+// InsertTransactions inserts the txns in a single database transaction,
+// either all of them are inserted or none
+func (s *Store) InsertTransactions(ctx context.Context, txns []models.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, insertTransactionStmt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, txn := range txns {
+		if _, err := stmt.ExecContext(ctx, transactionArgs(txn)...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const insertTransactionStmt = `
+	INSERT INTO transactions
+		(hash, account_id, kind, date, recipient,
+		 amount, primary_class, secondary_class,
+		 iban, bic, usage, description, internal, tags, occurrence)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	ON CONFLICT (hash) DO NOTHING
+	`
+
+// transactionArgs returns the values of insertTransactionStmt
+func transactionArgs(txn models.Transaction) []any {
+	return []any{
+		txn.Hash(), txn.AccountID, txn.TransactionType, txn.Date, txn.Recipient,
+		fmt.Sprintf("%.2f", txn.Amount), txn.Category, txn.Subcategory,
+		txn.IBAN, txn.BIC, txn.Usage, txn.Description, txn.Internal,
+		nonNilTags(txn.Tags), txn.Occurrence,
+	}
+}
+
+// nonNilTags returns the tags or an empty list, the column isn't nullable
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// GetTransactions retrieves all transactions from the database
+func (s *Store) GetTransactions(ctx context.Context) ([]models.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		ORDER BY date`, transactionColumns))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTransactions(rows)
+}
+
+// MarkInternal flags the transactions with the given hashes as internal transfers
+func (s *Store) MarkInternal(ctx context.Context, hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx,
+		`UPDATE transactions SET internal = TRUE WHERE hash = ANY($1)`, hashes)
+	return err
+}
+
+// UpdateCategories stores the categories of the already stored txns
+// in a single database transaction
+func (s *Store) UpdateCategories(ctx context.Context, txns []models.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx,
+		`UPDATE transactions SET primary_class = $1, secondary_class = $2 WHERE hash = $3`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, txn := range txns {
+		if _, err := stmt.ExecContext(ctx, txn.Category, txn.Subcategory, txn.Hash()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateTags stores the tags of the already stored txns in a single
+// database transaction
+func (s *Store) UpdateTags(ctx context.Context, txns []models.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `UPDATE transactions SET tags = $1 WHERE hash = $2`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, txn := range txns {
+		if _, err := stmt.ExecContext(ctx, nonNilTags(txn.Tags), txn.Hash()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertAccount inserts an account, an account with the same id is replaced
+func (s *Store) InsertAccount(ctx context.Context, account models.Account) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO accounts
+			(id, iban, name, bank, owner, type)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			iban = EXCLUDED.iban,
+			name = EXCLUDED.name,
+			bank = EXCLUDED.bank,
+			owner = EXCLUDED.owner,
+			type = EXCLUDED.type
+		`
+	_, err := s.DB.ExecContext(ctx, stmt,
+		account.ID, account.IBAN, account.Name, account.Bank, account.Owner, account.Type,
+	)
+	return err
+}
+
+// GetAccounts retrieves all accounts from the database
+func (s *Store) GetAccounts(ctx context.Context) ([]models.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT id, iban, name, bank, owner, type FROM accounts ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []models.Account
+	for rows.Next() {
+		var account models.Account
+		err := rows.Scan(&account.ID, &account.IBAN, &account.Name,
+			&account.Bank, &account.Owner, &account.Type)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// GetSHAFiles retrieves all SHA files from the database
+func (s *Store) GetSHAFiles(ctx context.Context) ([]models.SHAFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, `SELECT path, sha256 FROM file_hashes`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shaFiles []models.SHAFile
+	for rows.Next() {
+		var shaFile models.SHAFile
+		if err := rows.Scan(&shaFile.Path, &shaFile.SHA256); err != nil {
+			return nil, err
+		}
+		shaFiles = append(shaFiles, shaFile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shaFiles, nil
+}
+
+// InsertSHAFile inserts a new SHA file into the database
+func (s *Store) InsertSHAFile(ctx context.Context, shaFile models.SHAFile) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx,
+		`INSERT INTO file_hashes (path, sha256) VALUES ($1, $2)`,
+		shaFile.Path, shaFile.SHA256,
+	)
+	return err
+}
+
+// InsertImport inserts the result of a file import into the database
+func (s *Store) InsertImport(ctx context.Context, imp models.Import) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO imports
+			(id, path, sha256, started_at, finished_at,
+			 status, rows_total, rows_inserted, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO NOTHING
+		`
+	_, err := s.DB.ExecContext(ctx, stmt,
+		imp.ID, imp.Path, imp.SHA256, imp.StartedAt, imp.FinishedAt,
+		imp.Status, imp.RowsTotal, imp.RowsInserted, imp.Error,
+	)
+	return err
+}
+
+// GetImports retrieves all file imports from the database
+func (s *Store) GetImports(ctx context.Context) ([]models.Import, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, path, sha256, started_at, finished_at,
+			status, rows_total, rows_inserted, error
+		FROM imports
+		ORDER BY started_at
+		`
+
+	rows, err := s.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var imports []models.Import
+	for rows.Next() {
+		var imp models.Import
+		err := rows.Scan(&imp.ID, &imp.Path, &imp.SHA256, &imp.StartedAt, &imp.FinishedAt,
+			&imp.Status, &imp.RowsTotal, &imp.RowsInserted, &imp.Error)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, imp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
+
+// InsertJobRun inserts a finished run of a background job into the database
+func (s *Store) InsertJobRun(ctx context.Context, run models.JobRun) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO job_runs
+			(id, job, started_at, finished_at, status,
+			 files_processed, rows_inserted, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO NOTHING
+		`
+	_, err := s.DB.ExecContext(ctx, stmt,
+		run.ID, run.Job, run.StartedAt, run.FinishedAt, run.Status,
+		run.FilesProcessed, run.RowsInserted, run.Error,
+	)
+	return err
+}
+
+// GetJobRuns retrieves the latest runs of the background jobs from the
+// database, newest first
+func (s *Store) GetJobRuns(ctx context.Context, limit int) ([]models.JobRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, job, started_at, finished_at, status,
+			files_processed, rows_inserted, error
+		FROM job_runs
+		ORDER BY started_at DESC
+		LIMIT $1
+		`
+
+	rows, err := s.DB.QueryContext(ctx, stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []models.JobRun
+	for rows.Next() {
+		var run models.JobRun
+		err := rows.Scan(&run.ID, &run.Job, &run.StartedAt, &run.FinishedAt, &run.Status,
+			&run.FilesProcessed, &run.RowsInserted, &run.Error)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// InsertRule inserts a categorisation rule, a rule with the same id is replaced
+func (s *Store) InsertRule(ctx context.Context, rule models.Rule) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO rules
+			(id, pattern, primary_class, secondary_class, priority, accounts)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			pattern = EXCLUDED.pattern,
+			primary_class = EXCLUDED.primary_class,
+			secondary_class = EXCLUDED.secondary_class,
+			priority = EXCLUDED.priority,
+			accounts = EXCLUDED.accounts
+		`
+	accounts := rule.Accounts
+	if accounts == nil {
+		accounts = []string{}
+	}
+	_, err := s.DB.ExecContext(ctx, stmt,
+		rule.ID, rule.Pattern, rule.Category, rule.Subcategory, rule.Priority, accounts,
+	)
+	return err
+}
+
+// GetRules retrieves all categorisation rules ordered by priority
+func (s *Store) GetRules(ctx context.Context) ([]models.Rule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, pattern, primary_class, secondary_class, priority, accounts
+		FROM rules
+		ORDER BY priority DESC, id
+		`
+
+	rows, err := s.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.Rule
+	for rows.Next() {
+		var rule models.Rule
+		err := rows.Scan(&rule.ID, &rule.Pattern, &rule.Category, &rule.Subcategory, &rule.Priority,
+			pgTypes.SQLScanner(&rule.Accounts))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// DeleteRule removes the categorisation rule with the given id
+func (s *Store) DeleteRule(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM rules WHERE id = $1`, id)
+	return err
+}
+
+// UpsertOverride stores a manual category correction of a transaction
+func (s *Store) UpsertOverride(ctx context.Context, override models.Override) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO overrides
+			(transaction_hash, primary_class, secondary_class, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (transaction_hash) DO UPDATE SET
+			primary_class = EXCLUDED.primary_class,
+			secondary_class = EXCLUDED.secondary_class,
+			updated_at = EXCLUDED.updated_at
+		`
+	_, err := s.DB.ExecContext(ctx, stmt,
+		override.TransactionHash, override.Category, override.Subcategory, override.UpdatedAt,
+	)
+	return err
+}
+
+// GetOverrides retrieves all manual category corrections
+func (s *Store) GetOverrides(ctx context.Context) ([]models.Override, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT transaction_hash, primary_class, secondary_class, updated_at
+		FROM overrides
+		`
+
+	rows, err := s.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides []models.Override
+	for rows.Next() {
+		var override models.Override
+		err := rows.Scan(&override.TransactionHash, &override.Category,
+			&override.Subcategory, &override.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, override)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// UpsertUser inserts a user, a user with the same name is replaced
+func (s *Store) UpsertUser(ctx context.Context, user models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO users
+			(name, password_hash, role, accounts, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET
+			password_hash = EXCLUDED.password_hash,
+			role = EXCLUDED.role,
+			accounts = EXCLUDED.accounts
+		`
+	accounts := user.Accounts
+	if accounts == nil {
+		accounts = []string{}
+	}
+	_, err := s.DB.ExecContext(ctx, stmt,
+		user.Name, user.PasswordHash, user.Role, accounts, user.CreatedAt,
+	)
+	return err
+}
+
+// GetUsers retrieves all users ordered by name
+func (s *Store) GetUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT name, password_hash, role, accounts, created_at
+		FROM users
+		ORDER BY name
+		`
+
+	rows, err := s.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(&user.Name, &user.PasswordHash, &user.Role,
+			pgTypes.SQLScanner(&user.Accounts), &user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// DeleteUser removes the user with the given name
+func (s *Store) DeleteUser(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM users WHERE name = $1`, name)
+	return err
+}
+
+// InsertAPIToken inserts a new API token into the database
+func (s *Store) InsertAPIToken(ctx context.Context, token models.APIToken) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO api_tokens
+			(id, user_name, name, hash, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		`
+	_, err := s.DB.ExecContext(ctx, stmt,
+		token.ID, token.User, token.Name, token.Hash, token.CreatedAt,
+	)
+	return err
+}
+
+// GetAPITokens retrieves all API tokens ordered by creation
+func (s *Store) GetAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, user_name, name, hash, created_at
+		FROM api_tokens
+		ORDER BY created_at, id
+		`
+
+	rows, err := s.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		var token models.APIToken
+		err := rows.Scan(&token.ID, &token.User, &token.Name, &token.Hash, &token.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteAPIToken removes the API token with the given id
+func (s *Store) DeleteAPIToken(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = $1`, id)
+	return err
+}
+
+// InsertAuditEntry appends a change made by hand to the audit log
+func (s *Store) InsertAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO audit_log
+			(id, changed_at, user_name, source, entity, entity_id,
+			 account_id, before_value, after_value)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`
+	_, err := s.DB.ExecContext(ctx, stmt,
+		entry.ID, entry.ChangedAt, entry.User, entry.Source, entry.Entity, entry.EntityID,
+		entry.AccountID, entry.Before, entry.After,
+	)
+	return err
+}
+
+// GetAuditEntries retrieves the audit log from the database, newest first
+func (s *Store) GetAuditEntries(ctx context.Context) ([]models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT id, changed_at, user_name, source, entity, entity_id,
+			account_id, before_value, after_value
+		FROM audit_log
+		ORDER BY changed_at DESC, id DESC
+		`
+
+	rows, err := s.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		err := rows.Scan(&entry.ID, &entry.ChangedAt, &entry.User, &entry.Source, &entry.Entity,
+			&entry.EntityID, &entry.AccountID, &entry.Before, &entry.After)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Ping checks the connection to the database
+func (s *Store) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return s.DB.PingContext(ctx)
+}
+
+// CheckSchema checks that all migrations are applied
+func (s *Store) CheckSchema(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return CheckMigrations(ctx, s.DB)
+}
+
+// Close closes the underlying database connection pool
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
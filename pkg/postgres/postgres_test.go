@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/storage/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestDB returns the database of TEST_POSTGRES_DSN with the migrations
+// applied, the test is skipped without it. The database should be a
+// dedicated one, the tables are truncated.
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { db.Close() })
+	if !assert.NoError(t, Migrate(db)) {
+		t.FailNow()
+	}
+	return db
+}
+
+// newTestStore returns a store of the emptied test database
+func newTestStore(t *testing.T, db *sql.DB) *Store {
+	// row triggers of the append-only audit log don't fire on truncate
+	_, err := db.Exec(`
+		TRUNCATE transactions, file_hashes, imports, rules, overrides,
+			accounts, job_runs, users, api_tokens, audit_log`)
+	assert.NoError(t, err)
+	return &Store{DB: db}
+}
+
+func TestMigrationNames(t *testing.T) {
+	names, err := migrationNames()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, names)
+	versions := make(map[string]bool)
+	for i, name := range names {
+		version := migrationVersion(name)
+		assert.Regexp(t, `^\d{4}_\w+$`, version)
+		assert.False(t, versions[version[:4]], "duplicate version %s", version)
+		versions[version[:4]] = true
+		if i > 0 {
+			assert.Less(t, migrationVersion(names[i-1]), version)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+	store := newTestStore(t, db)
+	ctx := context.Background()
+
+	// migrations which are applied already are skipped
+	assert.NoError(t, Migrate(db))
+	assert.NoError(t, store.CheckSchema(ctx))
+
+	assert.NoError(t, store.InsertAuditEntry(ctx, models.AuditEntry{
+		ID: "audit-1", ChangedAt: time.Now(), User: "me", Source: models.AuditSourceCLI,
+		Entity: models.AuditRule, EntityID: "rule-1",
+	}))
+	_, err := db.Exec(`UPDATE audit_log SET user_name = 'someone'`)
+	assert.ErrorContains(t, err, "append-only")
+	_, err = db.Exec(`DELETE FROM audit_log`)
+	assert.ErrorContains(t, err, "append-only")
+}
+
+func TestUpdateTransactions(t *testing.T) {
+	store := newTestStore(t, openTestDB(t))
+	ctx := context.Background()
+	txns := []models.Transaction{
+		{AccountID: "main", TransactionType: "Card", Date: "2025-03-01", Amount: -9.99, Recipient: "Cafe"},
+		{AccountID: "main", TransactionType: "Transfer", Date: "2025-03-02", Amount: -100, Recipient: "Savings"},
+	}
+	assert.NoError(t, store.InsertTransactions(ctx, txns))
+
+	assert.NoError(t, store.MarkInternal(ctx, []string{txns[1].Hash()}))
+	txns[0].Category, txns[0].Subcategory = "Food", "Cafe"
+	assert.NoError(t, store.UpdateCategories(ctx, txns[:1]))
+	txns[0].Tags = []string{"date"}
+	assert.NoError(t, store.UpdateTags(ctx, txns[:1]))
+
+	stored, err := store.GetTransactions(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, stored, 2)
+	assert.Equal(t, "Food", stored[0].Category)
+	assert.Equal(t, "Cafe", stored[0].Subcategory)
+	assert.Equal(t, []string{"date"}, stored[0].Tags)
+	assert.False(t, stored[0].Internal)
+	assert.True(t, stored[1].Internal)
+	assert.Empty(t, stored[1].Tags)
+}
+
+func TestUpserts(t *testing.T) {
+	store := newTestStore(t, openTestDB(t))
+	ctx := context.Background()
+
+	assert.NoError(t, store.InsertAccount(ctx, models.Account{ID: "main", Name: "Main"}))
+	assert.NoError(t, store.InsertAccount(ctx, models.Account{ID: "main", Name: "Checking"}))
+	accounts, err := store.GetAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Account{{ID: "main", Name: "Checking"}}, accounts)
+
+	updatedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.UpsertOverride(ctx, models.Override{TransactionHash: "h1", Category: "Rent", UpdatedAt: updatedAt}))
+	assert.NoError(t, store.UpsertOverride(ctx, models.Override{TransactionHash: "h1", Category: "Housing", UpdatedAt: updatedAt.Add(time.Hour)}))
+	overrides, err := store.GetOverrides(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, overrides, 1) {
+		assert.Equal(t, "Housing", overrides[0].Category)
+		assert.True(t, updatedAt.Add(time.Hour).Equal(overrides[0].UpdatedAt))
+	}
+
+	createdAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.UpsertUser(ctx, models.User{Name: "me", Role: "viewer", CreatedAt: createdAt}))
+	assert.NoError(t, store.UpsertUser(ctx, models.User{Name: "me", Role: "admin", Accounts: []string{"main"}, CreatedAt: time.Now()}))
+	users, err := store.GetUsers(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "admin", users[0].Role)
+		assert.Equal(t, []string{"main"}, users[0].Accounts)
+		// the creation time is kept
+		assert.True(t, createdAt.Equal(users[0].CreatedAt))
+	}
+
+	assert.NoError(t, store.InsertRule(ctx, models.Rule{ID: "1", Pattern: "rewe", Category: "Food"}))
+	assert.NoError(t, store.DeleteRule(ctx, "1"))
+	rules, err := store.GetRules(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+}
+
+func TestConformance(t *testing.T) {
+	db := openTestDB(t)
+	storetest.Run(t, func(t *testing.T) models.Store {
+		return newTestStore(t, db)
+	})
+}
@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// transactionColumns are the columns read by scanTransactions
+const transactionColumns = `account_id, kind, to_char(date, 'YYYY-MM-DD'), recipient, amount::float8,
+	primary_class, secondary_class, iban, bic, usage, description, internal, tags,
+	occurrence`
+
+// scanTransactions reads the transactions of the rows selecting
+// transactionColumns
+func scanTransactions(rows *sql.Rows) ([]models.Transaction, error) {
+	var txns []models.Transaction
+	for rows.Next() {
+		var txn models.Transaction
+		err := rows.Scan(&txn.AccountID, &txn.TransactionType, &txn.Date, &txn.Recipient,
+			&txn.Amount, &txn.Category, &txn.Subcategory,
+			&txn.IBAN, &txn.BIC, &txn.Usage, &txn.Description, &txn.Internal,
+			pgTypes.SQLScanner(&txn.Tags), &txn.Occurrence)
+		if err != nil {
+			return nil, err
+		}
+		txns = append(txns, txn)
+	}
+	return txns, rows.Err()
+}
+
+// where returns the WHERE clause of the filter and its arguments, or TRUE
+// for an empty filter
+func where(filter models.TransactionFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.From != "" {
+		add("date >= $%d::date", filter.From)
+	}
+	if filter.To != "" {
+		add("date <= $%d::date", filter.To)
+	}
+	if len(filter.Accounts) > 0 {
+		add("account_id = ANY($%d)", filter.Accounts)
+	}
+	if filter.Viewer != nil && !slices.Contains(filter.Viewer.Accounts, models.AllAccounts) {
+		if len(filter.Viewer.Accounts) == 0 {
+			conds = append(conds, "FALSE")
+		} else {
+			add("account_id = ANY($%d)", filter.Viewer.Accounts)
+		}
+	}
+	if filter.Category != "" {
+		add("lower(primary_class) = lower($%d)", filter.Category)
+	}
+	if filter.Subcategory != "" {
+		add("lower(secondary_class) = lower($%d)", filter.Subcategory)
+	}
+	if filter.Recipient != "" {
+		add("strpos(lower(recipient), lower($%d)) > 0", filter.Recipient)
+	}
+	if filter.MinAmount != nil {
+		add("amount::float8 >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		add("amount::float8 <= $%d", *filter.MaxAmount)
+	}
+	if len(filter.Tags) > 0 {
+		add("tags @> $%d", filter.Tags)
+	}
+	if filter.Text != "" {
+		args = append(args, strings.ToLower(filter.Text))
+		n := len(args)
+		var fields []string
+		for _, column := range []string{"recipient", "usage", "description", "iban", "primary_class", "secondary_class", "kind"} {
+			fields = append(fields, fmt.Sprintf("strpos(lower(%s), $%d) > 0", column, n))
+		}
+		fields = append(fields, fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(tags) tag WHERE strpos(lower(tag), $%d) > 0)", n))
+		conds = append(conds, "("+strings.Join(fields, " OR ")+")")
+	}
+	if filter.Internal != nil {
+		add("internal = $%d", *filter.Internal)
+	}
+	if len(conds) == 0 {
+		return "TRUE", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// QueryTransactions returns up to limit transactions matching the filter
+// after the cursor, newest first. All of them are returned for limit 0, from
+// the first one for a nil cursor.
+func (s *Store) QueryTransactions(ctx context.Context, filter models.TransactionFilter, after *models.Cursor, limit int) ([]models.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cond, args := where(filter)
+	if after != nil {
+		args = append(args, after.Date, after.Hash)
+		cond += fmt.Sprintf(" AND (date < $%d::date OR (date = $%d::date AND hash > $%d))",
+			len(args)-1, len(args)-1, len(args))
+	}
+	stmt := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE %s
+		ORDER BY date DESC, hash`, transactionColumns, cond)
+	if limit > 0 {
+		stmt += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := s.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTransactions(rows)
+}
+
+// GetTransactionByHash returns the transaction with the hash or
+// models.ErrTransactionNotFound
+func (s *Store) GetTransactionByHash(ctx context.Context, hash string) (models.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var txn models.Transaction
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE hash = $1`, transactionColumns), hash).Scan(
+		&txn.AccountID, &txn.TransactionType, &txn.Date, &txn.Recipient,
+		&txn.Amount, &txn.Category, &txn.Subcategory,
+		&txn.IBAN, &txn.BIC, &txn.Usage, &txn.Description, &txn.Internal,
+		pgTypes.SQLScanner(&txn.Tags), &txn.Occurrence)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Transaction{}, models.ErrTransactionNotFound
+	}
+	return txn, err
+}
+
+// AggregateTransactions returns the totals of the transactions matching the
+// filter grouped by month, category or recipient. Internal transfers are
+// left out like in the reports.
+func (s *Store) AggregateTransactions(ctx context.Context, filter models.TransactionFilter, by string) ([]models.TransactionGroup, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	key := map[string]string{
+		models.GroupByMonth:     "to_char(date, 'YYYY-MM')",
+		models.GroupByCategory:  "primary_class",
+		models.GroupByRecipient: "recipient",
+	}[by]
+	if key == "" {
+		return nil, fmt.Errorf("unknown grouping %q", by)
+	}
+	cond, args := where(filter)
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s, count(*),
+			coalesce(sum(amount::float8) FILTER (WHERE amount >= 0), 0),
+			coalesce(-sum(amount::float8) FILTER (WHERE amount < 0), 0),
+			min(hash)
+		FROM transactions
+		WHERE %s AND NOT internal
+		GROUP BY 1`, key, cond), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.TransactionGroup
+	for rows.Next() {
+		var group models.TransactionGroup
+		if err := rows.Scan(&group.Key, &group.Count, &group.Income, &group.Expenses, &group.Example); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// StoredHashes returns which of the hashes belong to stored transactions
+func (s *Store) StoredHashes(ctx context.Context, hashes []string) (map[string]bool, error) {
+	stored := make(map[string]bool)
+	if len(hashes) == 0 {
+		return stored, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, `SELECT hash FROM transactions WHERE hash = ANY($1)`, hashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		stored[hash] = true
+	}
+	return stored, rows.Err()
+}
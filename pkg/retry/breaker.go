@@ -0,0 +1,116 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned while the circuit is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Circuit breaker states
+const (
+	StateClosed   = "closed"    // calls pass
+	StateOpen     = "open"      // calls fail immediately
+	StateHalfOpen = "half-open" // calls pass, the next result decides
+)
+
+// Breaker struct that holds the state of a circuit breaker. The circuit
+// opens after threshold consecutive failures and lets calls pass again
+// once the timeout elapsed.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	timeout   time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	lastError string
+	now       func() time.Time
+}
+
+// Status struct that holds the state of the breaker for health checks
+type Status struct {
+	State     string    `json:"state"`
+	Failures  int       `json:"failures"`
+	OpenedAt  time.Time `json:"opened_at,omitzero"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// NewBreaker returns a new closed Breaker
+func NewBreaker(threshold int, timeout time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{
+		threshold: threshold,
+		timeout:   timeout,
+		state:     StateClosed,
+		now:       time.Now,
+	}
+}
+
+// Allow returns ErrOpen while the circuit is open. Once the timeout
+// elapsed the circuit becomes half-open and calls pass again.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen {
+		if b.now().Sub(b.openedAt) < b.timeout {
+			return ErrOpen
+		}
+		b.state = StateHalfOpen
+	}
+	return nil
+}
+
+// Record updates the state by the result of a call. A success closes the
+// circuit, a failure in the half-open state or the threshold-th consecutive
+// failure opens it.
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.state = StateClosed
+		b.failures = 0
+		b.lastError = ""
+		return
+	}
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Status returns the current state of the breaker
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := Status{State: b.state, Failures: b.failures, LastError: b.lastError}
+	if b.state != StateClosed {
+		status.OpenedAt = b.openedAt
+	}
+	return status
+}
+
+// Do calls fn with the retry policy while the circuit lets the calls pass.
+// Every call is recorded, an open circuit stops the retries. Calls which
+// fail because ctx is cancelled aren't recorded, they don't tell anything
+// about the storage.
+func (b *Breaker) Do(ctx context.Context, policy Policy, fn func() error) error {
+	return Do(ctx, policy, func() error {
+		if err := b.Allow(); err != nil {
+			return Permanent(err)
+		}
+		err := fn()
+		if err != nil && ctx.Err() != nil {
+			return Permanent(err)
+		}
+		b.Record(err)
+		return err
+	})
+}
@@ -0,0 +1,88 @@
+// Package retry provides retries with exponential backoff and a circuit
+// breaker for the operations on the storage.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy struct that holds the settings of the exponential backoff
+type Policy struct {
+	// Attempts is the maximum number of calls, 0 retries until the
+	// context is cancelled
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+}
+
+// permanentError is an error which is returned without retrying
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks the error as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Do calls fn until it succeeds, returns a permanent error, the attempts
+// are exhausted or ctx is cancelled, and returns the last error. The delay
+// between the calls grows by the multiplier up to the max delay, every
+// delay is randomised by up to a half, so clients don't retry in lockstep.
+func Do(ctx context.Context, policy Policy, fn func() error) error {
+	delay := policy.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if policy.Attempts > 0 && attempt >= policy.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(jittered(delay))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		delay = nextDelay(delay, policy)
+	}
+}
+
+// nextDelay returns the delay after the current one
+func nextDelay(delay time.Duration, policy Policy) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	next := time.Duration(float64(delay) * multiplier)
+	if policy.MaxDelay > 0 && next > policy.MaxDelay {
+		return policy.MaxDelay
+	}
+	return next
+}
+
+// jittered returns a random duration in [delay/2, delay]
+func jittered(delay time.Duration) time.Duration {
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
@@ -0,0 +1,117 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errDown = errors.New("connection refused")
+
+func TestDo(t *testing.T) {
+	policy := Policy{Attempts: 3, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond, Multiplier: 2}
+
+	calls := 0
+	err := Do(context.Background(), policy, func() error {
+		calls++
+		if calls < 3 {
+			return errDown
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = Do(context.Background(), policy, func() error {
+		calls++
+		return errDown
+	})
+	assert.ErrorIs(t, err, errDown)
+	assert.Equal(t, 3, calls)
+
+	// permanent errors aren't retried
+	calls = 0
+	err = Do(context.Background(), policy, func() error {
+		calls++
+		return Permanent(errDown)
+	})
+	assert.Equal(t, errDown, err)
+	assert.Equal(t, 1, calls)
+
+	// unlimited attempts stop with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = Do(ctx, Policy{InitialDelay: time.Millisecond, Multiplier: 2}, func() error {
+		return errDown
+	})
+	assert.ErrorIs(t, err, errDown)
+}
+
+func TestNextDelay(t *testing.T) {
+	policy := Policy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	assert.Equal(t, 2*time.Second, nextDelay(time.Second, policy))
+	assert.Equal(t, 5*time.Second, nextDelay(4*time.Second, policy))
+	assert.Equal(t, time.Second, nextDelay(time.Second, Policy{}))
+
+	for i := 0; i < 100; i++ {
+		delay := jittered(time.Second)
+		assert.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		assert.LessOrEqual(t, delay, time.Second)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Record(errDown)
+	assert.NoError(t, breaker.Allow())
+	breaker.Record(errDown)
+	assert.ErrorIs(t, breaker.Allow(), ErrOpen)
+	status := breaker.Status()
+	assert.Equal(t, StateOpen, status.State)
+	assert.Equal(t, 2, status.Failures)
+	assert.Equal(t, errDown.Error(), status.LastError)
+
+	// after the timeout one failure opens the circuit again
+	now = now.Add(time.Minute)
+	assert.NoError(t, breaker.Allow())
+	assert.Equal(t, StateHalfOpen, breaker.Status().State)
+	breaker.Record(errDown)
+	assert.ErrorIs(t, breaker.Allow(), ErrOpen)
+
+	// and a success closes it
+	now = now.Add(time.Minute)
+	assert.NoError(t, breaker.Allow())
+	breaker.Record(nil)
+	assert.Equal(t, Status{State: StateClosed}, breaker.Status())
+}
+
+func TestBreakerDo(t *testing.T) {
+	breaker := NewBreaker(2, time.Minute)
+	policy := Policy{Attempts: 5, InitialDelay: time.Millisecond}
+
+	calls := 0
+	err := breaker.Do(context.Background(), policy, func() error {
+		calls++
+		return errDown
+	})
+	// the open circuit stops the retries
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.Equal(t, 2, calls)
+
+	// calls aborted by the cancellation don't count as failures
+	breaker = NewBreaker(1, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	err = breaker.Do(ctx, policy, func() error {
+		cancel()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, StateClosed, breaker.Status().State)
+}
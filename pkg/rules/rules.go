@@ -0,0 +1,65 @@
+// Package rules applies the user defined categorisation rules and the manual
+// category overrides to transactions.
+package rules
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// Categoriser struct that holds the rules ordered by priority and the
+// overrides by transaction hash
+type Categoriser struct {
+	rules     []models.Rule
+	overrides map[string]models.Override
+}
+
+// NewCategoriser returns a new Categoriser. Rules with a higher priority
+// win over the lower ones, overrides win over all rules.
+func NewCategoriser(rules []models.Rule, overrides []models.Override) *Categoriser {
+	c := &Categoriser{
+		rules:     append([]models.Rule(nil), rules...),
+		overrides: make(map[string]models.Override, len(overrides)),
+	}
+	sort.SliceStable(c.rules, func(i, j int) bool {
+		return c.rules[i].Priority > c.rules[j].Priority
+	})
+	for _, override := range overrides {
+		c.overrides[override.TransactionHash] = override
+	}
+	return c
+}
+
+// Apply sets the category of the transaction from its override or the first
+// matching rule and reports whether the category was changed. Transactions
+// without a match keep the category of the parser.
+func (c *Categoriser) Apply(txn *models.Transaction) bool {
+	category, subcategory, ok := c.match(txn)
+	if !ok || (txn.Category == category && txn.Subcategory == subcategory) {
+		return false
+	}
+	txn.Category = category
+	txn.Subcategory = subcategory
+	return true
+}
+
+// match returns the category of the override or the first matching rule of
+// the account of the transaction
+func (c *Categoriser) match(txn *models.Transaction) (string, string, bool) {
+	if override, ok := c.overrides[txn.Hash()]; ok {
+		return override.Category, override.Subcategory, true
+	}
+	recipient := strings.ToLower(txn.Recipient)
+	for _, rule := range c.rules {
+		if len(rule.Accounts) > 0 && !slices.Contains(rule.Accounts, txn.AccountID) {
+			continue
+		}
+		if rule.Pattern != "" && strings.Contains(recipient, strings.ToLower(rule.Pattern)) {
+			return rule.Category, rule.Subcategory, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,46 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	overridden := models.Transaction{Date: "2025-03-02", Amount: -12.5, Recipient: "Amazon Marketplace"}
+	categoriser := NewCategoriser(
+		[]models.Rule{
+			{ID: "1", Pattern: "amazon", Category: "shopping", Priority: 1},
+			{ID: "2", Pattern: "Amazon Prime", Category: "subscriptions", Subcategory: "video", Priority: 10},
+			{ID: "3", Pattern: "rewe", Category: "household", Priority: 20, Accounts: []string{"joint"}},
+		},
+		[]models.Override{
+			{TransactionHash: overridden.Hash(), Category: "gifts"},
+		},
+	)
+
+	tests := []struct {
+		txn         models.Transaction
+		category    string
+		subcategory string
+		changed     bool
+	}{
+		// the rule with the higher priority wins
+		{models.Transaction{Recipient: "AMAZON PRIME DE", Category: "other"}, "subscriptions", "video", true},
+		{models.Transaction{Recipient: "Amazon EU", Category: "other"}, "shopping", "", true},
+		{models.Transaction{Recipient: "Amazon EU", Category: "shopping"}, "shopping", "", false},
+		// overrides win over the rules
+		{overridden, "gifts", "", true},
+		// no match keeps the category of the parser
+		{models.Transaction{Recipient: "Rewe", Category: "groceries"}, "groceries", "", false},
+		// rules of accounts apply only to their transactions
+		{models.Transaction{AccountID: "joint", Recipient: "Rewe", Category: "groceries"}, "household", "", true},
+	}
+	for _, tc := range tests {
+		txn := tc.txn
+		assert.Equal(t, tc.changed, categoriser.Apply(&txn), tc.txn.Recipient)
+		assert.Equal(t, tc.category, txn.Category, tc.txn.Recipient)
+		assert.Equal(t, tc.subcategory, txn.Subcategory, tc.txn.Recipient)
+	}
+}
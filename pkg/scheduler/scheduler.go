@@ -0,0 +1,138 @@
+// Package scheduler runs named background tasks on cron schedules.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// Task is the work of a scheduled job
+type Task func(ctx context.Context)
+
+// Scheduler struct that holds the scheduled jobs
+type Scheduler struct {
+	logger *zap.SugaredLogger
+	jobs   map[string]*job
+	order  []string
+}
+
+// job is a task with its schedule
+type job struct {
+	name       string
+	schedule   cron.Schedule
+	runOnStart bool
+	jitter     time.Duration
+	task       Task
+	// triggered is buffered, so a trigger during a run causes exactly
+	// one more run
+	triggered chan struct{}
+}
+
+// New returns a new Scheduler without jobs
+func New() *Scheduler {
+	return &Scheduler{
+		logger: zap.S().With("package", "scheduler"),
+		jobs:   make(map[string]*job),
+	}
+}
+
+// Add schedules the task by the cron expression, e.g. "0 6 * * *" or
+// "@every 30m". With runOnStart the task runs as soon as Run is called.
+// Every run is delayed by a random duration up to jitter, so jobs of
+// several instances don't hit the storage at the same moment.
+func (s *Scheduler) Add(name, spec string, runOnStart bool, jitter time.Duration, task Task) error {
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %s is scheduled twice", name)
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q of job %s: %w", spec, name, err)
+	}
+	s.jobs[name] = &job{
+		name:       name,
+		schedule:   schedule,
+		runOnStart: runOnStart,
+		jitter:     jitter,
+		task:       task,
+		triggered:  make(chan struct{}, 1),
+	}
+	s.order = append(s.order, name)
+	return nil
+}
+
+// Trigger runs the job as soon as its current run is finished. Triggers
+// of unknown jobs are ignored.
+func (s *Scheduler) Trigger(name string) {
+	j, ok := s.jobs[name]
+	if !ok {
+		return
+	}
+	select {
+	case j.triggered <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs the jobs until ctx is cancelled. Every job runs on its own
+// goroutine, so a long run of one job doesn't delay the other ones, but
+// runs of the same job never overlap.
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, name := range s.order {
+		j := s.jobs[name]
+		s.logger.Info("Scheduling job ", j.name, ", next run at ", j.schedule.Next(time.Now()).Format(time.RFC3339))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runJob(ctx, j)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// runJob runs the job on its schedule and on triggers until ctx is cancelled
+func (s *Scheduler) runJob(ctx context.Context, j *job) {
+	if j.runOnStart {
+		s.execute(ctx, j, "start")
+	}
+	for {
+		next := j.schedule.Next(time.Now()).Add(randomJitter(j.jitter))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			s.execute(ctx, j, "schedule")
+		case <-j.triggered:
+			timer.Stop()
+			s.execute(ctx, j, "trigger")
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// execute runs the task once and logs its duration
+func (s *Scheduler) execute(ctx context.Context, j *job, reason string) {
+	if ctx.Err() != nil {
+		return
+	}
+	started := time.Now()
+	s.logger.Info("Starting job ", j.name, " by ", reason)
+	j.task(ctx)
+	s.logger.Info("Finished job ", j.name, " in ", time.Since(started).Round(time.Millisecond))
+}
+
+// randomJitter returns a random duration in [0, jitter)
+func randomJitter(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return rand.N(jitter)
+}
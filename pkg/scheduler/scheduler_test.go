@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdd(t *testing.T) {
+	s := New()
+	assert.NoError(t, s.Add("import", "0 6 * * *", false, 0, func(context.Context) {}))
+	assert.NoError(t, s.Add("report", "@every 1h", false, 0, func(context.Context) {}))
+	assert.Error(t, s.Add("import", "@every 1h", false, 0, func(context.Context) {}))
+	assert.Error(t, s.Add("broken", "61 * * * *", false, 0, func(context.Context) {}))
+}
+
+func TestRun(t *testing.T) {
+	var started, triggered atomic.Int32
+	s := New()
+	assert.NoError(t, s.Add("import", "@every 1h", true, 0, func(context.Context) {
+		started.Add(1)
+	}))
+	assert.NoError(t, s.Add("report", "@every 1h", false, 0, func(context.Context) {
+		triggered.Add(1)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	// only the job with run on start runs immediately
+	assert.Eventually(t, func() bool { return started.Load() == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(0), triggered.Load())
+
+	s.Trigger("report")
+	s.Trigger("unknown")
+	assert.Eventually(t, func() bool { return triggered.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, int32(1), started.Load())
+}
+
+func TestRandomJitter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), randomJitter(0))
+	for i := 0; i < 100; i++ {
+		jitter := randomJitter(time.Minute)
+		assert.GreaterOrEqual(t, jitter, time.Duration(0))
+		assert.Less(t, jitter, time.Minute)
+	}
+}
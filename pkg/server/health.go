@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/retry"
+)
+
+const (
+	checkTimeout = 5 * time.Second
+	// statusRuns is the number of latest runs searched for the last run of
+	// every job
+	statusRuns = 100
+	// pendingTTL is how long the listing of the pending files is reused,
+	// the status is unauthenticated and listing a bucket or downloading the
+	// messages of a mailbox is too expensive for every request
+	pendingTTL = time.Minute
+)
+
+// Check struct that holds the result of a single readiness check
+type Check struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// newCheck returns the check of the error
+func newCheck(err error) Check {
+	if err != nil {
+		return Check{Error: err.Error()}
+	}
+	return Check{OK: true}
+}
+
+// handleHealth reports that the process is alive, it doesn't depend on
+// the storage so an outage doesn't get the service restarted
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady reports whether the storage is reachable, the migrations are
+// applied and the categorisation rules can be loaded. The service isn't
+// ready while any check fails or the storage circuit is open.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	body := map[string]any{}
+	checks := map[string]Check{}
+	if s.breaker != nil {
+		breaker := s.breaker.Status()
+		body["breaker"] = breaker
+		if breaker.State == retry.StateOpen {
+			checks["storage"] = Check{Error: "circuit is open: " + breaker.LastError}
+		}
+	}
+	if _, ok := checks["storage"]; !ok {
+		checks["storage"] = newCheck(s.store.Ping(ctx))
+	}
+	if checks["storage"].OK {
+		checks["migrations"] = newCheck(s.store.CheckSchema(ctx))
+		checks["rules"] = newCheck(s.loadRules(ctx))
+	}
+
+	body["status"] = "ready"
+	status := http.StatusOK
+	for name, check := range checks {
+		if !check.OK {
+			s.logger.Warn("Readiness check ", name, " failed: ", check.Error)
+			body["status"] = "not ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	body["checks"] = checks
+	writeJSON(w, status, body)
+}
+
+// loadRules loads the rules and overrides the way the categoriser does
+func (s *Server) loadRules(ctx context.Context) error {
+	if _, err := s.store.GetRules(ctx); err != nil {
+		return err
+	}
+	_, err := s.store.GetOverrides(ctx)
+	return err
+}
+
+// handleStatus returns the last run of every background job and the files
+// waiting for the import
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.store.GetJobRuns(r.Context(), statusRuns)
+	if err != nil {
+		s.logger.Error("Error getting job runs", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error getting job runs")
+		return
+	}
+	// the runs are sorted newest first
+	lastRuns := map[string]models.JobRun{}
+	for _, run := range runs {
+		if _, ok := lastRuns[run.Job]; !ok {
+			lastRuns[run.Job] = run
+		}
+	}
+	body := map[string]any{"last_runs": lastRuns}
+
+	if s.pending != nil {
+		pending, listedAt, err := s.pending.get(r.Context())
+		if err != nil {
+			s.logger.Error("Error listing pending files", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "error listing pending files")
+			return
+		}
+		if pending == nil {
+			pending = []string{}
+		}
+		body["pending_files"] = pending
+		body["pending_listed_at"] = listedAt
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// pendingCache struct that holds the last listing of the pending files
+type pendingCache struct {
+	lister PendingLister
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	files    []string
+	err      error
+	listedAt time.Time
+}
+
+// get returns the pending files and when they were listed. They are listed
+// again once the last listing is older than the ttl, concurrent requests
+// wait for the same listing. Failures are reused as well, except for the
+// cancellation of the request.
+func (c *pendingCache) get(ctx context.Context) ([]string, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.listedAt.IsZero() && time.Since(c.listedAt) < c.ttl {
+		return c.files, c.listedAt, c.err
+	}
+	files, err := c.lister.PendingFiles(ctx)
+	if err != nil && ctx.Err() != nil {
+		return nil, time.Time{}, err
+	}
+	c.files, c.err, c.listedAt = files, err, time.Now().UTC()
+	return c.files, c.listedAt, c.err
+}
@@ -0,0 +1,172 @@
+// Package server provides the HTTP server exposing the state of the service.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/retry"
+)
+
+const (
+	defaultRunsLimit = 20
+	maxRunsLimit     = 1000
+	shutdownTimeout  = 5 * time.Second
+)
+
+// Server struct that holds the store and the routes of the HTTP server
+type Server struct {
+	logger  *zap.SugaredLogger
+	store   models.Store
+	auth    *auth.Authenticator
+	breaker *retry.Breaker
+	pending *pendingCache
+	mux     *http.ServeMux
+}
+
+// PendingLister is the source of the files waiting for the import
+type PendingLister interface {
+	PendingFiles(ctx context.Context) ([]string, error)
+}
+
+// New returns a new Server reading from the store. Only the probes are
+// open, the status and the job runs are served to the users of the
+// authenticator.
+func New(store models.Store, authenticator *auth.Authenticator) *Server {
+	s := &Server{
+		logger: zap.S().With("package", "server"),
+		store:  store,
+		auth:   authenticator,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("GET /readyz", s.handleReady)
+	s.mux.HandleFunc("GET /status", s.require(models.RoleViewer, s.handleStatus))
+	s.mux.HandleFunc("GET /jobs/runs", s.require(models.RoleViewer, s.handleJobRuns))
+	return s
+}
+
+// require rejects the requests of unauthenticated users and of users
+// without the role
+func (s *Server) require(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := s.auth.Authenticate(r)
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="c24-expense"`)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		case err != nil:
+			s.logger.Error("Error authenticating request", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "error authenticating request")
+			return
+		case !auth.Allows(user.Role, role):
+			writeError(w, http.StatusForbidden, "the "+role+" role is required")
+			return
+		}
+		next(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	}
+}
+
+// WithBreaker sets the circuit breaker of the storage operations, whose
+// state is reported by the readiness check
+func (s *Server) WithBreaker(breaker *retry.Breaker) *Server {
+	s.breaker = breaker
+	return s
+}
+
+// WithPending sets the source of the pending files reported by the status,
+// they are listed at most once per pendingTTL
+func (s *Server) WithPending(pending PendingLister) *Server {
+	s.pending = &pendingCache{lister: pending, ttl: pendingTTL}
+	return s
+}
+
+// Handle serves the handler under the pattern next to the status endpoints
+func (s *Server) Handle(pattern string, handler http.Handler) *Server {
+	s.mux.Handle(pattern, handler)
+	return s
+}
+
+// Handler returns the routes of the server
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Run serves HTTP on the port until ctx is cancelled
+func (s *Server) Run(ctx context.Context, port int) error {
+	return ListenAndServe(ctx, port, s.mux)
+}
+
+// ListenAndServe serves the handler on the port until ctx is cancelled,
+// requests in progress are finished within shutdownTimeout
+func ListenAndServe(ctx context.Context, port int, handler http.Handler) error {
+	logger := zap.S().With("package", "server")
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Error shutting down HTTP server", zap.Error(err))
+		}
+	}()
+
+	logger.Info("HTTP server is listening on ", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleJobRuns returns the latest runs of the background jobs, newest
+// first. The number of runs is set by the limit query parameter.
+func (s *Server) handleJobRuns(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRunsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxRunsLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxRunsLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	runs, err := s.store.GetJobRuns(r.Context(), limit)
+	if err != nil {
+		s.logger.Error("Error getting job runs", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "error getting job runs")
+		return
+	}
+	if runs == nil {
+		runs = []models.JobRun{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"runs": runs})
+}
+
+// writeJSON writes the value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		zap.S().With("package", "server").Error("Error writing response", zap.Error(err))
+	}
+}
+
+// writeError writes the message as a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
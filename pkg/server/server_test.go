@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer returns the server of the store and the API token of a
+// viewer
+func newTestServer(t *testing.T, store models.Store) (*Server, string) {
+	viewer := models.User{Name: "viewer", Role: models.RoleViewer}
+	_, err := auth.SaveUser(context.Background(), store, viewer, "password")
+	assert.NoError(t, err)
+	token, _, err := auth.CreateToken(context.Background(), store, viewer.Name, "test")
+	assert.NoError(t, err)
+	return New(store, auth.New(store, config.AuthConfig{SessionTTL: 1})), token
+}
+
+// get returns the response of the handler to the request with the token
+func get(handler http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestJobRuns(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	assert.NoError(t, store.InsertJobRun(context.Background(), models.JobRun{ID: "1", Job: "import", StartedAt: now.Add(-time.Hour), Status: models.JobRunFailed, Error: "boom"}))
+	assert.NoError(t, store.InsertJobRun(context.Background(), models.JobRun{ID: "2", Job: "import", StartedAt: now, Status: models.JobRunSuccess, RowsInserted: 55}))
+	server, token := newTestServer(t, store)
+	handler := server.Handler()
+
+	rec := get(handler, http.MethodGet, "/jobs/runs?limit=1", token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Runs []models.JobRun `json:"runs"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Runs, 1)
+	assert.Equal(t, "2", body.Runs[0].ID)
+	assert.Equal(t, 55, body.Runs[0].RowsInserted)
+
+	assert.Equal(t, http.StatusBadRequest, get(handler, http.MethodGet, "/jobs/runs?limit=abc", token).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, get(handler, http.MethodPost, "/jobs/runs", token).Code)
+	// the runs aren't public
+	assert.Equal(t, http.StatusUnauthorized, get(handler, http.MethodGet, "/jobs/runs", "").Code)
+}
+
+func TestHealth(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	breaker := retry.NewBreaker(1, time.Minute)
+	breaker.Record(errors.New("connection refused"))
+	handler := New(store, nil).WithBreaker(breaker).Handler()
+
+	// the liveness doesn't depend on the storage
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, rec.Body.String())
+}
+
+// unreadyStore fails the schema check
+type unreadyStore struct {
+	models.Store
+}
+
+func (unreadyStore) CheckSchema(context.Context) error {
+	return errors.New("migration 0003_rules.sql isn't applied")
+}
+
+func TestReady(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	breaker := retry.NewBreaker(1, time.Minute)
+	handler := New(store, nil).WithBreaker(breaker).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Status  string           `json:"status"`
+		Checks  map[string]Check `json:"checks"`
+		Breaker retry.Status     `json:"breaker"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "ready", body.Status)
+	assert.Equal(t, map[string]Check{"storage": {OK: true}, "migrations": {OK: true}, "rules": {OK: true}}, body.Checks)
+
+	breaker.Record(errors.New("connection refused"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	body.Checks = nil
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "not ready", body.Status)
+	assert.Equal(t, retry.StateOpen, body.Breaker.State)
+	assert.Equal(t, "circuit is open: connection refused", body.Checks["storage"].Error)
+
+	handler = New(unreadyStore{store}, nil).Handler()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	body.Checks = nil
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.True(t, body.Checks["storage"].OK)
+	assert.False(t, body.Checks["migrations"].OK)
+	assert.True(t, body.Checks["rules"].OK)
+}
+
+// pendingFiles is a fixed list of pending files
+type pendingFiles []string
+
+func (p pendingFiles) PendingFiles(context.Context) ([]string, error) {
+	return p, nil
+}
+
+func TestStatus(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	assert.NoError(t, store.InsertJobRun(context.Background(), models.JobRun{ID: "1", Job: "import", StartedAt: now.Add(-time.Hour), Status: models.JobRunFailed}))
+	assert.NoError(t, store.InsertJobRun(context.Background(), models.JobRun{ID: "2", Job: "import", StartedAt: now, Status: models.JobRunSuccess}))
+	assert.NoError(t, store.InsertJobRun(context.Background(), models.JobRun{ID: "3", Job: "report", StartedAt: now.Add(-2 * time.Hour), Status: models.JobRunSuccess}))
+	server, token := newTestServer(t, store)
+	handler := server.WithPending(pendingFiles{"march.csv"}).Handler()
+
+	// the status isn't public
+	assert.Equal(t, http.StatusUnauthorized, get(handler, http.MethodGet, "/status", "").Code)
+	rec := get(handler, http.MethodGet, "/status", token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		LastRuns     map[string]models.JobRun `json:"last_runs"`
+		PendingFiles []string                 `json:"pending_files"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.LastRuns, 2)
+	assert.Equal(t, "2", body.LastRuns["import"].ID)
+	assert.Equal(t, "3", body.LastRuns["report"].ID)
+	assert.Equal(t, []string{"march.csv"}, body.PendingFiles)
+}
+
+// countingLister counts the listings of the pending files
+type countingLister struct {
+	calls int
+	err   error
+}
+
+func (l *countingLister) PendingFiles(context.Context) ([]string, error) {
+	l.calls++
+	return []string{fmt.Sprintf("file-%d.csv", l.calls)}, l.err
+}
+
+func TestStatusPendingCache(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	lister := &countingLister{}
+	server, token := newTestServer(t, store)
+	server.WithPending(lister)
+	status := func() (int, []string) {
+		rec := get(server.Handler(), http.MethodGet, "/status", token)
+		var body struct {
+			PendingFiles []string `json:"pending_files"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body.PendingFiles
+	}
+
+	// the listing is reused within the ttl
+	for range 3 {
+		code, files := status()
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"file-1.csv"}, files)
+	}
+	assert.Equal(t, 1, lister.calls)
+
+	// failures too
+	server.pending.listedAt = time.Time{}
+	lister.err = errors.New("bucket not found")
+	for range 2 {
+		code, _ := status()
+		assert.Equal(t, http.StatusInternalServerError, code)
+	}
+	assert.Equal(t, 2, lister.calls)
+
+	server.pending.listedAt = time.Now().Add(-pendingTTL)
+	lister.err = nil
+	_, files := status()
+	assert.Equal(t, []string{"file-3.csv"}, files)
+}
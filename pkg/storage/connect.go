@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/retry"
+)
+
+// RetryPolicy returns the backoff of the storage operations configured
+// by conf.Retry
+func RetryPolicy(conf *config.Config) retry.Policy {
+	return retry.Policy{
+		Attempts:     conf.Retry.Attempts,
+		InitialDelay: time.Duration(conf.Retry.InitialDelay) * time.Millisecond,
+		MaxDelay:     time.Duration(conf.Retry.MaxDelay) * time.Millisecond,
+		Multiplier:   conf.Retry.Multiplier,
+	}
+}
+
+// NewBreaker returns the circuit breaker of the storage operations
+// configured by conf.Retry
+func NewBreaker(conf *config.Config) *retry.Breaker {
+	return retry.NewBreaker(conf.Retry.BreakerThreshold,
+		time.Duration(conf.Retry.BreakerTimeout)*time.Second)
+}
+
+// Connect opens the store like Open, but waits for an unreachable storage
+// with the configured backoff until ctx is cancelled
+func Connect(ctx context.Context, conf *config.Config) (models.Store, error) {
+	logger := zap.S().With("package", "storage")
+	policy := RetryPolicy(conf)
+	policy.Attempts = 0
+
+	var store models.Store
+	err := retry.Do(ctx, policy, func() error {
+		var err error
+		store, err = Open(conf)
+		if errors.Is(err, ErrUnknownBackend) {
+			return retry.Permanent(err)
+		}
+		if err != nil {
+			logger.Warn("Storage is unreachable, retrying", zap.Error(err))
+		}
+		return err
+	})
+	return store, err
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// readOnlyStore struct that holds a store whose writes are discarded
+type readOnlyStore struct {
+	models.Store
+}
+
+// ReadOnly returns the store with reads passed through and writes
+// discarded, it is used to preview imports without changing the data
+func ReadOnly(store models.Store) models.Store {
+	return readOnlyStore{Store: store}
+}
+
+func (readOnlyStore) InsertTransaction(context.Context, models.Transaction) error    { return nil }
+func (readOnlyStore) InsertTransactions(context.Context, []models.Transaction) error { return nil }
+func (readOnlyStore) MarkInternal(context.Context, []string) error                   { return nil }
+func (readOnlyStore) UpdateCategories(context.Context, []models.Transaction) error   { return nil }
+func (readOnlyStore) UpdateTags(context.Context, []models.Transaction) error         { return nil }
+func (readOnlyStore) InsertAccount(context.Context, models.Account) error            { return nil }
+func (readOnlyStore) InsertSHAFile(context.Context, models.SHAFile) error            { return nil }
+func (readOnlyStore) InsertImport(context.Context, models.Import) error              { return nil }
+func (readOnlyStore) InsertJobRun(context.Context, models.JobRun) error              { return nil }
+func (readOnlyStore) InsertRule(context.Context, models.Rule) error                  { return nil }
+func (readOnlyStore) DeleteRule(context.Context, string) error                       { return nil }
+func (readOnlyStore) UpsertOverride(context.Context, models.Override) error          { return nil }
+func (readOnlyStore) UpsertUser(context.Context, models.User) error                  { return nil }
+func (readOnlyStore) DeleteUser(context.Context, string) error                       { return nil }
+func (readOnlyStore) InsertAPIToken(context.Context, models.APIToken) error          { return nil }
+func (readOnlyStore) DeleteAPIToken(context.Context, string) error                   { return nil }
+func (readOnlyStore) InsertAuditEntry(context.Context, models.AuditEntry) error      { return nil }
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnly(t *testing.T) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	txn := models.Transaction{Date: "2025-03-01", Amount: -10, Recipient: "Globus"}
+	assert.NoError(t, store.InsertTransaction(context.Background(), txn))
+
+	readOnly := ReadOnly(store)
+	assert.NoError(t, readOnly.InsertTransactions(context.Background(), []models.Transaction{{Date: "2025-03-02", Amount: -5}}))
+	assert.NoError(t, readOnly.InsertSHAFile(context.Background(), models.SHAFile{Path: "march.csv", SHA256: "abc"}))
+
+	txns, err := readOnly.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, txns, 1)
+	files, err := store.GetSHAFiles(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,67 @@
+// Package storage opens the storage backend selected in the configuration.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/driver"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/postgres"
+)
+
+var (
+	// ErrUnknownBackend is returned for an unsupported storage setting
+	ErrUnknownBackend = errors.New("unknown storage backend")
+	// ErrSchemaOutdated is returned by OpenExisting for a store whose schema
+	// isn't migrated
+	ErrSchemaOutdated = errors.New("schema isn't up to date, start the daemon once to migrate it")
+)
+
+// Open returns the models.Store configured by conf.Storage, the schema of
+// PostgreSQL is migrated
+func Open(conf *config.Config) (models.Store, error) {
+	return open(conf, true)
+}
+
+// OpenExisting returns the models.Store configured by conf.Storage like
+// Open, but the schema isn't migrated. The store is checked by CheckSchema
+// instead, so previews never change the database.
+func OpenExisting(ctx context.Context, conf *config.Config) (models.Store, error) {
+	store, err := open(conf, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.CheckSchema(ctx); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("%w: %w", ErrSchemaOutdated, err)
+	}
+	return store, nil
+}
+
+// open returns the configured store, migrating PostgreSQL if migrate is set
+func open(conf *config.Config, migrate bool) (models.Store, error) {
+	switch conf.Storage {
+	case config.StorageClickhouse, "":
+		conn, err := driver.OpenDB(conf.Clickhouse.Username,
+			conf.Clickhouse.Password, conf.Clickhouse.Address, conf.Clickhouse.Database)
+		if err != nil {
+			return nil, err
+		}
+		return &models.DBModel{DB: conn}, nil
+	case config.StoragePostgres:
+		openDB := postgres.OpenDB
+		if !migrate {
+			openDB = postgres.Connect
+		}
+		return openDB(conf.Postgres.Username, conf.Postgres.Password,
+			conf.Postgres.Address, conf.Postgres.Database, conf.Postgres.SSLMode)
+	case config.StorageLocal:
+		return localstore.New(conf.LocalStore.Path)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, conf.Storage)
+	}
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenExisting(t *testing.T) {
+	conf := &config.Config{Storage: config.StorageLocal}
+	conf.LocalStore.Path = filepath.Join(t.TempDir(), "store.json")
+
+	store, err := OpenExisting(context.Background(), conf)
+	assert.NoError(t, err)
+	_, err = store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+	// opening never writes
+	assert.NoFileExists(t, conf.LocalStore.Path)
+
+	conf.Storage = "sqlite"
+	_, err = OpenExisting(context.Background(), conf)
+	assert.ErrorIs(t, err, ErrUnknownBackend)
+}
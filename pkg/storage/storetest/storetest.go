@@ -0,0 +1,278 @@
+// Package storetest contains the conformance tests every models.Store
+// implementation has to pass.
+package storetest
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// Run runs the conformance tests against the stores returned by newStore,
+// every test gets a store without transactions
+func Run(t *testing.T, newStore func(t *testing.T) models.Store) {
+	t.Run("dedupe", func(t *testing.T) { testDedupe(t, newStore(t)) })
+	t.Run("accounts", func(t *testing.T) { testAccounts(t, newStore(t)) })
+	t.Run("occurrence", func(t *testing.T) { testOccurrence(t, newStore(t)) })
+	t.Run("order", func(t *testing.T) { testOrder(t, newStore(t)) })
+	t.Run("query", func(t *testing.T) { testQuery(t, newStore(t)) })
+	t.Run("pages", func(t *testing.T) { testPages(t, newStore(t)) })
+	t.Run("aggregate", func(t *testing.T) { testAggregate(t, newStore(t)) })
+	t.Run("by hash", func(t *testing.T) { testByHash(t, newStore(t)) })
+	t.Run("stored hashes", func(t *testing.T) { testStoredHashes(t, newStore(t)) })
+}
+
+// testTransaction returns a transaction of the main account
+func testTransaction(date, recipient string, amount float64) models.Transaction {
+	return models.Transaction{
+		AccountID:       "main",
+		TransactionType: "Card payment",
+		Date:            date,
+		Amount:          amount,
+		Recipient:       recipient,
+		Usage:           "card 1234",
+		Category:        "Food",
+		Tags:            []string{},
+	}
+}
+
+// testDedupe checks that one row is stored per hash, whether the duplicates
+// are inserted one by one, in one batch or in later batches
+func testDedupe(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	coffee := testTransaction("2025-03-01", "Cafe", -3.5)
+	lunch := testTransaction("2025-03-01", "Canteen", -8)
+
+	assert.NoError(t, store.InsertTransaction(ctx, coffee))
+	assert.NoError(t, store.InsertTransaction(ctx, coffee))
+	assert.NoError(t, store.InsertTransactions(ctx, []models.Transaction{coffee, lunch, lunch}))
+	assert.NoError(t, store.InsertTransactions(ctx, []models.Transaction{lunch}))
+	assert.NoError(t, store.InsertTransactions(ctx, nil))
+
+	stored, err := store.GetTransactions(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{coffee.Hash(), lunch.Hash()}, hashes(stored))
+}
+
+// testAccounts checks that the same row of two accounts is stored twice
+func testAccounts(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	main := testTransaction("2025-03-01", "Cafe", -3.5)
+	joint := main
+	joint.AccountID = "joint"
+
+	assert.NoError(t, store.InsertTransactions(ctx, []models.Transaction{main, joint}))
+	stored, err := store.GetTransactions(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{main.Hash(), joint.Hash()}, hashes(stored))
+}
+
+// testOccurrence checks that identical rows of one export are stored with
+// their occurrence
+func testOccurrence(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	first := testTransaction("2025-03-01", "Cafe", -3.5)
+	second := first
+	second.Occurrence = 1
+
+	assert.NoError(t, store.InsertTransactions(ctx, []models.Transaction{first, second}))
+	assert.NoError(t, store.InsertTransactions(ctx, []models.Transaction{first, second}))
+	stored, err := store.GetTransactions(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{first.Hash(), second.Hash()}, hashes(stored))
+}
+
+// testOrder checks that the transactions are returned by date with all
+// fields which are part of the hash
+func testOrder(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	txns := []models.Transaction{
+		testTransaction("2025-03-02", "Bakery", -2.4),
+		testTransaction("2025-02-28", "Landlord", -900),
+		testTransaction("2025-03-01", "Employer", 2500.01),
+	}
+	assert.NoError(t, store.InsertTransactions(ctx, txns))
+
+	stored, err := store.GetTransactions(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{txns[1].Hash(), txns[2].Hash(), txns[0].Hash()}, hashes(stored))
+}
+
+// queryTransactions returns the transactions for the filters of testQuery
+// and testAggregate
+func queryTransactions() []models.Transaction {
+	rent := testTransaction("2025-02-28", "Landlord", -900)
+	rent.Category, rent.Subcategory = "Housing", "Rent"
+	rent.Tags = []string{"fixed", "flat"}
+	salary := testTransaction("2025-03-01", "Employer GmbH", 2500)
+	salary.Category, salary.Usage = "Income", "salary march"
+	coffee := testTransaction("2025-03-02", "SuperCafe", -3.5)
+	coffee.Tags = []string{"fixed"}
+	savings := testTransaction("2025-03-02", "Savings", -100)
+	savings.AccountID, savings.Internal = "joint", true
+	return []models.Transaction{rent, salary, coffee, savings}
+}
+
+// testQuery checks that the filter conditions are applied by the store
+func testQuery(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	txns := queryTransactions()
+	rent, salary, coffee, savings := txns[0], txns[1], txns[2], txns[3]
+	assert.NoError(t, store.InsertTransactions(ctx, txns))
+
+	low, high := -10.0, 100.0
+	internal, external := true, false
+	tests := []struct {
+		name   string
+		filter models.TransactionFilter
+		want   []models.Transaction
+	}{
+		{name: "all", want: []models.Transaction{coffee, savings, salary, rent}},
+		{name: "dates", filter: models.TransactionFilter{From: "2025-03-01", To: "2025-03-01"}, want: []models.Transaction{salary}},
+		{name: "accounts", filter: models.TransactionFilter{Accounts: []string{"joint"}}, want: []models.Transaction{savings}},
+		{name: "category", filter: models.TransactionFilter{Category: "housing", Subcategory: "RENT"}, want: []models.Transaction{rent}},
+		{name: "recipient", filter: models.TransactionFilter{Recipient: "cafe"}, want: []models.Transaction{coffee}},
+		{name: "amounts", filter: models.TransactionFilter{MinAmount: &low, MaxAmount: &high}, want: []models.Transaction{coffee}},
+		{name: "tags", filter: models.TransactionFilter{Tags: []string{"fixed", "flat"}}, want: []models.Transaction{rent}},
+		{name: "text", filter: models.TransactionFilter{Text: "MARCH"}, want: []models.Transaction{salary}},
+		{name: "text in tags", filter: models.TransactionFilter{Text: "fix"}, want: []models.Transaction{coffee, rent}},
+		{name: "internal", filter: models.TransactionFilter{Internal: &internal}, want: []models.Transaction{savings}},
+		{name: "external", filter: models.TransactionFilter{Internal: &external}, want: []models.Transaction{coffee, salary, rent}},
+		{
+			name:   "viewer",
+			filter: models.TransactionFilter{Viewer: &models.User{Accounts: []string{"joint"}}},
+			want:   []models.Transaction{savings},
+		},
+		{
+			name:   "viewer of all accounts",
+			filter: models.TransactionFilter{Viewer: &models.User{Accounts: []string{models.AllAccounts}}},
+			want:   []models.Transaction{coffee, savings, salary, rent},
+		},
+		{name: "viewer without accounts", filter: models.TransactionFilter{Viewer: &models.User{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.QueryTransactions(ctx, tt.filter, nil, 0)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, hashes(tt.want), hashes(got))
+		})
+	}
+}
+
+// testPages checks that the pages are ordered newest first, transactions of
+// the same day by their hash, and continue after the cursor
+func testPages(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	var txns []models.Transaction
+	for _, date := range []string{"2025-03-01", "2025-03-02", "2025-03-03"} {
+		for _, recipient := range []string{"Bakery", "Cafe", "Kiosk"} {
+			txns = append(txns, testTransaction(date, recipient, -2))
+		}
+	}
+	assert.NoError(t, store.InsertTransactions(ctx, txns))
+
+	all, err := store.QueryTransactions(ctx, models.TransactionFilter{}, nil, 0)
+	assert.NoError(t, err)
+	assert.Len(t, all, len(txns))
+	assert.True(t, sort.SliceIsSorted(all, func(i, j int) bool {
+		if all[i].Date != all[j].Date {
+			return all[i].Date > all[j].Date
+		}
+		return all[i].Hash() < all[j].Hash()
+	}))
+
+	var (
+		paged []models.Transaction
+		after *models.Cursor
+	)
+	for range len(txns) {
+		page, err := store.QueryTransactions(ctx, models.TransactionFilter{}, after, 4)
+		assert.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, page...)
+		last := page[len(page)-1]
+		after = &models.Cursor{Date: last.Date, Hash: last.Hash()}
+	}
+	assert.Equal(t, hashes(all), hashes(paged))
+}
+
+// testAggregate checks the totals of the groups, internal transfers are
+// left out
+func testAggregate(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	txns := queryTransactions()
+	extra := testTransaction("2025-03-05", "Bakery", -2.5)
+	assert.NoError(t, store.InsertTransactions(ctx, append(txns, extra)))
+
+	groups, err := store.AggregateTransactions(ctx, models.TransactionFilter{}, models.GroupByMonth)
+	assert.NoError(t, err)
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	assert.Len(t, groups, 2)
+	if len(groups) == 2 {
+		assert.Equal(t, "2025-02", groups[0].Key)
+		assert.Equal(t, 1, groups[0].Count)
+		assert.InDelta(t, 900, groups[0].Expenses, 0.001)
+		assert.Equal(t, txns[0].Hash(), groups[0].Example)
+		assert.Equal(t, "2025-03", groups[1].Key)
+		assert.Equal(t, 3, groups[1].Count)
+		assert.InDelta(t, 2500, groups[1].Income, 0.001)
+		assert.InDelta(t, 6, groups[1].Expenses, 0.001)
+	}
+
+	groups, err = store.AggregateTransactions(ctx, models.TransactionFilter{Category: "Food"}, models.GroupByRecipient)
+	assert.NoError(t, err)
+	keys := make([]string, 0, len(groups))
+	for _, group := range groups {
+		keys = append(keys, group.Key)
+	}
+	assert.ElementsMatch(t, []string{"SuperCafe", "Bakery"}, keys)
+
+	_, err = store.AggregateTransactions(ctx, models.TransactionFilter{}, "weekday")
+	assert.Error(t, err)
+}
+
+// testByHash checks the lookup of a single transaction
+func testByHash(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	txns := queryTransactions()
+	assert.NoError(t, store.InsertTransactions(ctx, txns))
+
+	got, err := store.GetTransactionByHash(ctx, txns[0].Hash())
+	assert.NoError(t, err)
+	assert.Equal(t, txns[0].Hash(), got.Hash())
+	assert.Equal(t, txns[0].Tags, got.Tags)
+	assert.Equal(t, "Rent", got.Subcategory)
+
+	_, err = store.GetTransactionByHash(ctx, "unknown")
+	assert.ErrorIs(t, err, models.ErrTransactionNotFound)
+}
+
+// testStoredHashes checks the lookup of the hashes of a batch
+func testStoredHashes(t *testing.T, store models.Store) {
+	ctx := context.Background()
+	txns := queryTransactions()
+	assert.NoError(t, store.InsertTransactions(ctx, txns[:2]))
+
+	stored, err := store.StoredHashes(ctx, hashes(txns))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{txns[0].Hash(): true, txns[1].Hash(): true}, stored)
+
+	stored, err = store.StoredHashes(ctx, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+}
+
+// hashes returns the hashes of the txns
+func hashes(txns []models.Transaction) []string {
+	result := make([]string, 0, len(txns))
+	for _, txn := range txns {
+		result = append(result, txn.Hash())
+	}
+	return result
+}
@@ -0,0 +1,142 @@
+// Package transfers detects internal transfers between own accounts and pockets,
+// which must not be counted as income or expenses.
+package transfers
+
+import (
+	"math"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/accounts"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// pocketType is the translated type of the C24 transfers between the
+// main account and its pockets
+const pocketType = "Pocket"
+
+// Detector struct that holds the own accounts and the date window
+// in which opposite transactions are paired
+type Detector struct {
+	accounts *accounts.Resolver
+	window   time.Duration
+}
+
+// NewDetector returns a new Detector. windowDays is the maximum difference
+// in days between the two sides of a transfer.
+func NewDetector(resolver *accounts.Resolver, windowDays int) *Detector {
+	return &Detector{
+		accounts: resolver,
+		window:   time.Duration(windowDays) * 24 * time.Hour,
+	}
+}
+
+// Detect flags the internal transfers of txns. A transaction is internal if
+// it's a pocket transfer, if its counterparty IBAN belongs to an own account,
+// or if a transaction with the opposite amount exists in another own account
+// within the date window. stored are the transactions which are already in
+// the store, hashes of those which became internal are returned.
+func (d *Detector) Detect(txns []models.Transaction, stored []models.Transaction) []string {
+	for i := range txns {
+		if txns[i].TransactionType == pocketType {
+			txns[i].Internal = true
+			continue
+		}
+		if _, ok := d.accounts.ByIBAN(txns[i].IBAN); ok {
+			txns[i].Internal = true
+		}
+	}
+
+	// candidates for pairing are the stored transactions which aren't
+	// internal yet and the new transactions themselves
+	candidates := make([]*models.Transaction, 0, len(stored)+len(txns))
+	isStored := make(map[*models.Transaction]bool, len(stored))
+	for i := range stored {
+		if !stored[i].Internal {
+			candidates = append(candidates, &stored[i])
+			isStored[&stored[i]] = true
+		}
+	}
+	for i := range txns {
+		candidates = append(candidates, &txns[i])
+	}
+
+	var updated []string
+	for i := range txns {
+		txn := &txns[i]
+		if txn.Internal {
+			continue
+		}
+		pair := d.findPair(txn, candidates)
+		if pair == nil {
+			continue
+		}
+		txn.Internal = true
+		pair.Internal = true
+		if isStored[pair] {
+			updated = append(updated, pair.Hash())
+		}
+	}
+	return updated
+}
+
+// Range returns the first and the last date of the transactions which can
+// be paired with txns, ok is false if none of txns has a valid date
+func (d *Detector) Range(txns []models.Transaction) (from, to string, ok bool) {
+	var first, last time.Time
+	for _, txn := range txns {
+		date, err := time.Parse("2006-01-02", txn.Date)
+		if err != nil {
+			continue
+		}
+		if !ok || date.Before(first) {
+			first = date
+		}
+		if !ok || date.After(last) {
+			last = date
+		}
+		ok = true
+	}
+	if !ok {
+		return "", "", false
+	}
+	return first.Add(-d.window).Format("2006-01-02"), last.Add(d.window).Format("2006-01-02"), true
+}
+
+// findPair returns the candidate with the opposite amount in another account
+// whose date is closest to the date of txn
+func (d *Detector) findPair(txn *models.Transaction, candidates []*models.Transaction) *models.Transaction {
+	date, err := time.Parse("2006-01-02", txn.Date)
+	if err != nil {
+		return nil
+	}
+	var (
+		best     *models.Transaction
+		bestDiff time.Duration
+	)
+	for _, c := range candidates {
+		if c == txn || c.Internal || c.AccountID == txn.AccountID ||
+			cents(c.Amount) != -cents(txn.Amount) || cents(txn.Amount) == 0 {
+			continue
+		}
+		cDate, err := time.Parse("2006-01-02", c.Date)
+		if err != nil {
+			continue
+		}
+		diff := cDate.Sub(date)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > d.window {
+			continue
+		}
+		if best == nil || diff < bestDiff {
+			best, bestDiff = c, diff
+		}
+	}
+	return best
+}
+
+// cents converts the amount to cents to compare amounts exactly
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,61 @@
+package transfers
+
+import (
+	"testing"
+
+	"github.com/13excite/c24-expense/pkg/accounts"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	resolver := accounts.NewResolver(&config.Config{
+		Accounts: []config.AccountConfig{
+			{ID: "main", IBAN: "DE11111111111111111111"},
+			{ID: "savings", IBAN: "DE22222222222222222222"},
+			{ID: "other"},
+		},
+	})
+	detector := NewDetector(resolver, 3)
+
+	stored := []models.Transaction{
+		// pair of the transfer from main to other
+		{AccountID: "other", TransactionType: "SEPA", Date: "2025-03-03", Amount: 200, Recipient: "John"},
+		// too far away
+		{AccountID: "other", TransactionType: "SEPA", Date: "2025-03-20", Amount: 50, Recipient: "John"},
+	}
+	txns := []models.Transaction{
+		{AccountID: "main", TransactionType: "Pocket", Date: "2025-03-01", Amount: -100, Recipient: "Sparen"},
+		{AccountID: "main", TransactionType: "SEPA", Date: "2025-03-01", Amount: -300, IBAN: "DE22 2222 2222 2222 2222 22"},
+		{AccountID: "main", TransactionType: "SEPA", Date: "2025-03-01", Amount: -200, Recipient: "John"},
+		{AccountID: "main", TransactionType: "SEPA", Date: "2025-03-01", Amount: -50, Recipient: "John"},
+		{AccountID: "main", TransactionType: "Card", Date: "2025-03-02", Amount: -9.99, Recipient: "Rewe"},
+		// opposite amounts in the same account aren't transfers
+		{AccountID: "main", TransactionType: "Card", Date: "2025-03-03", Amount: 9.99, Recipient: "Rewe"},
+	}
+
+	updated := detector.Detect(txns, stored)
+
+	expected := []bool{true, true, true, false, false, false}
+	for i, txn := range txns {
+		assert.Equal(t, expected[i], txn.Internal, "transaction %d", i)
+	}
+	assert.Equal(t, []string{stored[0].Hash()}, updated)
+	assert.True(t, stored[0].Internal)
+	assert.False(t, stored[1].Internal)
+}
+
+func TestRange(t *testing.T) {
+	detector := NewDetector(accounts.NewResolver(&config.Config{}), 3)
+
+	from, to, ok := detector.Range([]models.Transaction{
+		{Date: "2025-03-10"}, {Date: "invalid"}, {Date: "2025-02-27"},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, "2025-02-24", from)
+	assert.Equal(t, "2025-03-13", to)
+
+	_, _, ok = detector.Range([]models.Transaction{{Date: "invalid"}})
+	assert.False(t, ok)
+}
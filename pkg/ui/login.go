@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/audit"
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// loginPage struct that holds the data of the login form
+type loginPage struct {
+	base
+	Name  string
+	Next  string
+	Error string
+}
+
+// require sends the users which aren't logged in to the login form and
+// rejects the users without the role. The user is passed on in the request
+// context. Forms are only accepted from the UI itself.
+func (u *UI) require(role string, next http.HandlerFunc) http.HandlerFunc {
+	return u.sameOrigin(func(w http.ResponseWriter, r *http.Request) {
+		user, err := u.auth.Authenticate(r)
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated) && r.Method == http.MethodGet:
+			http.Redirect(w, r, Prefix+"login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		case errors.Is(err, auth.ErrUnauthenticated):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			u.logger.Error("Error authenticating request", zap.Error(err))
+			http.Error(w, "error authenticating request", http.StatusInternalServerError)
+			return
+		case !auth.Allows(user.Role, role):
+			http.Error(w, "the "+role+" role is required", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	})
+}
+
+// actor returns the user of the request as the author of changes in the
+// audit log
+func (u *UI) actor(r *http.Request) audit.Actor {
+	return audit.Actor{User: auth.UserFrom(r.Context()).Name, Source: models.AuditSourceUI}
+}
+
+// sameOrigin rejects forms posted from other sites. The session cookie
+// isn't sent along with them anyway, this covers older browsers.
+func (u *UI) sameOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				parsed, err := url.Parse(origin)
+				if err != nil || parsed.Host != r.Host {
+					http.Error(w, "cross-origin request", http.StatusForbidden)
+					return
+				}
+			}
+		}
+		next(w, r)
+	}
+}
+
+// handleLoginForm renders the login form
+func (u *UI) handleLoginForm(w http.ResponseWriter, r *http.Request) {
+	u.render(w, http.StatusOK, "login.html", loginPage{
+		base: newBase(r, "Log in"),
+		Next: backURL(r.URL.Query().Get("next")),
+	})
+}
+
+// handleLogin checks the password of the form and starts a session
+func (u *UI) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	data := loginPage{
+		base: newBase(r, "Log in"),
+		Name: r.PostForm.Get("name"),
+		Next: backURL(r.PostForm.Get("next")),
+	}
+	id, expires, err := u.auth.Login(r.Context(), data.Name, r.PostForm.Get("password"))
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		u.logger.Warn("Failed login of ", data.Name, " from ", r.RemoteAddr)
+		data.Error = err.Error()
+		u.render(w, http.StatusUnauthorized, "login.html", data)
+		return
+	}
+	if err != nil {
+		u.logger.Error("Error logging in", zap.Error(err))
+		http.Error(w, "error logging in", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    id,
+		Path:     Prefix,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, data.Next, http.StatusSeeOther)
+}
+
+// handleLogout ends the session
+func (u *UI) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(auth.SessionCookie); err == nil {
+		u.auth.Logout(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Path:     Prefix,
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, Prefix+"login", http.StatusSeeOther)
+}
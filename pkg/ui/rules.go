@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/audit"
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/c24parser"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// rulePage struct that holds the data of the rule form
+type rulePage struct {
+	base
+	Rule    models.Rule
+	Example *models.Transaction
+	Back    string
+	Error   string
+}
+
+// handleNewRule renders the rule form, prefilled from the transaction of
+// the hash query parameter
+func (u *UI) handleNewRule(w http.ResponseWriter, r *http.Request) {
+	data := rulePage{base: newBase(r, "New rule"), Back: backURL(r.URL.Query().Get("back"))}
+	if hash := r.URL.Query().Get("hash"); hash != "" {
+		txn, err := u.findTransaction(r, hash)
+		if errors.Is(err, models.ErrTransactionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			u.logger.Error("Error getting transactions", zap.Error(err))
+			http.Error(w, "error getting transactions", http.StatusInternalServerError)
+			return
+		}
+		data.Example = &txn
+		data.Rule.Pattern = txn.Recipient
+		if txn.Category != c24parser.FallbackCategory {
+			data.Rule.Category, data.Rule.Subcategory = txn.Category, txn.Subcategory
+		}
+	}
+	u.render(w, http.StatusOK, "rule.html", data)
+}
+
+// handleCreateRule stores the rule of the form and applies it to the stored
+// transactions in the background. The rules of users who can't see all
+// accounts apply only to their accounts.
+func (u *UI) handleCreateRule(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	data := rulePage{base: newBase(r, "New rule"), Back: backURL(r.PostForm.Get("back"))}
+	data.Rule = models.Rule{
+		ID:          fmt.Sprintf("rule-%d", time.Now().UnixNano()),
+		Pattern:     strings.TrimSpace(r.PostForm.Get("pattern")),
+		Category:    strings.TrimSpace(r.PostForm.Get("category")),
+		Subcategory: strings.TrimSpace(r.PostForm.Get("subcategory")),
+	}
+	priority, err := strconv.Atoi(r.PostForm.Get("priority"))
+	switch {
+	case err != nil && r.PostForm.Get("priority") != "":
+		data.Error = "priority must be a number"
+	case data.Rule.Pattern == "" || data.Rule.Category == "":
+		data.Error = "pattern and category are required"
+	}
+	if data.Error != "" {
+		u.render(w, http.StatusBadRequest, "rule.html", data)
+		return
+	}
+	data.Rule.Priority = priority
+	if user := auth.UserFrom(r.Context()); user.Role != models.RoleAdmin && !slices.Contains(user.Accounts, models.AllAccounts) {
+		if len(user.Accounts) == 0 {
+			http.Error(w, "no accounts to apply the rule to", http.StatusForbidden)
+			return
+		}
+		data.Rule.Accounts = slices.Clone(user.Accounts)
+	}
+
+	if err := audit.Record(r.Context(), u.store, u.actor(r), audit.RuleChange(nil, &data.Rule)); err != nil {
+		u.logger.Error("Error recording change", zap.Error(err))
+		http.Error(w, "error recording change", http.StatusInternalServerError)
+		return
+	}
+	if err := u.store.InsertRule(r.Context(), data.Rule); err != nil {
+		u.logger.Error("Error saving rule", zap.Error(err))
+		http.Error(w, "error saving rule", http.StatusInternalServerError)
+		return
+	}
+	u.requestRecategorisation()
+	u.logger.Info("Rule ", data.Rule.ID, " created")
+	http.Redirect(w, r, data.Back, http.StatusSeeOther)
+}
@@ -0,0 +1,184 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/api"
+	"github.com/13excite/c24-expense/pkg/audit"
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+const pageLimit = 50
+
+// transactionsPage struct that holds the data of the transactions page
+type transactionsPage struct {
+	base
+	Query    url.Values
+	Accounts []models.Account
+	Page     api.Page
+	NextURL  string
+	Back     string
+	Error    string
+}
+
+// handleTransactions renders a page of the transactions matching the
+// search form
+func (u *UI) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	user := auth.UserFrom(r.Context())
+	data := transactionsPage{base: newBase(r, "Transactions"), Query: query, Back: r.URL.RequestURI()}
+	filter, err := api.ParseFilter(query, user)
+	if err != nil {
+		data.Error = err.Error()
+		u.render(w, http.StatusBadRequest, "transactions.html", data)
+		return
+	}
+	accounts, err := u.store.GetAccounts(r.Context())
+	if err != nil {
+		u.logger.Error("Error getting accounts", zap.Error(err))
+	}
+	for _, account := range accounts {
+		if user.CanSee(account.ID) {
+			data.Accounts = append(data.Accounts, account)
+		}
+	}
+
+	data.Page, err = api.Paginate(r.Context(), u.store, filter, query.Get("cursor"), pageLimit)
+	if errors.Is(err, api.ErrInvalidCursor) {
+		data.Error = err.Error()
+		u.render(w, http.StatusBadRequest, "transactions.html", data)
+		return
+	}
+	if err != nil {
+		u.logger.Error("Error getting transactions", zap.Error(err))
+		http.Error(w, "error getting transactions", http.StatusInternalServerError)
+		return
+	}
+	data.NextURL = nextURL(r.URL, data.Page.NextCursor)
+	u.render(w, http.StatusOK, "transactions.html", data)
+}
+
+// nextURL returns the URL of the next page or an empty string on the last
+// page
+func nextURL(current *url.URL, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	query := current.Query()
+	query.Set("cursor", cursor)
+	return current.Path + "?" + query.Encode()
+}
+
+// handleUpdateTransaction stores the category and the tags of the inline
+// form. A changed category is saved as an override, so the next import or
+// recategorisation keeps it.
+func (u *UI) handleUpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	txn, err := u.findTransaction(r, r.PathValue("hash"))
+	if errors.Is(err, models.ErrTransactionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		u.logger.Error("Error getting transactions", zap.Error(err))
+		http.Error(w, "error getting transactions", http.StatusInternalServerError)
+		return
+	}
+
+	category := strings.TrimSpace(r.PostForm.Get("category"))
+	subcategory := strings.TrimSpace(r.PostForm.Get("subcategory"))
+	if category == "" {
+		http.Error(w, "category is required", http.StatusBadRequest)
+		return
+	}
+	actor := u.actor(r)
+	if category != txn.Category || subcategory != txn.Subcategory {
+		override := models.Override{
+			TransactionHash: txn.Hash(),
+			Category:        category,
+			Subcategory:     subcategory,
+			UpdatedAt:       time.Now().UTC(),
+		}
+		if err := audit.Record(r.Context(), u.store, actor, audit.OverrideChange(txn, category, subcategory)); err != nil {
+			u.logger.Error("Error recording change", zap.Error(err))
+			http.Error(w, "error recording change", http.StatusInternalServerError)
+			return
+		}
+		txn.Category, txn.Subcategory = category, subcategory
+		if err := u.store.UpsertOverride(r.Context(), override); err != nil {
+			u.logger.Error("Error saving override", zap.Error(err))
+			http.Error(w, "error saving category", http.StatusInternalServerError)
+			return
+		}
+		if err := u.store.UpdateCategories(r.Context(), []models.Transaction{txn}); err != nil {
+			u.logger.Error("Error updating category", zap.Error(err))
+			http.Error(w, "error saving category", http.StatusInternalServerError)
+			return
+		}
+	}
+	if tags := parseTags(r.PostForm.Get("tags")); !slices.Equal(tags, txn.Tags) {
+		if err := audit.Record(r.Context(), u.store, actor, audit.TagsChange(txn, tags)); err != nil {
+			u.logger.Error("Error recording change", zap.Error(err))
+			http.Error(w, "error recording change", http.StatusInternalServerError)
+			return
+		}
+		txn.Tags = tags
+		if err := u.store.UpdateTags(r.Context(), []models.Transaction{txn}); err != nil {
+			u.logger.Error("Error updating tags", zap.Error(err))
+			http.Error(w, "error saving tags", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.Redirect(w, r, backURL(r.PostForm.Get("back")), http.StatusSeeOther)
+}
+
+// findTransaction returns the stored transaction with the hash, if the
+// user of the request may see it
+func (u *UI) findTransaction(r *http.Request, hash string) (models.Transaction, error) {
+	txn, err := u.store.GetTransactionByHash(r.Context(), hash)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	if !auth.UserFrom(r.Context()).CanSee(txn.AccountID) {
+		return models.Transaction{}, models.ErrTransactionNotFound
+	}
+	return txn, nil
+}
+
+// parseTags returns the comma separated tags without blanks and repeats
+func parseTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// backURL returns the page to return to after a form, only pages of the UI
+// are accepted
+func backURL(value string) string {
+	if strings.HasPrefix(value, Prefix) && !strings.Contains(value, "//") && !strings.Contains(value, `\`) {
+		return value
+	}
+	return Prefix + "transactions"
+}
+
+// formatAmount formats the amount with cents
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
@@ -0,0 +1,145 @@
+// Package ui provides the server rendered web UI for browsing the stored
+// transactions and correcting their categories and tags.
+package ui
+
+import (
+	"context"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// Prefix is the path under which the UI is served
+const Prefix = "/ui/"
+
+//go:embed templates/*.html static/*
+var files embed.FS
+
+// pages are the templates rendered into the layout
+var pages = []string{"transactions.html", "uncategorised.html", "rule.html", "login.html"}
+
+// Recategoriser applies the stored rules to the stored transactions
+type Recategoriser interface {
+	Recategorise(ctx context.Context) (int, error)
+}
+
+// UI struct that holds the store, the templates and the routes of the UI
+type UI struct {
+	logger       *zap.SugaredLogger
+	store        models.Store
+	recategorise chan struct{}
+	auth         *auth.Authenticator
+	templates    map[string]*template.Template
+	mux          *http.ServeMux
+}
+
+// base struct that holds the data of the layout shared by all pages
+type base struct {
+	Title   string
+	User    *models.User
+	CanEdit bool
+}
+
+// newBase returns the layout data of the page for the user of the request
+func newBase(r *http.Request, title string) base {
+	user := auth.UserFrom(r.Context())
+	return base{
+		Title:   title,
+		User:    user,
+		CanEdit: user != nil && auth.Allows(user.Role, models.RoleEditor),
+	}
+}
+
+// New returns a new UI on the store. The users log in with their password
+// through the authenticator.
+func New(store models.Store, authenticator *auth.Authenticator) *UI {
+	u := &UI{
+		logger:    zap.S().With("package", "ui"),
+		store:     store,
+		auth:      authenticator,
+		templates: make(map[string]*template.Template),
+		mux:       http.NewServeMux(),
+	}
+	funcs := template.FuncMap{
+		"amount": formatAmount,
+		"join":   strings.Join,
+	}
+	for _, page := range pages {
+		u.templates[page] = template.Must(template.New("layout.html").Funcs(funcs).
+			ParseFS(files, "templates/layout.html", "templates/"+page))
+	}
+	static, err := fs.Sub(files, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	u.mux.Handle("GET "+Prefix+"static/", http.StripPrefix(Prefix+"static/", http.FileServerFS(static)))
+	u.mux.HandleFunc("GET "+Prefix+"{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, Prefix+"transactions", http.StatusFound)
+	})
+	u.mux.HandleFunc("GET "+Prefix+"login", u.handleLoginForm)
+	u.mux.HandleFunc("POST "+Prefix+"login", u.sameOrigin(u.handleLogin))
+	u.mux.HandleFunc("POST "+Prefix+"logout", u.sameOrigin(u.handleLogout))
+	u.mux.HandleFunc("GET "+Prefix+"transactions", u.require(models.RoleViewer, u.handleTransactions))
+	u.mux.HandleFunc("POST "+Prefix+"transactions/{hash}", u.require(models.RoleEditor, u.handleUpdateTransaction))
+	u.mux.HandleFunc("GET "+Prefix+"uncategorised", u.require(models.RoleViewer, u.handleUncategorised))
+	u.mux.HandleFunc("GET "+Prefix+"rules/new", u.require(models.RoleEditor, u.handleNewRule))
+	u.mux.HandleFunc("POST "+Prefix+"rules", u.require(models.RoleEditor, u.handleCreateRule))
+	return u
+}
+
+// WithRecategoriser applies the rules created in the UI to the stored
+// transactions through the recategoriser. It runs in the background until
+// ctx is cancelled, rules created during a run are applied by the next one.
+func (u *UI) WithRecategoriser(ctx context.Context, recategoriser Recategoriser) *UI {
+	u.recategorise = make(chan struct{}, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-u.recategorise:
+			}
+			changed, err := recategoriser.Recategorise(ctx)
+			if err != nil {
+				// the rules are applied by the next recategorisation
+				u.logger.Error("Error applying rules", zap.Error(err))
+				continue
+			}
+			u.logger.Info("Recategorised ", changed, " transactions")
+		}
+	}()
+	return u
+}
+
+// requestRecategorisation starts a recategorisation unless one is pending
+func (u *UI) requestRecategorisation() {
+	if u.recategorise == nil {
+		return
+	}
+	select {
+	case u.recategorise <- struct{}{}:
+	default:
+	}
+}
+
+// Handler returns the routes of the UI
+func (u *UI) Handler() http.Handler {
+	return u.mux
+}
+
+// render writes the page with the data
+func (u *UI) render(w http.ResponseWriter, status int, page string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := u.templates[page].Execute(w, data); err != nil {
+		u.logger.Error("Error rendering ", page, zap.Error(err))
+	}
+}
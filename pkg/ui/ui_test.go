@@ -0,0 +1,283 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/c24parser"
+	"github.com/13excite/c24-expense/pkg/config"
+	"github.com/13excite/c24-expense/pkg/localstore"
+	"github.com/13excite/c24-expense/pkg/models"
+	"github.com/13excite/c24-expense/pkg/rules"
+	"github.com/stretchr/testify/assert"
+)
+
+// storeRecategoriser applies the rules of the store like the recategorise job
+type storeRecategoriser struct {
+	store models.Store
+}
+
+func (s storeRecategoriser) Recategorise(ctx context.Context) (int, error) {
+	txns, err := s.store.GetTransactions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	storedRules, err := s.store.GetRules(ctx)
+	if err != nil {
+		return 0, err
+	}
+	overrides, err := s.store.GetOverrides(ctx)
+	if err != nil {
+		return 0, err
+	}
+	categoriser := rules.NewCategoriser(storedRules, overrides)
+	var changed []models.Transaction
+	for _, txn := range txns {
+		if categoriser.Apply(&txn) {
+			changed = append(changed, txn)
+		}
+	}
+	return len(changed), s.store.UpdateCategories(ctx, changed)
+}
+
+var testTransactions = []models.Transaction{
+	{AccountID: "main", Date: "2025-03-01", Amount: -3.50, Recipient: "SuperCafe", Category: c24parser.FallbackCategory},
+	{AccountID: "main", Date: "2025-03-02", Amount: -4.10, Recipient: "SuperCafe", Category: c24parser.FallbackCategory},
+	{AccountID: "main", Date: "2025-03-03", Amount: -54.20, Recipient: "Globus", Category: c24parser.FallbackCategory},
+	{AccountID: "main", Date: "2025-03-04", Amount: -900, Recipient: "Landlord", Category: "Housing"},
+	{AccountID: "joint", Date: "2025-03-05", Amount: -20, Recipient: "Cinema", Category: "Leisure"},
+}
+
+// newTestUI returns the UI of a local store with a few transactions and
+// the sessions of an editor, of a viewer and of an editor of the joint
+// account
+func newTestUI(t *testing.T) (http.Handler, *localstore.Store, map[string]string) {
+	store, err := localstore.New(filepath.Join(t.TempDir(), "store.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertTransactions(context.Background(), testTransactions))
+	handler := New(store, auth.New(store, config.AuthConfig{SessionTTL: 1})).
+		WithRecategoriser(t.Context(), storeRecategoriser{store}).Handler()
+
+	sessions := make(map[string]string)
+	for _, user := range []models.User{
+		{Name: "editor", Role: models.RoleEditor, Accounts: []string{models.AllAccounts}},
+		{Name: "partner", Role: models.RoleViewer, Accounts: []string{"joint"}},
+		{Name: "joint-editor", Role: models.RoleEditor, Accounts: []string{"joint"}},
+	} {
+		_, err := auth.SaveUser(context.Background(), store, user, "password")
+		assert.NoError(t, err)
+		rec := do(handler, "", http.MethodPost, "/ui/login", url.Values{"name": {user.Name}, "password": {"password"}})
+		assert.Equal(t, http.StatusSeeOther, rec.Code)
+		for _, cookie := range rec.Result().Cookies() {
+			sessions[user.Name] = cookie.Value
+		}
+	}
+	return handler, store, sessions
+}
+
+// do returns the response of the request in the session
+func do(handler http.Handler, session, method, target string, form url.Values) *httptest.ResponseRecorder {
+	var r *http.Request
+	if form == nil {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if session != "" {
+		r.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: session})
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestTransactionsPage(t *testing.T) {
+	handler, _, sessions := newTestUI(t)
+
+	rec := do(handler, sessions["editor"], http.MethodGet, "/ui/", nil)
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	rec = do(handler, sessions["editor"], http.MethodGet, "/ui/transactions", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Landlord")
+	assert.Contains(t, rec.Body.String(), "-54.20")
+
+	rec = do(handler, sessions["editor"], http.MethodGet, "/ui/transactions?q=globus", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Globus")
+	assert.NotContains(t, rec.Body.String(), "Landlord")
+
+	rec = do(handler, sessions["editor"], http.MethodGet, "/ui/transactions?from=March", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(handler, sessions["editor"], http.MethodGet, "/ui/static/style.css", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestUpdateTransaction(t *testing.T) {
+	handler, store, sessions := newTestUI(t)
+	hash := testTransactions[2].Hash()
+
+	rec := do(handler, sessions["editor"], http.MethodPost, "/ui/transactions/"+hash, url.Values{
+		"category":    {"Shopping"},
+		"subcategory": {"Market"},
+		"tags":        {"food, weekly, food"},
+		"back":        {"/ui/uncategorised"},
+	})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/ui/uncategorised", rec.Header().Get("Location"))
+
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Shopping", stored[2].Category)
+	assert.Equal(t, "Market", stored[2].Subcategory)
+	assert.Equal(t, []string{"food", "weekly"}, stored[2].Tags)
+	// the category is kept by the next recategorisation
+	overrides, err := store.GetOverrides(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, overrides, 1)
+	assert.Equal(t, hash, overrides[0].TransactionHash)
+	// both changes are in the audit log
+	entries, err := store.GetAuditEntries(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, "editor", entry.User)
+		assert.Equal(t, models.AuditSourceUI, entry.Source)
+		assert.Equal(t, hash, entry.EntityID)
+	}
+	assert.Equal(t, []string{models.AuditTags, models.AuditOverride}, []string{entries[0].Entity, entries[1].Entity})
+
+	// only pages of the UI are accepted to return to
+	rec = do(handler, sessions["editor"], http.MethodPost, "/ui/transactions/"+hash, url.Values{
+		"category": {"Shopping"},
+		"back":     {"//example.com/"},
+	})
+	assert.Equal(t, "/ui/transactions", rec.Header().Get("Location"))
+
+	rec = do(handler, sessions["editor"], http.MethodPost, "/ui/transactions/"+hash, url.Values{"category": {""}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(handler, sessions["editor"], http.MethodPost, "/ui/transactions/unknown", url.Values{"category": {"Shopping"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUncategorisedAndRules(t *testing.T) {
+	handler, store, sessions := newTestUI(t)
+
+	rec := do(handler, sessions["editor"], http.MethodGet, "/ui/uncategorised", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "3 transactions are left")
+	// the recipient with most transactions comes first
+	assert.Less(t, strings.Index(body, "SuperCafe"), strings.Index(body, "Globus"))
+	assert.NotContains(t, body, "Landlord")
+
+	rec = do(handler, sessions["editor"], http.MethodGet, "/ui/rules/new?hash="+testTransactions[0].Hash(), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `value="SuperCafe"`)
+
+	rec = do(handler, sessions["editor"], http.MethodPost, "/ui/rules", url.Values{
+		"pattern":  {"supercafe"},
+		"category": {"Food"},
+		"back":     {"/ui/uncategorised"},
+	})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	storedRules, err := store.GetRules(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, storedRules, 1)
+	entries, err := store.GetAuditEntries(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, models.AuditRule, entries[0].Entity)
+	assert.Equal(t, storedRules[0].ID, entries[0].EntityID)
+	assert.Empty(t, storedRules[0].Accounts)
+	// the rule is applied in the background
+	assert.Eventually(t, func() bool {
+		stored, err := store.GetTransactions(context.Background())
+		return err == nil && stored[0].Category == "Food" && stored[1].Category == "Food"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rec = do(handler, sessions["editor"], http.MethodGet, "/ui/uncategorised", nil)
+	assert.Contains(t, rec.Body.String(), "1 transactions are left")
+
+	rec = do(handler, sessions["editor"], http.MethodPost, "/ui/rules", url.Values{"pattern": {"x"}, "priority": {"high"}, "category": {"Food"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "priority must be a number")
+}
+
+func TestRuleOfRestrictedUser(t *testing.T) {
+	handler, store, sessions := newTestUI(t)
+
+	// the rule of the joint editor applies only to the joint account
+	rec := do(handler, sessions["joint-editor"], http.MethodPost, "/ui/rules", url.Values{
+		"pattern":  {"supercafe"},
+		"category": {"Food"},
+	})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	storedRules, err := store.GetRules(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, storedRules, 1)
+	assert.Equal(t, []string{"joint"}, storedRules[0].Accounts)
+
+	rec = do(handler, sessions["joint-editor"], http.MethodPost, "/ui/rules", url.Values{
+		"pattern":  {"cinema"},
+		"category": {"Fun"},
+	})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Eventually(t, func() bool {
+		stored, err := store.GetTransactions(context.Background())
+		return err == nil && stored[4].Category == "Fun"
+	}, 5*time.Second, 10*time.Millisecond)
+	stored, err := store.GetTransactions(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, c24parser.FallbackCategory, stored[0].Category)
+}
+
+func TestLogin(t *testing.T) {
+	handler, _, sessions := newTestUI(t)
+
+	rec := do(handler, "", http.MethodGet, "/ui/transactions?q=globus", nil)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/ui/login?next=%2Fui%2Ftransactions%3Fq%3Dglobus", rec.Header().Get("Location"))
+
+	rec = do(handler, "", http.MethodPost, "/ui/login", url.Values{"name": {"editor"}, "password": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid user name or password")
+
+	rec = do(handler, sessions["editor"], http.MethodPost, "/ui/logout", nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	rec = do(handler, sessions["editor"], http.MethodGet, "/ui/transactions", nil)
+	assert.Equal(t, http.StatusFound, rec.Code)
+}
+
+func TestViewer(t *testing.T) {
+	handler, _, sessions := newTestUI(t)
+
+	// the partner sees only the joint account and can't edit
+	rec := do(handler, sessions["partner"], http.MethodGet, "/ui/transactions", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Cinema")
+	assert.NotContains(t, rec.Body.String(), "Landlord")
+	assert.NotContains(t, rec.Body.String(), "<form class=\"inline\"")
+
+	rec = do(handler, sessions["partner"], http.MethodPost, "/ui/transactions/"+testTransactions[4].Hash(), url.Values{"category": {"Shopping"}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = do(handler, sessions["editor"], http.MethodPost, "/ui/transactions/"+testTransactions[4].Hash(), url.Values{"category": {"Shopping"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	req := httptest.NewRequest(http.MethodPost, "/ui/transactions/"+testTransactions[4].Hash(), strings.NewReader("category=Food"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://attacker.test")
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: sessions["editor"]})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/13excite/c24-expense/pkg/api"
+	"github.com/13excite/c24-expense/pkg/auth"
+	"github.com/13excite/c24-expense/pkg/c24parser"
+	"github.com/13excite/c24-expense/pkg/models"
+)
+
+// recipientCount struct that holds the number of uncategorised
+// transactions of a recipient and one of them as example for a rule
+type recipientCount struct {
+	Recipient string
+	Count     int
+	Hash      string
+}
+
+// uncategorisedPage struct that holds the data of the uncategorised queue
+type uncategorisedPage struct {
+	base
+	Total      int
+	Recipients []recipientCount
+	Page       api.Page
+	NextURL    string
+	Back       string
+}
+
+// handleUncategorised renders the queue of the transactions left in the
+// fallback category, internal transfers aren't part of it. The recipients
+// with the most transactions come first, so a rule for them empties the
+// queue the fastest.
+func (u *UI) handleUncategorised(w http.ResponseWriter, r *http.Request) {
+	internal := false
+	filter := api.Filter{
+		Category: c24parser.FallbackCategory,
+		Internal: &internal,
+		Viewer:   auth.UserFrom(r.Context()),
+	}
+	groups, err := u.store.AggregateTransactions(r.Context(), filter, models.GroupByRecipient)
+	if err != nil {
+		u.logger.Error("Error getting transactions", zap.Error(err))
+		http.Error(w, "error getting transactions", http.StatusInternalServerError)
+		return
+	}
+
+	data := uncategorisedPage{base: newBase(r, "Uncategorised"), Back: r.URL.RequestURI()}
+	counts := make(map[string]*recipientCount, len(groups))
+	for _, group := range groups {
+		data.Total += group.Count
+		counts[group.Key] = &recipientCount{Recipient: group.Key, Count: group.Count, Hash: group.Example}
+	}
+	data.Recipients = sortedCounts(counts)
+
+	data.Page, err = api.Paginate(r.Context(), u.store, filter, r.URL.Query().Get("cursor"), pageLimit)
+	if errors.Is(err, api.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		u.logger.Error("Error getting transactions", zap.Error(err))
+		http.Error(w, "error getting transactions", http.StatusInternalServerError)
+		return
+	}
+	data.NextURL = nextURL(r.URL, data.Page.NextCursor)
+	u.render(w, http.StatusOK, "uncategorised.html", data)
+}
+
+// sortedCounts returns the counts ordered by number, highest first
+func sortedCounts(counts map[string]*recipientCount) []recipientCount {
+	sorted := make([]recipientCount, 0, len(counts))
+	for _, count := range counts {
+		sorted = append(sorted, *count)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Recipient < sorted[j].Recipient
+	})
+	return sorted
+}